@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/repository"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const usage = `Usage: admin [-env=.env] [-config=FILE] ACTION EMAIL
+
+Actions:
+  promote EMAIL   Give the user the admin role
+  demote EMAIL    Take the admin role away again
+
+The new role is in the user's access tokens from their next refresh or login.
+`
+
+func main() {
+	envFile := flag.String("env", ".env", "Path to environment file")
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "Path to YAML config file (optional)")
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	action, email := flag.Arg(0), flag.Arg(1)
+
+	var role domain.Role
+	switch action {
+	case "promote":
+		role = domain.RoleAdmin
+	case "demote":
+		role = domain.RoleUser
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dbConfig, err := config.LoadDatabase(*envFile, *configFile)
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	db, err := gorm.Open(postgres.Open(dbConfig.URL), &gorm.Config{TranslateError: true})
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	users := repository.NewUserRepository(db)
+	ctx := context.Background()
+
+	user, err := users.FindByEmail(ctx, email)
+	if err != nil {
+		log.Fatalf("Failed to find user %s: %v", email, err)
+	}
+	if user.Role == role {
+		log.Printf("%s already has role %s", email, role)
+		return
+	}
+	if err := users.UpdateRole(ctx, user.ID, role); err != nil {
+		log.Fatalf("Failed to update role of %s: %v", email, err)
+	}
+	log.Printf("%s now has role %s", email, role)
+}
@@ -3,8 +3,9 @@ package main
 import (
 	"context"
 	"flag"
-	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,13 +13,21 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 	_ "github.com/prachaya-orr/relearn-golang/docs" // Import generated docs
+	"github.com/prachaya-orr/relearn-golang/internal/config"
 	"github.com/prachaya-orr/relearn-golang/internal/domain"
 	"github.com/prachaya-orr/relearn-golang/internal/handler"
+	"github.com/prachaya-orr/relearn-golang/internal/job"
+	"github.com/prachaya-orr/relearn-golang/internal/logging"
+	"github.com/prachaya-orr/relearn-golang/internal/mailer"
+	"github.com/prachaya-orr/relearn-golang/internal/metrics"
 	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+	"github.com/prachaya-orr/relearn-golang/internal/oidc"
+	"github.com/prachaya-orr/relearn-golang/internal/password"
 	"github.com/prachaya-orr/relearn-golang/internal/repository"
 	"github.com/prachaya-orr/relearn-golang/internal/service"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
+	"github.com/prachaya-orr/relearn-golang/internal/tracing"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"gorm.io/driver/postgres"
@@ -34,122 +43,325 @@ import (
 // @in header
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token, or just the token.
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-KEY
+// @description An API key created with POST /api-keys. Only accepted where listed.
 func main() {
-	// 0. Load Environment Variables
+	// 0. Load Configuration
+	// Defaults, then the YAML file, then the .env file, then the environment (see internal/config).
 	envFile := flag.String("env", ".env", "Path to environment file")
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "Path to YAML config file (optional)")
 	flag.Parse()
 
-	if err := godotenv.Load(*envFile); err != nil {
-		log.Printf("No %s file found, relying on environment variables", *envFile)
+	cfg, err := config.Load(*envFile, *configFile)
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
 
-	// 1. Setup Logger (Colorized)
-	// newLogger := logger.New(
-	// 	log.New(os.Stdout, "\r\n", log.LstdFlags),
-	// 	logger.Config{
-	// 		SlowThreshold:             time.Second,
-	// 		LogLevel:                  logger.Info,
-	// 		IgnoreRecordNotFoundError: true,
-	// 		ParameterizedQueries:      false,
-	// 		Colorful:                  true,
-	// 	},
-	// )
+	// 1. Setup Logger
+	// JSON lines on stdout, each carrying the request and user IDs of the request it was logged for.
+	logger := logging.New(os.Stdout, cfg.Log)
+	slog.SetDefault(logger)
 
-	// 2. Setup Database Connection
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("DATABASE_URL is not set")
+	// With TRACING_ENABLED, spans for each request, service call and query go to the OTLP collector at TRACING_ENDPOINT.
+	tracerProvider, flushSpans, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to set up tracing", err)
 	}
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		// Logger: newLogger,
+
+	// Prometheus metrics for requests, sign-ins and the database, served at METRICS_ADDR when METRICS_ENABLED.
+	appMetrics := metrics.New()
+
+	// 2. Setup Database Connection
+	db, err := gorm.Open(postgres.Open(cfg.Database.URL), &gorm.Config{
+		Logger:         logging.NewGormLogger(logger, cfg.Log),
+		TranslateError: true,
 	})
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		fatal("failed to connect to database", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("failed to access connection pool", err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
+	if err := db.Use(appMetrics.GormPlugin()); err != nil {
+		fatal("failed to set up query metrics", err)
+	}
+	appMetrics.RegisterDB(sqlDB, "postgres")
+	if err := db.Use(tracing.GormPlugin(tracerProvider)); err != nil {
+		fatal("failed to set up query tracing", err)
+	}
+
+	// 3. Auto Migrate (optional)
+	// The schema is owned by the versioned migrations in ./migrations (make migrate).
+	// AUTO_MIGRATE=true keeps GORM's AutoMigrate on boot for throwaway local databases.
+	if cfg.Database.AutoMigrate {
+		if err := db.AutoMigrate(&domain.User{}, &domain.Todo{}, &domain.RefreshToken{}, &domain.RevokedToken{}, &domain.APIKey{}, &domain.LoginAttempt{}, &domain.RateLimitCounter{}, &domain.OneTimeToken{}, &domain.TOTPCredential{}, &domain.RecoveryCode{}, &domain.Identity{}); err != nil {
+			fatal("failed to migrate database", err)
+		}
+		slog.Info("database migrated")
 	}
 
-	// 3. Auto Migrate
-	if err := db.AutoMigrate(&domain.Todo{}, &domain.User{}); err != nil {
-		log.Fatal("Failed to migrate database:", err)
+	// 4. Load Token Signing Keys
+	// Tokens are signed with JWT_SIGNING_KEY_FILE (RSA or Ed25519, PEM). Keys being rotated
+	// out stay in JWT_VERIFICATION_KEY_FILES until the tokens they signed have expired.
+	keys, err := token.LoadKeySet(cfg.Auth.Issuer, cfg.Auth.SigningKeyFile, cfg.Auth.VerificationKeyFiles...)
+	if err != nil {
+		fatal("failed to load JWT keys", err)
 	}
-	fmt.Println("Database migrated successfully.")
 
-	// 4. Dependency Injection
+	// 5. Dependency Injection
 	repo := repository.NewTodoRepository(db)
-	svc := service.NewTodoService(repo)
+	svc := tracing.TodoService(service.NewTodoService(repo), tracerProvider)
 	h := handler.NewTodoHandler(svc)
 
 	userRepo := repository.NewUserRepository(db)
-	userSvc := service.NewUserService(userRepo)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	// Revoked access tokens live in Postgres so every instance sees them.
+	// TOKEN_REVOCATION_STORE=memory suits a single local instance.
+	revocations := repository.NewRevokedTokenRepository(db)
+	if cfg.Auth.RevocationStore == config.StoreMemory {
+		revocations = repository.NewMemoryRevokedTokenStore()
+	}
+	// Failed logins are counted in Postgres too, so a lockout holds across instances.
+	loginAttempts := repository.NewLoginAttemptRepository(db)
+	if cfg.Auth.Login.AttemptStore == config.StoreMemory {
+		loginAttempts = repository.NewMemoryLoginAttemptStore()
+	}
+	// Account emails go through SMTP, or land in MAIL_OUTBOX_DIR as .eml files with MAIL_TRANSPORT=outbox.
+	var mail domain.Mailer = mailer.NewOutbox(cfg.Mail.From, cfg.Mail.OutboxDir)
+	if cfg.Mail.Transport == config.MailSMTP {
+		if mail, err = mailer.NewSMTP(cfg.Mail); err != nil {
+			fatal("failed to set up SMTP", err)
+		}
+	}
+	// New passwords are also checked against PASSWORD_BREACHED_LIST_FILE when one is set.
+	var breached domain.BreachedPasswordChecker
+	if cfg.Auth.Password.BreachedListFile != "" {
+		list, err := password.LoadBreachList(cfg.Auth.Password.BreachedListFile)
+		if err != nil {
+			fatal("failed to load breached password list", err)
+		}
+		breached = list
+	}
+	userSvc := service.NewUserService(service.UserDeps{
+		Users:         userRepo,
+		RefreshTokens: refreshTokenRepo,
+		Revocations:   revocations,
+		LoginAttempts: loginAttempts,
+		OneTimeTokens: repository.NewOneTimeTokenRepository(db),
+		MFA:           repository.NewMFARepository(db),
+		Identities:    repository.NewIdentityRepository(db),
+		Mailer:        mail,
+		Breached:      breached,
+		Hasher:        password.NewHasher(cfg.Auth.Password.Hash),
+		Keys:          keys,
+	}, cfg.Auth)
+	userSvc = appMetrics.InstrumentUserService(tracing.UserService(userSvc, tracerProvider))
+	jwksHandler := handler.NewJWKSHandler(keys)
 	userHandler := handler.NewUserHandler(userSvc)
+	adminHandler := handler.NewAdminHandler(userSvc)
+	accountHandler := handler.NewAccountHandler(userSvc)
+	apiKeySvc := service.NewAPIKeyService(repository.NewAPIKeyRepository(db))
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeySvc)
 
-	// 5. Setup Router
-	gin.ForceConsoleColor()
-	r := gin.Default()
-	// Fix "You trusted all proxies" warning
-	r.SetTrustedProxies(nil)
+	// Most routes take an access token or an API key; the account itself can only be managed signed in.
+	auth := middleware.AuthMiddleware(keys, revocations, apiKeySvc)
+	sessionAuth := middleware.AuthMiddleware(keys, revocations, nil)
+
+	// Rate limit counters are kept per instance by default; RATE_LIMIT_STORE=postgres shares them.
+	rateLimits := repository.NewMemoryRateLimitStore()
+	if cfg.RateLimit.Store == config.StorePostgres {
+		rateLimits = repository.NewRateLimitRepository(db)
+	}
+	// The public auth routes are limited per client IP, everything behind auth per user or API key.
+	authLimit := middleware.RateLimit(rateLimits, middleware.RateLimitPolicy{
+		Name: "auth", Limit: cfg.RateLimit.AuthRequests, Window: cfg.RateLimit.AuthWindow, Key: middleware.RateLimitByIP,
+	})
+	apiLimit := middleware.RateLimit(rateLimits, middleware.RateLimitPolicy{
+		Name: "api", Limit: cfg.RateLimit.APIRequests, Window: cfg.RateLimit.APIWindow, Key: middleware.RateLimitByClient,
+	})
+
+	// 6. Setup Router
+	r := gin.New()
+	// Every request gets an ID and a span first, so that whatever is logged for it carries both IDs.
+	r.Use(middleware.RequestID(), middleware.Tracing(tracerProvider), middleware.AccessLog(), middleware.Metrics(appMetrics), middleware.Recovery())
+	// ClientIP only believes X-Forwarded-For from these, as login throttling and rate limiting
+	// key on it: from anyone else the header could be anything.
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		fatal("failed to set trusted proxies", err)
+	}
 
 	// Swagger Route
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// Registered before the middleware below: a JWK Set must not be wrapped in the response envelope.
+	r.GET("/.well-known/jwks.json", jwksHandler.JWKS)
 
 	// Middleware
-	r.Use(middleware.ResponseInterceptor())
+	// ErrorHandler runs inside ResponseInterceptor so error bodies get the same envelope.
+	// Timeout comes after it, so a request that runs out of time is still answered.
+	routeTimeouts, _ := cfg.Server.RouteTimeoutMap() // checked when the config was loaded
+	r.Use(middleware.CORS(cfg.CORS), middleware.ResponseInterceptor(), middleware.ErrorHandler(), middleware.Timeout(cfg.Server.RequestTimeout, routeTimeouts))
 
-	// 5. Register Routes
+	// 7. Register Routes
 	// Auth Routes
-	r.POST("/signup", userHandler.SignUp)
-	r.POST("/login", userHandler.Login)
-	r.POST("/refresh-token", userHandler.RefreshToken)
+	authRoutes := r.Group("")
+	authRoutes.Use(authLimit)
+	{
+		authRoutes.POST("/signup", userHandler.SignUp)
+		authRoutes.POST("/login", userHandler.Login)
+		authRoutes.POST("/login/mfa", userHandler.LoginMFA)
+		authRoutes.POST("/refresh-token", userHandler.RefreshToken)
+		authRoutes.POST("/logout", userHandler.Logout)
+		authRoutes.POST("/verify-email", userHandler.VerifyEmail)
+		authRoutes.POST("/password/forgot", userHandler.ForgotPassword)
+		authRoutes.POST("/password/reset", userHandler.ResetPassword)
+		// Sign-in with an OpenID Connect provider, when OIDC_ISSUER names one (make fake-oidc runs one locally).
+		if cfg.Auth.OIDC.Enabled() {
+			oidcHandler := handler.NewOIDCHandler(userSvc, oidc.NewClient(cfg.Auth.OIDC), keys, cfg.Auth.OIDC)
+			authRoutes.GET("/auth/oidc/login", oidcHandler.Login)
+			authRoutes.GET("/auth/oidc/callback", oidcHandler.Callback)
+		}
+	}
+	r.POST("/logout-all", sessionAuth, apiLimit, userHandler.LogoutAll)
+
+	// Account Routes
+	accountRoutes := r.Group("/me")
+	accountRoutes.Use(sessionAuth, apiLimit)
+	{
+		accountRoutes.GET("", accountHandler.Get)
+		accountRoutes.PATCH("", accountHandler.Update)
+		accountRoutes.POST("/password", accountHandler.ChangePassword)
+		accountRoutes.DELETE("", accountHandler.Delete)
+		accountRoutes.POST("/mfa/totp", accountHandler.EnrollTOTP)
+		accountRoutes.POST("/mfa/totp/confirm", accountHandler.ConfirmTOTP)
+		accountRoutes.DELETE("/mfa", accountHandler.DisableMFA)
+	}
+
+	// API Key Routes
+	apiKeyRoutes := r.Group("/api-keys")
+	apiKeyRoutes.Use(sessionAuth, apiLimit)
+	{
+		apiKeyRoutes.POST("", apiKeyHandler.Create)
+		apiKeyRoutes.GET("", apiKeyHandler.List)
+		apiKeyRoutes.DELETE("/:id", apiKeyHandler.Revoke)
+	}
+
+	// Admin Routes
+	// Roles come from the access token; promote a user with cmd/admin (make promote EMAIL=...).
+	adminRoutes := r.Group("/admin")
+	adminRoutes.Use(sessionAuth, apiLimit, middleware.RequireRole(domain.RoleAdmin))
+	{
+		adminRoutes.GET("/users", middleware.RequirePermission(domain.PermissionListUsers), adminHandler.ListUsers)
+		adminRoutes.POST("/users/:id/impersonate", middleware.RequirePermission(domain.PermissionImpersonateUsers), adminHandler.Impersonate)
+	}
 
 	// Todo Routes (Protected)
 	todoRoutes := r.Group("/todos")
-	todoRoutes.Use(middleware.AuthMiddleware())
+	todoRoutes.Use(auth, apiLimit)
 	{
-		todoRoutes.POST("", h.Create)
-		todoRoutes.GET("", h.FindAll)
-		todoRoutes.GET("/:id", h.FindByID)
-		todoRoutes.PUT("/:id", h.Update)
-		todoRoutes.DELETE("/:id", h.Delete)
-		todoRoutes.DELETE("", h.DeleteAll)
+		read := middleware.RequireScope(domain.ScopeTodosRead)
+		write := middleware.RequireScope(domain.ScopeTodosWrite)
+		todoRoutes.POST("", write, h.Create)
+		todoRoutes.GET("", read, h.FindAll)
+		todoRoutes.GET("/:id", read, h.FindByID)
+		todoRoutes.PUT("/:id", write, h.Update)
+		todoRoutes.PATCH("/:id", write, h.Patch)
+		todoRoutes.DELETE("/:id", write, h.Delete)
+		todoRoutes.POST("/:id/restore", write, h.Restore)
+		todoRoutes.DELETE("", middleware.RequirePermission(domain.PermissionDeleteAllTodos), h.DeleteAll)
 	}
 
-	// 6. Start Server with Graceful Shutdown
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	// 8. Start Background Jobs
+	// Soft-deleted todos stay restorable for cfg.Todos.Retention before they are purged for good.
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go job.RunTodoPurge(jobCtx, svc, cfg.Todos.PurgeInterval, cfg.Todos.Retention)
+	go job.RunRefreshTokenPurge(jobCtx, refreshTokenRepo, cfg.Auth.RefreshTokenPurgeInterval)
+	go job.RunRevocationPurge(jobCtx, revocations, cfg.Auth.RevocationPurgeInterval)
 
+	// 9. Start Server with Graceful Shutdown
+	port := cfg.Server.Port
+	// Every request's context derives from baseCtx, so cancelling it aborts their queries.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: r,
+		Addr:         ":" + port,
+		Handler:      r,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		BaseContext:  func(net.Listener) context.Context { return baseCtx },
 	}
 
 	// Initializing the server in a goroutine so that
 	// it won't block the graceful shutdown handling below
-	log.Printf("Server starting on port %s", port)
-	log.Printf("Swagger documentation available at http://localhost:%s/swagger/index.html", port)
+	slog.Info("server starting", "port", port, "swagger", "http://localhost:"+port+"/swagger/index.html")
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
+			fatal("server failed", err)
 		}
 	}()
 
+	// The metrics get a listener of their own, so the API's port never exposes them.
+	var metricsSrv *http.Server
+	if cfg.Metrics.Enabled {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", appMetrics.Handler())
+		metricsSrv = &http.Server{Addr: cfg.Metrics.Addr, Handler: mux, ReadHeaderTimeout: cfg.Server.ReadTimeout}
+		slog.Info("metrics server starting", "addr", cfg.Metrics.Addr)
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("metrics server failed", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shutdown the server with
-	// a timeout of 5 seconds.
+	// a timeout of SERVER_SHUTDOWN_TIMEOUT (5 seconds by default).
 	quit := make(chan os.Signal, 1)
 	// kill (no param) default send syscall.SIGTERM
 	// kill -2 is syscall.SIGINT
 	// kill -9 is syscall.SIGKILL but can't be caught, so don't need to add it
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server")
+	stopJobs()
+	if metricsSrv != nil {
+		metricsSrv.Close()
+	}
 
-	// The context is used to inform the server it has 5 seconds to finish
+	// The context is used to inform the server how long it has to finish
 	// the request it is currently handling
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown: ", err)
+		// Cut short the requests still running, giving them a moment to
+		// cancel their queries in the database before the process exits.
+		cancelRequests()
+		grace, cancelGrace := context.WithTimeout(context.Background(), time.Second)
+		defer cancelGrace()
+		srv.Shutdown(grace)
+		fatal("server forced to shut down", err)
+	}
+
+	// Export the spans still waiting to go to the collector
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelFlush()
+	if err := flushSpans(flushCtx); err != nil {
+		slog.Warn("failed to export remaining spans", "error", err)
 	}
 
-	log.Println("Server exiting")
+	slog.Info("server exited")
+}
+
+// fatal logs err and exits, for failures the server can't run with
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
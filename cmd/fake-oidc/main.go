@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/prachaya-orr/relearn-golang/internal/oidc/oidctest"
+)
+
+const usage = `Usage: fake-oidc [-port=9000] [-client-id=todo-api] [-client-secret=secret] [-email=EMAIL]
+
+Runs a stand-in OpenID Connect provider for trying the sign-in locally.
+Everyone who is sent to it is signed in straight away as EMAIL. Point the
+API at it with:
+
+  OIDC_ISSUER=http://localhost:9000
+  OIDC_CLIENT_ID=todo-api
+  OIDC_CLIENT_SECRET=secret
+
+and open http://localhost:8080/auth/oidc/login in a browser.
+`
+
+func main() {
+	port := flag.String("port", "9000", "Port to listen on")
+	clientID := flag.String("client-id", "todo-api", "The only client ID accepted")
+	clientSecret := flag.String("client-secret", "secret", "The client's secret; empty accepts a public client")
+	email := flag.String("email", "fake-user@example.com", "Email of the user who signs in")
+	unverified := flag.Bool("unverified", false, "Say the email has not been verified")
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
+	issuer := "http://localhost:" + *port
+	provider, err := oidctest.NewProvider(issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatal("Failed to create the provider: ", err)
+	}
+	// The same email always gets the same subject, like one account at a real provider
+	sum := sha256.Sum256([]byte(*email))
+	provider.User = oidctest.User{Subject: hex.EncodeToString(sum[:8]), Email: *email, EmailVerified: !*unverified}
+
+	log.Printf("Fake OpenID Connect provider at %s, signing everyone in as %s", issuer, *email)
+	if err := http.ListenAndServe(":"+*port, provider); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -2,55 +2,135 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
 
-	"github.com/joho/godotenv"
-	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/migrate"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+const usage = `Usage: migrate [-env=.env] [-config=FILE] [-dir=migrations] ACTION [ARG]
+
+Actions:
+  status          List migrations and whether they are applied
+  up [N]          Apply the next N pending migrations (default: all)
+  down [N]        Roll back the last N applied migrations (default: 1)
+  goto VERSION    Migrate up or down to VERSION (0 rolls back everything)
+  reset           Roll back every migration, then apply them all again
+  create NAME     Write an empty NNNNNN_NAME.up.sql / .down.sql pair
+`
+
 func main() {
 	envFile := flag.String("env", ".env", "Path to environment file")
-	action := flag.String("action", "up", "Action: up, down, reset")
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "Path to YAML config file (optional)")
+	dir := flag.String("dir", "migrations", "Directory holding the migration files")
+	action := flag.String("action", "", "Action (same as the first argument; kept for older scripts)")
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
 	flag.Parse()
 
-	if err := godotenv.Load(*envFile); err != nil {
-		log.Printf("No %s file found, relying on environment variables", *envFile)
+	args := flag.Args()
+	if *action == "" && len(args) > 0 {
+		*action, args = args[0], args[1:]
+	}
+	if *action == "" {
+		*action = "up"
+	}
+	arg := ""
+	if len(args) > 0 {
+		arg = args[0]
 	}
 
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("DATABASE_URL is not set")
+	// create only touches the filesystem, so it doesn't need a database
+	if *action == "create" {
+		if arg == "" {
+			log.Fatal("create needs a migration NAME")
+		}
+		upPath, downPath, err := migrate.Create(*dir, arg)
+		if err != nil {
+			log.Fatal("Failed to create migration: ", err)
+		}
+		log.Printf("Created %s and %s", upPath, downPath)
+		return
 	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	dbConfig, err := config.LoadDatabase(*envFile, *configFile)
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	db, err := gorm.Open(postgres.Open(dbConfig.URL), &gorm.Config{})
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	migrations, err := migrate.Load(os.DirFS(*dir))
+	if err != nil {
+		log.Fatal("Failed to load migrations: ", err)
+	}
+	m := migrate.New(db, migrations)
+
 	switch *action {
-	case "down":
-		log.Println("Dropping tables...")
-		if err := db.Migrator().DropTable(&domain.Todo{}, &domain.User{}); err != nil {
-			log.Fatal("Failed to drop tables:", err)
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			log.Fatal("Failed to read migration status: ", err)
 		}
-		log.Println("Tables dropped.")
-	case "reset":
-		log.Println("Resetting database...")
-		if err := db.Migrator().DropTable(&domain.Todo{}, &domain.User{}); err != nil {
-			log.Fatal("Failed to drop tables:", err)
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-40s %s\n", s.Migration, state)
 		}
-		log.Println("Tables dropped.")
-		fallthrough
 	case "up":
-		log.Println("Migrating database...")
-		if err := db.AutoMigrate(&domain.User{}, &domain.Todo{}); err != nil {
-			log.Fatal("Failed to migrate database:", err)
+		report("Applied", must(m.Up(count(arg, 0))))
+	case "down":
+		report("Rolled back", must(m.Down(count(arg, 1))))
+	case "goto":
+		version, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || version < 0 {
+			log.Fatal("goto needs a VERSION number")
 		}
-		log.Println("Database migrated successfully.")
+		report("Migrated", must(m.Goto(version)))
+	case "reset":
+		log.Println("Resetting database...")
+		report("Rolled back", must(m.Down(0)))
+		report("Applied", must(m.Up(0)))
 	default:
-		log.Fatal("Invalid action. Use up, down, or reset.")
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// count parses the optional N argument
+func count(arg string, fallback int) int {
+	if arg == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 {
+		log.Fatalf("Invalid count %q: must be a positive number", arg)
+	}
+	return n
+}
+
+func must(migrations []migrate.Migration, err error) []migrate.Migration {
+	if err != nil {
+		log.Fatal("Migration failed: ", err)
+	}
+	return migrations
+}
+
+func report(verb string, migrations []migrate.Migration) {
+	if len(migrations) == 0 {
+		log.Println("Nothing to do.")
+		return
+	}
+	for _, migration := range migrations {
+		log.Printf("%s %s", verb, migration)
 	}
 }
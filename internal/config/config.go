@@ -0,0 +1,689 @@
+// Package config loads the application's settings into a typed struct.
+//
+// Values are layered, later sources winning: built-in defaults, an optional
+// YAML file, the .env file and finally the process environment. Every setting
+// has an environment variable, named in its env tag. Load validates the
+// result and reports every problem at once instead of stopping at the first.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.yaml.in/yaml/v3"
+)
+
+// Config holds every setting of the API server.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Todos     TodoConfig      `yaml:"todos"`
+	CORS      CORSConfig      `yaml:"cors"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Mail      MailConfig      `yaml:"mail"`
+	Log       LogConfig       `yaml:"log"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+}
+
+type ServerConfig struct {
+	Port            string        `yaml:"port" env:"PORT"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	// RequestTimeout is how long a request may run before its database
+	// queries are cancelled.
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"SERVER_REQUEST_TIMEOUT"`
+	// RouteTimeouts overrides RequestTimeout for single routes, with entries
+	// like "DELETE /todos=1m" naming the route as registered, e.g. "GET /todos/:id".
+	RouteTimeouts []string `yaml:"route_timeouts" env:"SERVER_ROUTE_TIMEOUTS"`
+	// TrustedProxies are the IPs or CIDRs whose X-Forwarded-For is believed.
+	// Empty means none: the client IP is the peer address, which login
+	// throttling and rate limiting rely on.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// RouteTimeoutMap parses RouteTimeouts into timeouts keyed by "METHOD /path"
+func (s ServerConfig) RouteTimeoutMap() (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration, len(s.RouteTimeouts))
+	for _, entry := range s.RouteTimeouts {
+		route, value, _ := strings.Cut(entry, "=")
+		method, path, _ := strings.Cut(strings.TrimSpace(route), " ")
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || timeout <= 0 || method == "" || method != strings.ToUpper(method) || !strings.HasPrefix(strings.TrimSpace(path), "/") {
+			return nil, fmt.Errorf("SERVER_ROUTE_TIMEOUTS entry %q must look like \"DELETE /todos=1m\"", entry)
+		}
+		timeouts[method+" "+strings.TrimSpace(path)] = timeout
+	}
+	return timeouts, nil
+}
+
+type DatabaseConfig struct {
+	URL             string        `yaml:"url" env:"DATABASE_URL"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	// AutoMigrate runs GORM's AutoMigrate on boot instead of the versioned migrations (local use only).
+	AutoMigrate bool `yaml:"auto_migrate" env:"AUTO_MIGRATE"`
+}
+
+type AuthConfig struct {
+	// Issuer names the API in the "iss" claim of its tokens, for services that verify them.
+	Issuer string `yaml:"issuer" env:"JWT_ISSUER"`
+	// SigningKeyFile is the PEM private key (RSA or Ed25519) tokens are signed with.
+	SigningKeyFile string `yaml:"signing_key_file" env:"JWT_SIGNING_KEY_FILE"`
+	// VerificationKeyFiles are keys being rotated out, still accepted until their tokens expire.
+	VerificationKeyFiles []string      `yaml:"verification_key_files" env:"JWT_VERIFICATION_KEY_FILES"`
+	AccessTokenTTL       time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL      time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+	// RefreshTokenPurgeInterval is how often the records of expired refresh tokens are deleted.
+	RefreshTokenPurgeInterval time.Duration `yaml:"refresh_token_purge_interval" env:"REFRESH_TOKEN_PURGE_INTERVAL"`
+	// RevocationStore is "postgres", shared by every instance, or "memory" for a single local instance.
+	RevocationStore string `yaml:"revocation_store" env:"TOKEN_REVOCATION_STORE"`
+	// RevocationPurgeInterval is how often revocations of expired access tokens are deleted.
+	RevocationPurgeInterval time.Duration  `yaml:"revocation_purge_interval" env:"TOKEN_REVOCATION_PURGE_INTERVAL"`
+	Login                   LoginConfig    `yaml:"login"`
+	Password                PasswordConfig `yaml:"password"`
+	MFA                     MFAConfig      `yaml:"mfa"`
+	OIDC                    OIDCConfig     `yaml:"oidc"`
+	// AppURL is the web app account emails link to, e.g. AppURL/verify-email?token=...
+	AppURL               string        `yaml:"app_url" env:"APP_URL"`
+	EmailVerificationTTL time.Duration `yaml:"email_verification_ttl" env:"EMAIL_VERIFICATION_TTL"`
+	PasswordResetTTL     time.Duration `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL"`
+}
+
+// LoginConfig throttles password guessing. Failed logins are counted per
+// email and per client IP. Past the free attempts every failure doubles the
+// wait before the next try, starting at BackoffBase; an email that reaches
+// LockoutThreshold is locked for LockoutDuration. A tally is forgotten once
+// its last failure is LockoutDuration old, or on a successful login.
+type LoginConfig struct {
+	FreeAttempts int `yaml:"free_attempts" env:"LOGIN_FREE_ATTEMPTS"`
+	// IPFreeAttempts is higher than FreeAttempts: many users can share an IP.
+	IPFreeAttempts   int           `yaml:"ip_free_attempts" env:"LOGIN_IP_FREE_ATTEMPTS"`
+	BackoffBase      time.Duration `yaml:"backoff_base" env:"LOGIN_BACKOFF_BASE"`
+	LockoutThreshold int           `yaml:"lockout_threshold" env:"LOGIN_LOCKOUT_THRESHOLD"`
+	LockoutDuration  time.Duration `yaml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION"`
+	// AttemptStore is "postgres", shared by every instance, or "memory" for a single local instance.
+	AttemptStore string `yaml:"attempt_store" env:"LOGIN_ATTEMPT_STORE"`
+}
+
+// PasswordConfig is the policy new passwords have to meet. Existing passwords
+// keep working when it is tightened; it applies from the next change.
+type PasswordConfig struct {
+	// MinLength counts characters, MaxLength bytes: bcrypt ignores everything
+	// past 72 bytes, so with bcrypt hashing MaxLength can't be more than that.
+	MinLength int `yaml:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	MaxLength int `yaml:"max_length" env:"PASSWORD_MAX_LENGTH"`
+	// MinCharClasses is how many of lowercase, uppercase, digits and symbols a password mixes.
+	MinCharClasses int `yaml:"min_char_classes" env:"PASSWORD_MIN_CHAR_CLASSES"`
+	// BreachedListFile lists breached passwords, one SHA-1 hash (HIBP format) or
+	// plain password per line. Empty skips the check.
+	BreachedListFile string             `yaml:"breached_list_file" env:"PASSWORD_BREACHED_LIST_FILE"`
+	Hash             PasswordHashConfig `yaml:"hash"`
+}
+
+// PasswordHashConfig is how passwords are hashed. A stored hash made with
+// another algorithm or weaker parameters still works, and is replaced at the
+// user's next login, when the password is at hand.
+type PasswordHashConfig struct {
+	// Algorithm is "argon2id" or "bcrypt".
+	Algorithm  string `yaml:"algorithm" env:"PASSWORD_HASH_ALGORITHM"`
+	BcryptCost int    `yaml:"bcrypt_cost" env:"PASSWORD_BCRYPT_COST"`
+	// Argon2Memory is in KiB; Argon2Iterations and Argon2Parallelism are
+	// Argon2's time and threads parameters.
+	Argon2Memory      int `yaml:"argon2_memory" env:"PASSWORD_ARGON2_MEMORY"`
+	Argon2Iterations  int `yaml:"argon2_iterations" env:"PASSWORD_ARGON2_ITERATIONS"`
+	Argon2Parallelism int `yaml:"argon2_parallelism" env:"PASSWORD_ARGON2_PARALLELISM"`
+}
+
+// MFAConfig is for two-factor authentication with TOTP authenticator apps.
+type MFAConfig struct {
+	// Issuer names the service in authenticator apps.
+	Issuer string `yaml:"issuer" env:"MFA_ISSUER"`
+	// TokenTTL is how long after the password the TOTP code may be given.
+	TokenTTL time.Duration `yaml:"token_ttl" env:"MFA_TOKEN_TTL"`
+}
+
+// OIDCConfig is for signing in with an external OpenID Connect provider,
+// with the authorization code flow and PKCE. An empty Issuer turns it off.
+type OIDCConfig struct {
+	// Provider names the provider in stored identities, e.g. "google". Changing
+	// it unlinks every identity signed in with so far.
+	Provider string `yaml:"provider" env:"OIDC_PROVIDER"`
+	// Issuer is the provider's issuer URL; its settings are discovered from
+	// Issuer/.well-known/openid-configuration.
+	Issuer       string `yaml:"issuer" env:"OIDC_ISSUER"`
+	ClientID     string `yaml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string `yaml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	// RedirectURL is this API's /auth/oidc/callback, as registered with the provider.
+	RedirectURL string   `yaml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	Scopes      []string `yaml:"scopes" env:"OIDC_SCOPES"`
+	// ReauthWindow is how long a sign-in with the provider stands in for the
+	// current password, for changing an account that has none.
+	ReauthWindow time.Duration `yaml:"reauth_window" env:"OIDC_REAUTH_WINDOW"`
+}
+
+// Enabled reports whether signing in with the provider is configured
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != ""
+}
+
+type TodoConfig struct {
+	// Retention is how long soft-deleted todos stay restorable before they are purged.
+	Retention     time.Duration `yaml:"retention" env:"TODO_RETENTION"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env:"TODO_PURGE_INTERVAL"`
+}
+
+type CORSConfig struct {
+	// AllowedOrigins lists the browser origins allowed to call the API; "*" allows any.
+	AllowedOrigins []string `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+}
+
+// RateLimitConfig limits how many requests a client makes per window, over a
+// sliding window. The public auth routes are counted per client IP, every
+// other route per user or API key. A limit of 0 turns it off.
+type RateLimitConfig struct {
+	AuthRequests int           `yaml:"auth_requests" env:"RATE_LIMIT_AUTH_REQUESTS"`
+	AuthWindow   time.Duration `yaml:"auth_window" env:"RATE_LIMIT_AUTH_WINDOW"`
+	APIRequests  int           `yaml:"api_requests" env:"RATE_LIMIT_API_REQUESTS"`
+	APIWindow    time.Duration `yaml:"api_window" env:"RATE_LIMIT_API_WINDOW"`
+	// Store is "memory", where each instance allows the full limit, or "postgres", shared by every instance.
+	Store string `yaml:"store" env:"RATE_LIMIT_STORE"`
+}
+
+// MailConfig is how account emails (verification, password reset) are delivered.
+type MailConfig struct {
+	// Transport is "smtp", or "outbox" to keep the emails, and write them to OutboxDir, instead of sending them.
+	Transport string `yaml:"transport" env:"MAIL_TRANSPORT"`
+	// From is the sender, e.g. "Todo App <no-reply@example.com>".
+	From         string `yaml:"from" env:"MAIL_FROM"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD"`
+	// OutboxDir is where the outbox writes .eml files; empty keeps them in memory only.
+	OutboxDir string `yaml:"outbox_dir" env:"MAIL_OUTBOX_DIR"`
+}
+
+// LogConfig is how the API logs: a line per request, plus whatever goes wrong.
+type LogConfig struct {
+	// Level is "debug", "info", "warn" or "error"; at "debug" every query is logged too.
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+	// Format is "json", or "text" for reading in a terminal.
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+	// SlowQueryThreshold is how long a query may take before it is logged as slow; 0 turns that off.
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" env:"LOG_SLOW_QUERY_THRESHOLD"`
+}
+
+// MetricsConfig is whether and where the API serves Prometheus metrics at /metrics.
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled" env:"METRICS_ENABLED"`
+	// Addr is the listener for /metrics, apart from the API's own port: the
+	// metrics name routes and error rates, so only the scraper should reach it.
+	Addr string `yaml:"addr" env:"METRICS_ADDR"`
+}
+
+// TracingConfig is where the API sends OpenTelemetry traces: a span per
+// request, with spans for the service calls and queries it made.
+type TracingConfig struct {
+	// Enabled exports the spans, with OTLP over HTTP; otherwise a caller's
+	// trace ID is still passed on, but nothing is recorded.
+	Enabled bool `yaml:"enabled" env:"TRACING_ENABLED"`
+	// Endpoint is the collector's OTLP/HTTP address, e.g. http://localhost:4318.
+	Endpoint string `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+	// ServiceName names the API in the traces.
+	ServiceName string `yaml:"service_name" env:"TRACING_SERVICE_NAME"`
+}
+
+// Log formats
+const (
+	LogJSON = "json"
+	LogText = "text"
+)
+
+// Mail transports
+const (
+	MailSMTP   = "smtp"
+	MailOutbox = "outbox"
+)
+
+// Password hashing algorithms
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+// Backends for the stores that can live in Postgres or in process memory
+const (
+	StorePostgres = "postgres"
+	StoreMemory   = "memory"
+)
+
+// Default returns the settings used where neither the YAML file nor the environment say otherwise.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:            "8080",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     time.Minute,
+			ShutdownTimeout: 5 * time.Second,
+			RequestTimeout:  10 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Auth: AuthConfig{
+			Issuer:                    "http://localhost:8080",
+			AccessTokenTTL:            15 * time.Minute,
+			RefreshTokenTTL:           7 * 24 * time.Hour,
+			RefreshTokenPurgeInterval: time.Hour,
+			RevocationStore:           StorePostgres,
+			RevocationPurgeInterval:   15 * time.Minute,
+			Login: LoginConfig{
+				FreeAttempts:     3,
+				IPFreeAttempts:   20,
+				BackoffBase:      time.Second,
+				LockoutThreshold: 10,
+				LockoutDuration:  15 * time.Minute,
+				AttemptStore:     StorePostgres,
+			},
+			Password: PasswordConfig{
+				MinLength:      10,
+				MaxLength:      72,
+				MinCharClasses: 2,
+				// OWASP's recommended Argon2id parameters
+				Hash: PasswordHashConfig{
+					Algorithm:         HashArgon2id,
+					BcryptCost:        12,
+					Argon2Memory:      19 * 1024,
+					Argon2Iterations:  2,
+					Argon2Parallelism: 1,
+				},
+			},
+			MFA: MFAConfig{
+				Issuer:   "Todo API",
+				TokenTTL: 5 * time.Minute,
+			},
+			OIDC: OIDCConfig{
+				Provider:     "oidc",
+				RedirectURL:  "http://localhost:8080/auth/oidc/callback",
+				Scopes:       []string{"openid", "email", "profile"},
+				ReauthWindow: 5 * time.Minute,
+			},
+			AppURL:               "http://localhost:3000",
+			EmailVerificationTTL: 48 * time.Hour,
+			PasswordResetTTL:     time.Hour,
+		},
+		Todos: TodoConfig{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			AuthRequests: 20,
+			AuthWindow:   time.Minute,
+			APIRequests:  300,
+			APIWindow:    time.Minute,
+			Store:        StoreMemory,
+		},
+		Mail: MailConfig{
+			Transport: MailOutbox,
+			From:      "no-reply@localhost",
+			SMTPPort:  587,
+			OutboxDir: "tmp/mail",
+		},
+		Log: LogConfig{
+			Level:              "info",
+			Format:             LogJSON,
+			SlowQueryThreshold: 200 * time.Millisecond,
+		},
+		Metrics: MetricsConfig{
+			Addr: "localhost:9090",
+		},
+		Tracing: TracingConfig{
+			Endpoint:    "http://localhost:4318",
+			ServiceName: "todo-api",
+		},
+	}
+}
+
+// Load reads the configuration and validates all of it. envFile may be
+// missing; configFile is optional, but has to exist when given.
+func Load(envFile, configFile string) (*Config, error) {
+	cfg, envErrs, err := load(envFile, configFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.Join(append(envErrs, cfg.Validate())...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadDatabase is Load for tools that only talk to the database, such as
+// cmd/migrate. Only the database settings are validated.
+func LoadDatabase(envFile, configFile string) (*DatabaseConfig, error) {
+	cfg, envErrs, err := load(envFile, configFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.Join(append(envErrs, cfg.Database.validate()...)...); err != nil {
+		return nil, err
+	}
+	return &cfg.Database, nil
+}
+
+// load layers the sources. Environment variables that fail to parse are
+// returned separately so they can be reported along with validation errors.
+func load(envFile, configFile string) (*Config, []error, error) {
+	cfg := Default()
+
+	if configFile != "" {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, nil, fmt.Errorf("parsing %s: %w", configFile, err)
+		}
+	}
+
+	// godotenv never overrides variables that are already set, so the real environment wins.
+	if envFile != "" {
+		if err := godotenv.Load(envFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, nil, fmt.Errorf("reading %s: %w", envFile, err)
+		}
+	}
+
+	return &cfg, applyEnv(&cfg), nil
+}
+
+// Validate checks every section and joins all problems into one error.
+func (c *Config) Validate() error {
+	var errs []error
+	errs = append(errs, c.Server.validate()...)
+	errs = append(errs, c.Database.validate()...)
+	errs = append(errs, c.Auth.validate()...)
+	errs = append(errs, c.Todos.validate()...)
+	errs = append(errs, c.CORS.validate()...)
+	errs = append(errs, c.RateLimit.validate()...)
+	errs = append(errs, c.Mail.validate()...)
+	errs = append(errs, c.Log.validate()...)
+	errs = append(errs, c.Metrics.validate()...)
+	errs = append(errs, c.Tracing.validate()...)
+	return errors.Join(errs...)
+}
+
+func (s ServerConfig) validate() []error {
+	var errs []error
+	if port, err := strconv.Atoi(s.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT %q is not a valid port", s.Port))
+	}
+	errs = append(errs, positive("SERVER_READ_TIMEOUT", s.ReadTimeout))
+	errs = append(errs, positive("SERVER_WRITE_TIMEOUT", s.WriteTimeout))
+	errs = append(errs, positive("SERVER_IDLE_TIMEOUT", s.IdleTimeout))
+	errs = append(errs, positive("SERVER_SHUTDOWN_TIMEOUT", s.ShutdownTimeout))
+	// Past the write timeout the connection is closed anyway
+	if s.RequestTimeout <= 0 || s.RequestTimeout > s.WriteTimeout {
+		errs = append(errs, errors.New("SERVER_REQUEST_TIMEOUT must be positive and no longer than SERVER_WRITE_TIMEOUT"))
+	}
+	timeouts, err := s.RouteTimeoutMap()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for route, timeout := range timeouts {
+		if timeout > s.WriteTimeout {
+			errs = append(errs, fmt.Errorf("SERVER_ROUTE_TIMEOUTS entry for %s must be no longer than SERVER_WRITE_TIMEOUT", route))
+		}
+	}
+	for _, proxy := range s.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			if _, err := netip.ParseAddr(proxy); err != nil {
+				errs = append(errs, fmt.Errorf("TRUSTED_PROXIES entry %q is not an IP or CIDR", proxy))
+			}
+		}
+	}
+	return errs
+}
+
+func (d DatabaseConfig) validate() []error {
+	var errs []error
+	if d.URL == "" {
+		errs = append(errs, errors.New("DATABASE_URL is not set"))
+	}
+	if d.MaxOpenConns < 0 {
+		errs = append(errs, errors.New("DB_MAX_OPEN_CONNS must not be negative"))
+	}
+	if d.MaxIdleConns < 0 || (d.MaxOpenConns > 0 && d.MaxIdleConns > d.MaxOpenConns) {
+		errs = append(errs, errors.New("DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS"))
+	}
+	if d.ConnMaxLifetime < 0 || d.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME must not be negative"))
+	}
+	return errs
+}
+
+func (a AuthConfig) validate() []error {
+	var errs []error
+	if a.Issuer == "" {
+		errs = append(errs, errors.New("JWT_ISSUER is not set"))
+	}
+	if a.SigningKeyFile == "" {
+		errs = append(errs, errors.New("JWT_SIGNING_KEY_FILE is not set (run make jwt-key)"))
+	}
+	errs = append(errs, positive("ACCESS_TOKEN_TTL", a.AccessTokenTTL))
+	if a.RefreshTokenTTL <= a.AccessTokenTTL {
+		errs = append(errs, errors.New("REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL"))
+	}
+	errs = append(errs, positive("REFRESH_TOKEN_PURGE_INTERVAL", a.RefreshTokenPurgeInterval))
+	errs = append(errs, store("TOKEN_REVOCATION_STORE", a.RevocationStore))
+	errs = append(errs, positive("TOKEN_REVOCATION_PURGE_INTERVAL", a.RevocationPurgeInterval))
+	errs = append(errs, a.Login.validate()...)
+	errs = append(errs, a.Password.validate()...)
+	if a.MFA.Issuer == "" || strings.Contains(a.MFA.Issuer, ":") {
+		errs = append(errs, errors.New("MFA_ISSUER must be set and must not contain a colon"))
+	}
+	errs = append(errs, positive("MFA_TOKEN_TTL", a.MFA.TokenTTL))
+	errs = append(errs, a.OIDC.validate()...)
+	if u, err := url.Parse(a.AppURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("APP_URL %q must look like https://app.example.com", a.AppURL))
+	}
+	errs = append(errs, positive("EMAIL_VERIFICATION_TTL", a.EmailVerificationTTL))
+	errs = append(errs, positive("PASSWORD_RESET_TTL", a.PasswordResetTTL))
+	return errs
+}
+
+func (l LoginConfig) validate() []error {
+	var errs []error
+	if l.FreeAttempts < 1 || l.IPFreeAttempts < l.FreeAttempts {
+		errs = append(errs, errors.New("LOGIN_FREE_ATTEMPTS must be at least 1 and LOGIN_IP_FREE_ATTEMPTS at least as many"))
+	}
+	if l.LockoutThreshold <= l.FreeAttempts {
+		errs = append(errs, errors.New("LOGIN_LOCKOUT_THRESHOLD must be more than LOGIN_FREE_ATTEMPTS"))
+	}
+	errs = append(errs, positive("LOGIN_BACKOFF_BASE", l.BackoffBase))
+	errs = append(errs, positive("LOGIN_LOCKOUT_DURATION", l.LockoutDuration))
+	errs = append(errs, store("LOGIN_ATTEMPT_STORE", l.AttemptStore))
+	return errs
+}
+
+func (p PasswordConfig) validate() []error {
+	var errs []error
+	maxLength := 1024
+	if p.Hash.Algorithm == HashBcrypt {
+		maxLength = 72
+	}
+	if p.MinLength < 1 || p.MaxLength < p.MinLength || p.MaxLength > maxLength {
+		errs = append(errs, fmt.Errorf("PASSWORD_MIN_LENGTH must be at least 1 and PASSWORD_MAX_LENGTH between it and %d", maxLength))
+	}
+	if p.MinCharClasses < 0 || p.MinCharClasses > 4 {
+		errs = append(errs, errors.New("PASSWORD_MIN_CHAR_CLASSES must be between 0 and 4"))
+	}
+	errs = append(errs, p.Hash.validate()...)
+	return errs
+}
+
+func (h PasswordHashConfig) validate() []error {
+	var errs []error
+	if h.Algorithm != HashArgon2id && h.Algorithm != HashBcrypt {
+		errs = append(errs, fmt.Errorf("PASSWORD_HASH_ALGORITHM %q must be %q or %q", h.Algorithm, HashArgon2id, HashBcrypt))
+	}
+	// 10 is bcrypt's default cost, 31 its maximum
+	if h.BcryptCost < 10 || h.BcryptCost > 31 {
+		errs = append(errs, errors.New("PASSWORD_BCRYPT_COST must be between 10 and 31"))
+	}
+	if h.Argon2Memory < 8*1024 || h.Argon2Iterations < 1 || h.Argon2Parallelism < 1 || h.Argon2Parallelism > 255 {
+		errs = append(errs, errors.New("PASSWORD_ARGON2_MEMORY must be at least 8192 (KiB), PASSWORD_ARGON2_ITERATIONS at least 1 and PASSWORD_ARGON2_PARALLELISM between 1 and 255"))
+	}
+	return errs
+}
+
+func (o OIDCConfig) validate() []error {
+	if !o.Enabled() {
+		return nil
+	}
+	var errs []error
+	if u, err := url.Parse(o.Issuer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("OIDC_ISSUER %q must look like https://accounts.example.com", o.Issuer))
+	}
+	if o.Provider == "" || o.ClientID == "" {
+		errs = append(errs, errors.New("OIDC_PROVIDER and OIDC_CLIENT_ID must be set when OIDC_ISSUER is"))
+	}
+	if u, err := url.Parse(o.RedirectURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("OIDC_REDIRECT_URL %q must look like https://api.example.com/auth/oidc/callback", o.RedirectURL))
+	}
+	if !slices.Contains(o.Scopes, "openid") {
+		errs = append(errs, errors.New("OIDC_SCOPES must include openid"))
+	}
+	errs = append(errs, positive("OIDC_REAUTH_WINDOW", o.ReauthWindow))
+	return errs
+}
+
+func (t TodoConfig) validate() []error {
+	return []error{
+		positive("TODO_RETENTION", t.Retention),
+		positive("TODO_PURGE_INTERVAL", t.PurgeInterval),
+	}
+}
+
+func (c CORSConfig) validate() []error {
+	var errs []error
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			errs = append(errs, fmt.Errorf("CORS_ALLOWED_ORIGINS entry %q must look like https://example.com", origin))
+		}
+	}
+	return errs
+}
+
+func (r RateLimitConfig) validate() []error {
+	var errs []error
+	if r.AuthRequests < 0 || r.APIRequests < 0 {
+		errs = append(errs, errors.New("RATE_LIMIT_AUTH_REQUESTS and RATE_LIMIT_API_REQUESTS must not be negative"))
+	}
+	if r.AuthRequests > 0 {
+		errs = append(errs, positive("RATE_LIMIT_AUTH_WINDOW", r.AuthWindow))
+	}
+	if r.APIRequests > 0 {
+		errs = append(errs, positive("RATE_LIMIT_API_WINDOW", r.APIWindow))
+	}
+	errs = append(errs, store("RATE_LIMIT_STORE", r.Store))
+	return errs
+}
+
+func (m MailConfig) validate() []error {
+	var errs []error
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		errs = append(errs, fmt.Errorf("MAIL_FROM %q is not an email address", m.From))
+	}
+	switch m.Transport {
+	case MailOutbox:
+	case MailSMTP:
+		if m.SMTPHost == "" {
+			errs = append(errs, errors.New("SMTP_HOST is not set (or use MAIL_TRANSPORT=outbox)"))
+		}
+		if m.SMTPPort < 1 || m.SMTPPort > 65535 {
+			errs = append(errs, fmt.Errorf("SMTP_PORT %d is not a valid port", m.SMTPPort))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("MAIL_TRANSPORT %q must be %q or %q", m.Transport, MailSMTP, MailOutbox))
+	}
+	return errs
+}
+
+func (l LogConfig) validate() []error {
+	var errs []error
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL %q must be debug, info, warn or error", l.Level))
+	}
+	if l.Format != LogJSON && l.Format != LogText {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT %q must be %q or %q", l.Format, LogJSON, LogText))
+	}
+	if l.SlowQueryThreshold < 0 {
+		errs = append(errs, errors.New("LOG_SLOW_QUERY_THRESHOLD must not be negative"))
+	}
+	return errs
+}
+
+func (m MetricsConfig) validate() []error {
+	if !m.Enabled {
+		return nil
+	}
+	if _, port, err := net.SplitHostPort(m.Addr); err != nil || port == "" {
+		return []error{fmt.Errorf("METRICS_ADDR %q must look like localhost:9090", m.Addr)}
+	}
+	return nil
+}
+
+func (t TracingConfig) validate() []error {
+	if !t.Enabled {
+		return nil
+	}
+	var errs []error
+	if u, err := url.Parse(t.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("TRACING_ENDPOINT %q must look like http://localhost:4318", t.Endpoint))
+	}
+	if t.ServiceName == "" {
+		errs = append(errs, errors.New("TRACING_SERVICE_NAME must be set"))
+	}
+	return errs
+}
+
+// store returns an error unless value names a store backend
+func store(name, value string) error {
+	if value != StorePostgres && value != StoreMemory {
+		return fmt.Errorf("%s %q must be %q or %q", name, value, StorePostgres, StoreMemory)
+	}
+	return nil
+}
+
+// positive returns an error unless d > 0; nil entries are dropped by errors.Join.
+func positive(name string, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("%s must be a positive duration like 15m", name)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("Sources In Order", func(t *testing.T) {
+		yamlFile := writeFile(t, "config.yaml", `
+server:
+  port: "9000"
+  read_timeout: 3s
+database:
+  url: postgres://from-yaml
+  max_open_conns: 50
+auth:
+  signing_key_file: keys/yaml.pem
+  access_token_ttl: 5m
+cors:
+  allowed_origins: ["https://app.example.com"]
+`)
+		envFile := writeFile(t, ".env", "PORT=9100\nJWT_SIGNING_KEY_FILE=keys/dotenv.pem\n")
+		t.Setenv("PORT", "9200")
+		t.Setenv("JWT_VERIFICATION_KEY_FILES", "keys/old.pem, keys/older.pem")
+		t.Setenv("AUTO_MIGRATE", "true")
+		// godotenv sets what it loads in the process environment; undo that afterwards
+		t.Setenv("JWT_SIGNING_KEY_FILE", "")
+		os.Unsetenv("JWT_SIGNING_KEY_FILE")
+
+		cfg, err := Load(envFile, yamlFile)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if cfg.Server.Port != "9200" {
+			t.Errorf("expected the environment to win, got port %s", cfg.Server.Port)
+		}
+		if cfg.Auth.SigningKeyFile != "keys/dotenv.pem" {
+			t.Errorf("expected .env to override YAML, got %s", cfg.Auth.SigningKeyFile)
+		}
+		if cfg.Database.URL != "postgres://from-yaml" || cfg.Database.MaxOpenConns != 50 || cfg.Server.ReadTimeout != 3*time.Second {
+			t.Errorf("expected YAML values, got %+v %+v", cfg.Database, cfg.Server)
+		}
+		if cfg.Auth.AccessTokenTTL != 5*time.Minute || cfg.Auth.RefreshTokenTTL != Default().Auth.RefreshTokenTTL {
+			t.Errorf("expected YAML access TTL and default refresh TTL, got %s and %s", cfg.Auth.AccessTokenTTL, cfg.Auth.RefreshTokenTTL)
+		}
+		if len(cfg.Auth.VerificationKeyFiles) != 2 || cfg.Auth.VerificationKeyFiles[1] != "keys/older.pem" {
+			t.Errorf("expected a comma-separated list, got %q", cfg.Auth.VerificationKeyFiles)
+		}
+		if !cfg.Database.AutoMigrate {
+			t.Error("expected AUTO_MIGRATE to be read")
+		}
+	})
+
+	t.Run("Errors Are Aggregated", func(t *testing.T) {
+		t.Setenv("DATABASE_URL", "")
+		t.Setenv("JWT_SIGNING_KEY_FILE", "")
+		t.Setenv("ACCESS_TOKEN_TTL", "soon")
+		t.Setenv("DB_MAX_OPEN_CONNS", "lots")
+
+		_, err := Load("", "")
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		for _, want := range []string{"ACCESS_TOKEN_TTL", "DB_MAX_OPEN_CONNS"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("expected %s to be reported, got:\n%v", want, err)
+			}
+		}
+	})
+
+	t.Run("Missing Config File", func(t *testing.T) {
+		if _, err := Load("", filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+			t.Error("expected an error for a config file that does not exist")
+		}
+	})
+
+	t.Run("Database Only", func(t *testing.T) {
+		t.Setenv("DATABASE_URL", "postgres://db")
+		t.Setenv("JWT_SIGNING_KEY_FILE", "")
+
+		db, err := LoadDatabase("", "")
+		if err != nil {
+			t.Fatalf("expected auth settings to be ignored, got %v", err)
+		}
+		if db.URL != "postgres://db" {
+			t.Errorf("expected DATABASE_URL, got %s", db.URL)
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	valid := Default()
+	valid.Database.URL = "postgres://db"
+	valid.Auth.SigningKeyFile = "keys/jwt.pem"
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected defaults plus required settings to be valid, got %v", err)
+	}
+
+	cfg := valid
+	cfg.Server.Port = "http"
+	cfg.Server.RouteTimeouts = []string{"GET /todos=1m", "/todos=5s"}
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "proxy.internal"}
+	cfg.Database.URL = ""
+	cfg.Database.MaxIdleConns = 100
+	cfg.Auth.SigningKeyFile = ""
+	cfg.Auth.RefreshTokenTTL = time.Minute
+	cfg.Auth.RevocationStore = "redis"
+	cfg.Auth.Login.LockoutThreshold = 2
+	cfg.Auth.Password.Hash.Algorithm = "md5"
+	cfg.Auth.OIDC.Issuer = "https://accounts.example.com" // without a client ID
+	cfg.Todos.PurgeInterval = 0
+	cfg.CORS.AllowedOrigins = []string{"https://app.example.com", "app.example.com"}
+	cfg.Log.Format = "xml"
+	cfg.Metrics.Enabled = true
+	cfg.Metrics.Addr = "9090"
+	cfg.Tracing.Enabled = true
+	cfg.Tracing.Endpoint = "localhost:4318"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 16 {
+		t.Errorf("expected every problem on its own line, got %d:\n%v", len(lines), err)
+	}
+}
+
+func TestRouteTimeoutMap(t *testing.T) {
+	server := Default().Server
+	server.RouteTimeouts = []string{"DELETE /todos=20s", " GET /todos/:id = 2s "}
+	timeouts, err := server.RouteTimeoutMap()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if timeouts["DELETE /todos"] != 20*time.Second || timeouts["GET /todos/:id"] != 2*time.Second || len(timeouts) != 2 {
+		t.Errorf("expected both routes, got %v", timeouts)
+	}
+
+	for _, entry := range []string{"DELETE /todos", "delete /todos=1s", "DELETE todos=1s", "DELETE /todos=-1s"} {
+		server.RouteTimeouts = []string{entry}
+		if _, err := server.RouteTimeoutMap(); err == nil {
+			t.Errorf("expected %q to be refused", entry)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidAPIKey is returned for an unknown, revoked or expired API key alike.
+	ErrInvalidAPIKey = NewUnauthorizedError("invalid_api_key", "invalid or expired API key")
+	// ErrAPIKeyNotFound is returned when an API key does not exist or is owned by another user.
+	ErrAPIKeyNotFound = NewNotFoundError("api_key_not_found", "API key not found")
+	// ErrInvalidAPIKeyID is returned when an API key ID is not a valid UUID.
+	ErrInvalidAPIKeyID = NewBadRequestError("invalid_id", "invalid id format")
+	// ErrInvalidAPIKeyScope is returned when creating a key with no scopes or an unknown one.
+	ErrInvalidAPIKeyScope = NewValidationError("invalid_scope", "invalid API key scope")
+	// ErrAPIKeyExpiryInPast is returned when creating a key that would already be expired.
+	ErrAPIKeyExpiryInPast = NewValidationError("invalid_expiry", "expires_at must be in the future")
+	// ErrAPIKeyNameRequired is returned when creating a key without a name.
+	ErrAPIKeyNameRequired = NewValidationError("name_required", "name is required")
+)
+
+// Scope limits what an API key may do. Access tokens are not scoped: a signed
+// in user can do everything their role allows.
+type Scope string
+
+const (
+	ScopeTodosRead  Scope = "todos:read"
+	ScopeTodosWrite Scope = "todos:write"
+)
+
+// APIKeyScopes lists every scope a key can be granted.
+var APIKeyScopes = []Scope{ScopeTodosRead, ScopeTodosWrite}
+
+// Scopes is stored as a space-separated list, like an OAuth scope parameter.
+type Scopes []Scope
+
+// Has reports whether scope is in the list.
+func (s Scopes) Has(scope Scope) bool {
+	for _, granted := range s {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Scopes) Value() (driver.Value, error) {
+	parts := make([]string, len(s))
+	for i, scope := range s {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+func (s *Scopes) Scan(value any) error {
+	var str string
+	switch v := value.(type) {
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Scopes", value)
+	}
+	*s = nil
+	for _, scope := range strings.Fields(str) {
+		*s = append(*s, Scope(scope))
+	}
+	return nil
+}
+
+// APIKey lets a machine client act as its owner without signing in. Only a
+// hash of the key is stored; the key itself is shown once, when it is created.
+type APIKey struct {
+	ID     uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
+	Name   string    `gorm:"not null" json:"name" example:"CI bot"`
+	// Prefix is the start of the key, so users can tell their keys apart.
+	Prefix     string     `gorm:"not null" json:"prefix" example:"tk_Xy3kP9aQ"`
+	KeyHash    string     `gorm:"uniqueIndex;not null" json:"-"`
+	Scopes     Scopes     `gorm:"type:text;not null" json:"scopes" swaggertype:"array,string" example:"todos:read,todos:write"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatedAPIKey is returned once, on creation: the only time Key is available.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key" example:"tk_Xy3kP9aQ..."`
+}
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *APIKey) error
+	// FindByHash returns nil, nil when no key has that hash.
+	FindByHash(ctx context.Context, keyHash string) (*APIKey, error)
+	// FindByUser lists the user's keys that have not been revoked, newest first.
+	FindByUser(ctx context.Context, userID uuid.UUID) ([]APIKey, error)
+	// Revoke returns ErrAPIKeyNotFound unless the user owns an unrevoked key with that ID.
+	Revoke(ctx context.Context, id, userID uuid.UUID) error
+	Touch(ctx context.Context, id uuid.UUID, usedAt time.Time) error
+}
+
+type APIKeyService interface {
+	// Create generates a key. expiresAt is optional; keys without one last until revoked.
+	Create(ctx context.Context, userID uuid.UUID, name string, scopes []Scope, expiresAt *time.Time) (*CreatedAPIKey, error)
+	List(ctx context.Context, userID uuid.UUID) ([]APIKey, error)
+	Revoke(ctx context.Context, id, userID uuid.UUID) error
+	// Authenticate resolves a key presented by a client to its stored record,
+	// or returns ErrInvalidAPIKey.
+	Authenticate(ctx context.Context, key string) (*APIKey, error)
+}
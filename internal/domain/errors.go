@@ -0,0 +1,139 @@
+package domain
+
+import "time"
+
+// ErrorKind classifies a domain error so transports can map it to a status code.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindBadRequest
+	KindValidation
+	KindNotFound
+	KindConflict
+	KindUnauthorized
+	KindPreconditionFailed
+	KindForbidden
+	KindTooManyRequests
+	KindLocked
+)
+
+// Error is a domain error carrying its kind and a machine-readable code.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is lets errors.Is match on the kind sentinels below (which have no code)
+// as well as on specific errors with the same kind and code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return t.Kind == e.Kind && (t.Code == "" || t.Code == e.Code)
+}
+
+// Kind sentinels, e.g. errors.Is(err, domain.ErrNotFound) holds for ErrTodoNotFound.
+var (
+	ErrBadRequest         = &Error{Kind: KindBadRequest, Message: "bad request"}
+	ErrValidation         = &Error{Kind: KindValidation, Message: "validation failed"}
+	ErrNotFound           = &Error{Kind: KindNotFound, Message: "not found"}
+	ErrConflict           = &Error{Kind: KindConflict, Message: "conflict"}
+	ErrUnauthorized       = &Error{Kind: KindUnauthorized, Message: "unauthorized"}
+	ErrPreconditionFailed = &Error{Kind: KindPreconditionFailed, Message: "precondition failed"}
+	ErrForbidden          = &Error{Kind: KindForbidden, Message: "forbidden"}
+	ErrTooManyRequests    = &Error{Kind: KindTooManyRequests, Message: "too many requests"}
+	ErrLocked             = &Error{Kind: KindLocked, Message: "locked"}
+)
+
+// NewBadRequestError reports input that could not be parsed at all.
+func NewBadRequestError(code, message string) *Error {
+	return &Error{Kind: KindBadRequest, Code: code, Message: message}
+}
+
+// NewValidationError reports well-formed input that breaks a business rule.
+func NewValidationError(code, message string) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message}
+}
+
+// NewNotFoundError reports a missing (or invisible to the caller) resource.
+func NewNotFoundError(code, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+// NewConflictError reports a clash with the current state, such as a duplicate.
+func NewConflictError(code, message string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+// NewUnauthorizedError reports missing or invalid credentials.
+func NewUnauthorizedError(code, message string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+// NewPreconditionFailedError reports that the caller's view of a resource is stale.
+func NewPreconditionFailedError(code, message string) *Error {
+	return &Error{Kind: KindPreconditionFailed, Code: code, Message: message}
+}
+
+// NewForbiddenError reports an authenticated caller that isn't allowed to do something.
+func NewForbiddenError(code, message string) *Error {
+	return &Error{Kind: KindForbidden, Code: code, Message: message}
+}
+
+// NewTooManyRequestsError reports a caller that has to slow down.
+func NewTooManyRequestsError(code, message string) *Error {
+	return &Error{Kind: KindTooManyRequests, Code: code, Message: message}
+}
+
+// NewLockedError reports a resource that is temporarily unavailable, such as a locked account.
+func NewLockedError(code, message string) *Error {
+	return &Error{Kind: KindLocked, Code: code, Message: message}
+}
+
+// RetryAfterError is an error that clears by itself after a while, such as a
+// lockout. Transports tell the caller when to retry (HTTP: Retry-After).
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+// NewRetryAfterError wraps err with the time after which retrying may succeed.
+func NewRetryAfterError(err error, after time.Duration) *RetryAfterError {
+	return &RetryAfterError{Err: err, After: after}
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// ViolationsError lists the rules each input field broke, such as
+// {"password": ["min_length", "char_classes"]}, so clients can point at them.
+// Transports render them next to the wrapped error (HTTP: violations).
+type ViolationsError struct {
+	Err        error
+	Violations map[string][]string
+}
+
+// NewViolationsError wraps err with the rules broken per field.
+func NewViolationsError(err error, violations map[string][]string) *ViolationsError {
+	return &ViolationsError{Err: err, Violations: violations}
+}
+
+func (e *ViolationsError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ViolationsError) Unwrap() error {
+	return e.Err
+}
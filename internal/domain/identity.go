@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidOIDCState is returned when the provider redirects back to a browser that didn't start the sign-in, or too late.
+	ErrInvalidOIDCState = NewBadRequestError("invalid_oidc_state", "sign-in expired or was started elsewhere, start again")
+	// ErrOIDCLoginFailed is returned when the identity provider refuses the sign-in or its answer doesn't check out.
+	ErrOIDCLoginFailed = NewUnauthorizedError("oidc_login_failed", "sign-in with the identity provider failed")
+	// ErrExternalEmailNotVerified is returned for a new identity whose email the provider hasn't verified.
+	ErrExternalEmailNotVerified = NewForbiddenError("external_email_not_verified", "the identity provider has not verified the email address")
+	// ErrReauthenticationRequired is returned when an account without a password is changed without a recent sign-in with the identity provider.
+	ErrReauthenticationRequired = NewForbiddenError("reauthentication_required", "the account has no password: sign in with the identity provider again, then retry")
+)
+
+// Identity links a user to their account at an external identity provider.
+// A user can have several; each provider account belongs to one user.
+type Identity struct {
+	ID     uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+	// Provider and Subject name the account at the provider, for good: the
+	// email there can change, the subject never does.
+	Provider string `gorm:"not null;uniqueIndex:idx_identities_provider_subject"`
+	Subject  string `gorm:"not null;uniqueIndex:idx_identities_provider_subject"`
+	// LastSignInAt is when the user last signed in with the provider account.
+	LastSignInAt *time.Time
+	CreatedAt    time.Time
+}
+
+// ExternalIdentity is who an identity provider says signed in.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+type IdentityRepository interface {
+	// FindByProviderSubject returns nil, nil when the account isn't linked to any user.
+	FindByProviderSubject(ctx context.Context, provider, subject string) (*Identity, error)
+	// Create links the identity to its user.
+	Create(ctx context.Context, identity *Identity) error
+	// CreateUser creates user and links identity to them, together or not at
+	// all. It returns ErrEmailTaken when the email already has an account.
+	CreateUser(ctx context.Context, user *User, identity *Identity) error
+	// MarkSignedIn records a sign-in with the identity at the given time.
+	MarkSignedIn(ctx context.Context, id uuid.UUID, at time.Time) error
+	// LastSignInAt returns when the user last signed in with any of their
+	// identities, or nil when they never have.
+	LastSignInAt(ctx context.Context, userID uuid.UUID) (*time.Time, error)
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+var (
+	// ErrTooManyLoginAttempts is returned while an email or client IP has to wait before trying again.
+	ErrTooManyLoginAttempts = NewTooManyRequestsError("too_many_login_attempts", "too many failed login attempts, try again later")
+	// ErrAccountLocked is returned while an email is locked out after too many failed logins.
+	ErrAccountLocked = NewLockedError("account_locked", "account temporarily locked after too many failed login attempts")
+)
+
+// LoginAttempt tallies the recent failed logins for one key: an email or a
+// client IP. Keys are prefixed ("email:", "ip:") so the two never collide.
+type LoginAttempt struct {
+	Key          string    `gorm:"primaryKey"`
+	Failures     int       `gorm:"not null"`
+	LastFailedAt time.Time `gorm:"not null;index"`
+}
+
+// LoginAttemptStore keeps failed login tallies. Stores may forget a tally
+// once its last failure is older than the reset window.
+type LoginAttemptStore interface {
+	// Get returns nil, nil when key has no recorded failures.
+	Get(ctx context.Context, key string) (*LoginAttempt, error)
+	// RecordFailure counts a failure at `at` and returns the new tally. A tally
+	// whose last failure was before resetBefore starts over from one.
+	RecordFailure(ctx context.Context, key string, at, resetBefore time.Time) (*LoginAttempt, error)
+	// Reset forgets key's failures, after a successful login.
+	Reset(ctx context.Context, key string) error
+}
@@ -0,0 +1,13 @@
+package domain
+
+// MailMessage is a plain text email to one recipient.
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails, see internal/mailer for the implementations.
+type Mailer interface {
+	Send(msg MailMessage) error
+}
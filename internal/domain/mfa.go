@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidMFAToken is returned for an MFA token that is malformed, expired or already exchanged.
+	ErrInvalidMFAToken = NewUnauthorizedError("invalid_mfa_token", "MFA token is invalid or expired")
+	// ErrInvalidMFACode is returned for a wrong, expired or already used TOTP or recovery code.
+	ErrInvalidMFACode = NewUnauthorizedError("invalid_mfa_code", "authentication code is invalid")
+	// ErrMFAAlreadyEnabled is returned when enrolling while two-factor authentication is on.
+	ErrMFAAlreadyEnabled = NewConflictError("mfa_already_enabled", "two-factor authentication is already enabled")
+	// ErrMFANotEnrolled is returned when confirming before enrolling, or disabling what isn't on.
+	ErrMFANotEnrolled = NewConflictError("mfa_not_enrolled", "two-factor authentication is not set up")
+)
+
+// TOTPCredential is a user's authenticator app secret. It only guards the
+// login once ConfirmedAt is set, after the user has proven the app works.
+type TOTPCredential struct {
+	UserID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	// Secret is kept in the clear: verifying a code needs it.
+	Secret      string `gorm:"not null"`
+	ConfirmedAt *time.Time
+	// LastUsedStep is the time step of the last accepted code, which can't be used again.
+	LastUsedStep int64 `gorm:"not null;default:0"`
+	CreatedAt    time.Time
+}
+
+// RecoveryCode is a single-use code that stands in for a TOTP code when the
+// authenticator app is lost. Only a hash of the code is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	CodeHash  string    `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// TOTPEnrollment is what an authenticator app needs to start producing codes.
+type TOTPEnrollment struct {
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	// ProvisioningURI is the otpauth:// URI, usually shown as a QR code.
+	ProvisioningURI string `json:"provisioning_uri" example:"otpauth://totp/Todo%20API:test@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Todo+API"`
+}
+
+type MFARepository interface {
+	// FindTOTP returns nil, nil when the user has no TOTP credential.
+	FindTOTP(ctx context.Context, userID uuid.UUID) (*TOTPCredential, error)
+	// SaveTOTP stores a new, unconfirmed credential in place of any previous one.
+	SaveTOTP(ctx context.Context, credential *TOTPCredential) error
+	// ConfirmTOTP turns the credential on and stores the recovery codes, replacing any earlier ones.
+	ConfirmTOTP(ctx context.Context, userID uuid.UUID, at time.Time, step int64, codeHashes []string) error
+	// UseTOTPStep records step as used. It returns ErrInvalidMFACode unless
+	// step is later than the last one used, so a code works only once.
+	UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error
+	// UseRecoveryCode uses up the user's unused code with that hash, or returns ErrInvalidMFACode.
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, at time.Time) error
+	// Delete removes the credential and recovery codes, turning two-factor authentication off.
+	Delete(ctx context.Context, userID uuid.UUID) error
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidOneTimeToken is returned for an email verification or password
+// reset token that is unknown, expired, already used or meant for the other flow.
+var ErrInvalidOneTimeToken = NewBadRequestError("invalid_one_time_token", "token is invalid, expired or already used")
+
+// TokenPurpose is the flow a one-time token belongs to
+type TokenPurpose string
+
+const (
+	TokenPurposeVerifyEmail   TokenPurpose = "verify_email"
+	TokenPurposeResetPassword TokenPurpose = "reset_password"
+	TokenPurposeChangeEmail   TokenPurpose = "change_email"
+)
+
+// OneTimeToken is the server-side record of a token mailed to a user. Only a
+// hash of the token is stored; the token itself only ever exists in the email.
+type OneTimeToken struct {
+	ID        uuid.UUID    `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID    uuid.UUID    `gorm:"type:uuid;not null;index"`
+	Purpose   TokenPurpose `gorm:"not null"`
+	TokenHash string       `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time    `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type OneTimeTokenRepository interface {
+	Create(ctx context.Context, token *OneTimeToken) error
+	// FindByHash returns nil, nil when no token has the given hash.
+	FindByHash(ctx context.Context, tokenHash string) (*OneTimeToken, error)
+	// MarkUsed flags an unused token as used. It returns ErrInvalidOneTimeToken
+	// when the token was used already, so a token can only be redeemed once.
+	MarkUsed(ctx context.Context, id uuid.UUID) error
+	// InvalidateForUser marks the user's unused tokens for purpose as used, so
+	// that only the most recently mailed link works.
+	InvalidateForUser(ctx context.Context, userID uuid.UUID, purpose TokenPurpose) error
+}
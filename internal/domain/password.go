@@ -0,0 +1,30 @@
+package domain
+
+// ErrWeakPassword is returned, wrapped in a ViolationsError, for a password
+// that breaks the password policy or is known to have been breached.
+var ErrWeakPassword = NewValidationError("weak_password", "password does not meet the password policy")
+
+// Password policy rules, as listed under "password" in a ViolationsError
+const (
+	PasswordMinLength   = "min_length"
+	PasswordMaxLength   = "max_length"
+	PasswordCharClasses = "char_classes"
+	PasswordIsEmail     = "not_email"
+	PasswordBreached    = "breached"
+)
+
+// BreachedPasswordChecker tells whether a password is known from data breaches.
+type BreachedPasswordChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// PasswordHasher hashes passwords into self-describing strings, which carry
+// their algorithm, parameters and salt (PHC string format, or bcrypt's own).
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded.
+	Verify(encoded, password string) (bool, error)
+	// NeedsRehash reports whether encoded was made with another algorithm or
+	// parameters than Hash uses now, and should be replaced.
+	NeedsRehash(encoded string) bool
+}
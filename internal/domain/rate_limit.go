@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ErrRateLimited is returned when a client has used up its requests for now.
+var ErrRateLimited = NewTooManyRequestsError("rate_limited", "rate limit exceeded")
+
+// RateLimitCounter counts the requests of one client in one fixed window.
+type RateLimitCounter struct {
+	Key         string    `gorm:"primaryKey"`
+	WindowStart time.Time `gorm:"primaryKey"`
+	Count       int64     `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+// RateLimitStore keeps request counters per key and fixed window. It maps
+// onto an atomic increment with an expiry (Redis INCR + EXPIREAT, a Postgres
+// upsert), so counters can be shared by every API instance.
+type RateLimitStore interface {
+	// Increment adds a request to the counter of key for the window starting
+	// at windowStart and returns the new count. The counter may be dropped
+	// after expiresAt.
+	Increment(ctx context.Context, key string, windowStart, expiresAt time.Time) (int64, error)
+	// Count returns the counter of key for the window starting at windowStart, zero if there is none.
+	Count(ctx context.Context, key string, windowStart time.Time) (int64, error)
+}
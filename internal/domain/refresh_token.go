@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is
+	// presented again. The whole token family is revoked when that happens.
+	ErrRefreshTokenReused = NewUnauthorizedError("refresh_token_reused", "refresh token has already been used")
+	// ErrRefreshTokenRevoked is returned for a refresh token that was logged out or whose family was revoked.
+	ErrRefreshTokenRevoked = NewUnauthorizedError("refresh_token_revoked", "refresh token has been revoked")
+)
+
+// RefreshToken is the server-side record of an issued refresh token. Only a
+// hash of the token is stored. Every token descends from a login through a
+// chain of rotations, and all tokens of that chain share a FamilyID.
+// AccessTokenID is the jti of the access token issued in the same pair, which
+// lets logout revoke access tokens that are still live. An impersonation
+// access token comes without a refresh token; its record has no TokenHash
+// and is revoked from the start.
+type RefreshToken struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey"` // the token's jti claim
+	UserID        uuid.UUID  `gorm:"type:uuid;not null;index"`
+	FamilyID      uuid.UUID  `gorm:"type:uuid;not null;index"`
+	AccessTokenID uuid.UUID  `gorm:"type:uuid"`
+	TokenHash     string     `gorm:"not null"`
+	ExpiresAt     time.Time  `gorm:"not null;index"`
+	UsedAt        *time.Time // set once the token has been rotated
+	RevokedAt     *time.Time
+	CreatedAt     time.Time
+}
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *RefreshToken) error
+	// FindByID returns nil, nil when no token has the given jti.
+	FindByID(ctx context.Context, id uuid.UUID) (*RefreshToken, error)
+	// MarkUsed flags an active token as rotated. It returns ErrRefreshTokenReused
+	// when the token was already used or revoked, so only one rotation can win.
+	MarkUsed(ctx context.Context, id uuid.UUID) error
+	// FindIssuedSince lists the user's tokens created after since, whatever their state.
+	FindIssuedSince(ctx context.Context, userID uuid.UUID, since time.Time) ([]RefreshToken, error)
+	RevokeFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID) error
+	// PurgeExpired removes the tokens that expired before the given time, whatever
+	// their state: an expired token can't be redeemed, so its record has no use left.
+	PurgeExpired(ctx context.Context, expiredBefore time.Time) (int64, error)
+}
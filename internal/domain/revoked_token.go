@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevokedToken marks an access token as unusable before it expires. Entries
+// are only needed until then, so stores may evict them after ExpiresAt.
+type RevokedToken struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"` // the token's jti claim
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// TokenRevocationStore is the access token deny list consulted by AuthMiddleware.
+type TokenRevocationStore interface {
+	// Revoke denies the token until it expires. Revoking a token twice is harmless.
+	Revoke(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti uuid.UUID) (bool, error)
+	// PurgeExpired removes the entries for tokens that expired before the given
+	// time: an expired token is refused anyway, so its entry has no use left.
+	PurgeExpired(ctx context.Context, expiredBefore time.Time) (int64, error)
+}
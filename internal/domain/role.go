@@ -0,0 +1,53 @@
+package domain
+
+// Role is what a user is allowed to do, carried in the "role" claim of access tokens.
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+// Permission names one privileged action. Routes require permissions rather
+// than roles where they can, so a new role only needs an entry below.
+type Permission string
+
+const (
+	PermissionDeleteAllTodos   Permission = "todos:delete_all"
+	PermissionListUsers        Permission = "users:list"
+	PermissionImpersonateUsers Permission = "users:impersonate"
+)
+
+// rolePermissions grants permissions to roles. Plain users own their todos
+// and need no permission for that.
+var rolePermissions = map[Role][]Permission{
+	RoleUser: {},
+	RoleAdmin: {
+		PermissionDeleteAllTodos,
+		PermissionListUsers,
+		PermissionImpersonateUsers,
+	},
+}
+
+var (
+	// ErrInsufficientPermission is returned when an authenticated user lacks the role or permission for an action.
+	ErrInsufficientPermission = NewForbiddenError("insufficient_permission", "insufficient permission")
+	// ErrInvalidRole is returned for a role name that doesn't exist.
+	ErrInvalidRole = NewValidationError("invalid_role", "role must be user or admin")
+)
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether r grants p. Unknown roles grant nothing.
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,53 @@
 package domain
 
-import "github.com/google/uuid"
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrTodoNotFound is returned when a todo does not exist or is owned by another user.
+	// Both cases are reported the same way so todo IDs cannot be probed.
+	ErrTodoNotFound = NewNotFoundError("todo_not_found", "todo not found")
+	// ErrInvalidTodoID is returned when a todo ID is not a valid UUID.
+	ErrInvalidTodoID = NewBadRequestError("invalid_id", "invalid id format")
+	// ErrTodoTitleRequired is returned when a todo would be saved without a title.
+	ErrTodoTitleRequired = NewValidationError("title_required", "title is required")
+	// ErrInvalidTodoQuery is returned when listing parameters cannot be honoured.
+	ErrInvalidTodoQuery = NewValidationError("invalid_todo_query", "invalid todo query")
+	// ErrInvalidTodoPatch is returned when a patch document cannot be applied to a todo.
+	ErrInvalidTodoPatch = NewValidationError("invalid_patch", "invalid patch")
+	// ErrTodoPatchTestFailed is returned when a JSON Patch "test" operation does not hold.
+	ErrTodoPatchTestFailed = NewConflictError("patch_test_failed", "patch test failed")
+	// ErrTodoVersionMismatch is returned when a todo changed since the caller last read it.
+	ErrTodoVersionMismatch = NewPreconditionFailedError("version_mismatch", "todo has been modified")
+)
+
+// Sort fields accepted when listing todos.
+const (
+	TodoSortTitle     = "title"
+	TodoSortCreatedAt = "created_at"
+	TodoSortUpdatedAt = "updated_at"
+)
+
+// TodoSortFields lists every field todos can be sorted by.
+var TodoSortFields = []string{TodoSortTitle, TodoSortCreatedAt, TodoSortUpdatedAt}
+
+// TodoCursorTimeFormat encodes timestamps in cursors. It is fixed-width so
+// cursor values compare in the same order as the times they hold.
+const TodoCursorTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// Listing limits applied when the client does not ask for a page size, or asks for too much.
+const (
+	DefaultTodoPageSize = 20
+	MaxTodoPageSize     = 100
+)
 
 // Todo represents a task in the system.
 type Todo struct {
@@ -8,25 +55,126 @@ type Todo struct {
 	Title       string    `gorm:"not null" json:"title"`
 	Description string    `json:"description"`
 	Completed   bool      `gorm:"default:false" json:"completed"`
-	UserID      uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	// Version is bumped on every write and exposed as the ETag for optimistic concurrency.
+	Version   int64          `gorm:"not null;default:1" json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at" swaggertype:"string" format:"date-time"`
+}
+
+// TodoPatch lists the fields to change on a todo. Nil fields are left untouched,
+// which is what separates "absent" from "set to the zero value".
+type TodoPatch struct {
+	Title       *string
+	Description *string
+	Completed   *bool
+}
+
+// ApplyTo copies the fields present in the patch onto todo.
+func (p TodoPatch) ApplyTo(todo *Todo) {
+	if p.Title != nil {
+		todo.Title = *p.Title
+	}
+	if p.Description != nil {
+		todo.Description = *p.Description
+	}
+	if p.Completed != nil {
+		todo.Completed = *p.Completed
+	}
+}
+
+// TodoQuery describes which of a user's todos to list and in what order.
+// When Cursor is set it takes precedence over Offset (keyset pagination).
+type TodoQuery struct {
+	UserID         uuid.UUID
+	Completed      *bool
+	Search         string // matched against Title and Description
+	IncludeDeleted bool   // also list soft-deleted todos
+	SortBy         string
+	SortDesc       bool
+	Limit          int
+	Offset         int
+	Cursor         *TodoCursor
+}
+
+// TodoPage is one page of a todo listing.
+type TodoPage struct {
+	Items      []Todo
+	Total      int64  // number of todos matching the filters, ignoring pagination
+	Limit      int    // page size actually applied
+	NextCursor string // empty when there are no more results
+}
+
+// TodoCursor marks the last todo of a page: its sort key plus ID as a tie-breaker.
+type TodoCursor struct {
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// NewTodoCursor builds the cursor pointing just after todo for the given sort field.
+func NewTodoCursor(todo Todo, sortBy string) TodoCursor {
+	var value string
+	switch sortBy {
+	case TodoSortTitle:
+		value = todo.Title
+	case TodoSortCreatedAt:
+		value = todo.CreatedAt.UTC().Format(TodoCursorTimeFormat)
+	case TodoSortUpdatedAt:
+		value = todo.UpdatedAt.UTC().Format(TodoCursorTimeFormat)
+	}
+	return TodoCursor{Value: value, ID: todo.ID}
+}
+
+// Encode returns the opaque string handed to clients as next_cursor.
+func (c TodoCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeTodoCursor parses a cursor previously produced by Encode.
+func DecodeTodoCursor(s string) (*TodoCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidTodoQuery)
+	}
+	var c TodoCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == uuid.Nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidTodoQuery)
+	}
+	return &c, nil
 }
 
 // TodoRepository defines the interface for database operations.
+// Every read and delete is scoped to the owning user.
 type TodoRepository interface {
-	Create(todo *Todo) error
-	FindAll() ([]Todo, error)
-	FindByID(id uuid.UUID) (*Todo, error)
-	Update(todo *Todo) error
-	Delete(id uuid.UUID) error
-	DeleteAll() error
+	Create(ctx context.Context, todo *Todo) error
+	FindAll(ctx context.Context, query TodoQuery) (*TodoPage, error)
+	FindByID(ctx context.Context, id, userID uuid.UUID) (*Todo, error)
+	// Update saves todo only if the stored version still equals todo.Version,
+	// then bumps todo.Version. Otherwise it returns ErrTodoVersionMismatch.
+	Update(ctx context.Context, todo *Todo) error
+	// Delete soft-deletes the todo; a non-zero version must match the stored one.
+	Delete(ctx context.Context, id, userID uuid.UUID, version int64) error
+	DeleteAll(ctx context.Context) error
+	// Restore undoes a soft delete. It returns ErrTodoNotFound when no deleted todo matches.
+	Restore(ctx context.Context, id, userID uuid.UUID) error
+	// Purge permanently removes todos soft-deleted before the given time.
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
 
 // TodoService defines the interface for business logic.
+// For Update, Patch and Delete a non-zero version is the version the caller
+// expects to modify (from If-Match); zero skips that check.
 type TodoService interface {
-	Create(title, description string, userID uuid.UUID) (*Todo, error)
-	FindAll() ([]Todo, error)
-	FindByID(id uuid.UUID) (*Todo, error)
-	Update(id uuid.UUID, title, description string, completed bool) (*Todo, error)
-	Delete(id uuid.UUID) error
-	DeleteAll() error
+	Create(ctx context.Context, title, description string, userID uuid.UUID) (*Todo, error)
+	FindAll(ctx context.Context, query TodoQuery) (*TodoPage, error)
+	FindByID(ctx context.Context, id, userID uuid.UUID) (*Todo, error)
+	Update(ctx context.Context, id, userID uuid.UUID, version int64, title, description string, completed bool) (*Todo, error)
+	Patch(ctx context.Context, id, userID uuid.UUID, version int64, patch TodoPatch) (*Todo, error)
+	Delete(ctx context.Context, id, userID uuid.UUID, version int64) error
+	DeleteAll(ctx context.Context) error
+	Restore(ctx context.Context, id, userID uuid.UUID) (*Todo, error)
+	// PurgeDeleted permanently removes todos that have been soft-deleted for longer than retention.
+	PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error)
 }
@@ -1,25 +1,148 @@
 package domain
 
-import "github.com/google/uuid"
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrEmailTaken is returned when signing up with an email that already has an account.
+	ErrEmailTaken = NewConflictError("email_already_registered", "email already registered")
+	// ErrInvalidCredentials is returned for an unknown email or a wrong password alike.
+	ErrInvalidCredentials = NewUnauthorizedError("invalid_credentials", "invalid credentials")
+	// ErrInvalidRefreshToken is returned when a refresh token is malformed, expired or forged.
+	ErrInvalidRefreshToken = NewUnauthorizedError("invalid_refresh_token", "invalid refresh token")
+	// ErrInvalidTokenType is returned when a token of another type is presented as a refresh token.
+	ErrInvalidTokenType = NewUnauthorizedError("invalid_token_type", "invalid token type")
+	// ErrUserNotFound is returned when a user does not exist.
+	ErrUserNotFound = NewNotFoundError("user_not_found", "user not found")
+	// ErrInvalidUserID is returned when a user ID is not a valid UUID.
+	ErrInvalidUserID = NewBadRequestError("invalid_id", "invalid id format")
+	// ErrInvalidUserQuery is returned when listing parameters cannot be honoured.
+	ErrInvalidUserQuery = NewValidationError("invalid_user_query", "invalid user query")
+	// ErrInvalidEmail is returned when signing up with something that is not an email address.
+	ErrInvalidEmail = NewValidationError("invalid_email", "invalid email address")
+	// ErrEmailNotVerified is returned on login until the email address has been verified.
+	ErrEmailNotVerified = NewForbiddenError("email_not_verified", "email address has not been verified, check your inbox")
+	// ErrIncorrectPassword is returned when the current password given to change the account is wrong.
+	ErrIncorrectPassword = NewForbiddenError("incorrect_password", "current password is incorrect")
+	// ErrCannotImpersonateAdmin is returned when impersonating an admin, which would hand out their privileges.
+	ErrCannotImpersonateAdmin = NewForbiddenError("cannot_impersonate_admin", "admins cannot be impersonated")
+)
+
+// Listing limits applied when the client does not ask for a page size, or asks for too much.
+const (
+	DefaultUserPageSize = 20
+	MaxUserPageSize     = 100
+)
 
 type User struct {
 	ID       uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
 	Email    string    `gorm:"uniqueIndex;not null" json:"email"`
 	Password string    `gorm:"not null" json:"-"`
+	Role     Role      `gorm:"not null;default:user" json:"role" example:"user"`
+	// EmailVerifiedAt is set once the user follows the link mailed at sign-up; until then they cannot log in.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// PendingEmail is the address the user is changing to, until they follow the link mailed there.
+	PendingEmail *string        `json:"pending_email,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// UserPage is one page of the user listing.
+type UserPage struct {
+	Items []User
+	Total int64 // number of users, ignoring pagination
+	Limit int   // page size actually applied
 }
 
 type UserRepository interface {
-	Create(user *User) error
-	FindByEmail(email string) (*User, error)
+	Create(ctx context.Context, user *User) error
+	// FindByEmail ignores case, and returns ErrUserNotFound when no user has the email.
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	// FindByID returns nil, nil when there is no such user.
+	FindByID(ctx context.Context, id uuid.UUID) (*User, error)
+	// FindAll lists users in sign-up order.
+	FindAll(ctx context.Context, limit, offset int) (*UserPage, error)
+	// UpdateRole returns ErrUserNotFound when there is no such user.
+	UpdateRole(ctx context.Context, id uuid.UUID, role Role) error
+	// MarkEmailVerified records when the email was verified, keeping the first time.
+	MarkEmailVerified(ctx context.Context, id uuid.UUID, at time.Time) error
+	// UpdatePassword stores a new password hash. It returns ErrUserNotFound when there is no such user.
+	UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error
+	// SetPendingEmail records the address the user asked to change to.
+	SetPendingEmail(ctx context.Context, id uuid.UUID, email string) error
+	// ConfirmEmail makes email, which was pending, the user's verified address.
+	// It returns ErrEmailTaken when another account took it in the meantime.
+	ConfirmEmail(ctx context.Context, id uuid.UUID, email string, at time.Time) error
+	// Delete removes the user for good, along with their todos, tokens and API keys.
+	Delete(ctx context.Context, id uuid.UUID) error
 }
 
 type TokenPair struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken string `json:"access_token,omitempty"`
+	// RefreshToken is empty for impersonation, which cannot be refreshed.
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// MFAToken is all Login returns for a user with two-factor authentication
+	// on: it is exchanged for the tokens, with a code, at LoginMFA.
+	MFAToken string `json:"mfa_token,omitempty"`
 }
 
 type UserService interface {
-	SignUp(email, password string) (*User, error)
-	Login(email, password string) (*TokenPair, error)
-	RefreshToken(refreshToken string) (*TokenPair, error)
+	// SignUp creates an unverified account and mails a link to verify the email.
+	SignUp(ctx context.Context, email, password string) (*User, error)
+	// Login counts failures per email and per clientIP (empty when unknown)
+	// and turns both away for a while after too many of them. A user with
+	// two-factor authentication on only gets an MFA token (see LoginMFA).
+	Login(ctx context.Context, email, password, clientIP string) (*TokenPair, error)
+	// LoginExternal signs in the user an identity provider vouched for. An
+	// identity seen before signs in its user; a new one, with a verified
+	// email, is linked to the account with that email, or gets a new account
+	// without a password. Two-factor authentication applies as for Login.
+	LoginExternal(ctx context.Context, identity ExternalIdentity) (*TokenPair, error)
+	// LoginMFA exchanges the MFA token from Login, with a TOTP or recovery
+	// code, for a token pair. Wrong codes count as failed logins.
+	LoginMFA(ctx context.Context, mfaToken, code, clientIP string) (*TokenPair, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*TokenPair, error)
+	// Logout revokes the refresh token and every token rotated from the same login.
+	Logout(ctx context.Context, refreshToken string) error
+	// LogoutAll revokes every refresh token of the user, signing out all devices.
+	LogoutAll(ctx context.Context, userID uuid.UUID) error
+	// ListUsers pages through every account, for admins.
+	ListUsers(ctx context.Context, limit, offset int) (*UserPage, error)
+	// Impersonate issues adminID an access token acting as userID. The token
+	// names the admin in its "act" claim and comes without a refresh token.
+	Impersonate(ctx context.Context, adminID, userID uuid.UUID) (*TokenPair, error)
+	// VerifyEmail redeems the token mailed at sign-up, or the one mailed to a
+	// new address by ChangeEmail, which then becomes the user's email.
+	VerifyEmail(ctx context.Context, token string) error
+	// ForgotPassword mails a password reset link. Unknown emails are ignored
+	// without an error, and the link is mailed in the background, so neither
+	// the answer nor how long it takes can be used to find accounts.
+	ForgotPassword(ctx context.Context, email string) error
+	// ResetPassword redeems a password reset token. It also verifies the
+	// email, lifts a login lockout and signs the user out everywhere.
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	// GetUser returns the account of the signed-in user.
+	GetUser(ctx context.Context, userID uuid.UUID) (*User, error)
+	// ChangeEmail mails a verification link to newEmail and keeps it as the
+	// pending email; the current email stays in use until the link is followed.
+	ChangeEmail(ctx context.Context, userID uuid.UUID, newEmail, currentPassword string) (*User, error)
+	// ChangePassword signs out every session, including the caller's, and
+	// returns a new token pair to carry on with.
+	ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) (*TokenPair, error)
+	// DeleteAccount removes the user along with their todos, and signs them out.
+	DeleteAccount(ctx context.Context, userID uuid.UUID, currentPassword string) error
+	// EnrollTOTP starts setting up two-factor authentication with a new
+	// secret, which only takes effect once confirmed with ConfirmTOTP.
+	EnrollTOTP(ctx context.Context, userID uuid.UUID, currentPassword string) (*TOTPEnrollment, error)
+	// ConfirmTOTP turns two-factor authentication on with a code from the
+	// app, and returns recovery codes, which are never shown again.
+	ConfirmTOTP(ctx context.Context, userID uuid.UUID, currentPassword, code string) ([]string, error)
+	// DisableMFA turns two-factor authentication off.
+	DisableMFA(ctx context.Context, userID uuid.UUID, currentPassword string) error
 }
@@ -0,0 +1,36 @@
+// Package gormhooks registers callbacks around every query GORM runs, for
+// plugins that watch queries rather than change them.
+package gormhooks
+
+import "gorm.io/gorm"
+
+// Hooks returns the callbacks to run before and after an operation: "create",
+// "query", "update", "delete", "row" or "raw".
+type Hooks func(operation string) (before, after func(*gorm.DB))
+
+// Register registers the hooks around each of GORM's operations, named
+// "<prefix>:before_<operation>" and "<prefix>:after_<operation>".
+func Register(db *gorm.DB, prefix string, hooks Hooks) error {
+	callbacks := db.Callback()
+	for _, c := range []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"query", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"update", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"delete", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	} {
+		before, after := hooks(c.operation)
+		if err := c.before(prefix+":before_"+c.operation, before); err != nil {
+			return err
+		}
+		if err := c.after(prefix+":after_"+c.operation, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
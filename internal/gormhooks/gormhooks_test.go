@@ -0,0 +1,36 @@
+package gormhooks_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/gormhooks"
+	"github.com/prachaya-orr/relearn-golang/internal/repository/repositorytest"
+	"gorm.io/gorm"
+)
+
+func TestRegister(t *testing.T) {
+	db := repositorytest.NewBlockingDB(t)
+	var calls []string
+	err := gormhooks.Register(db.DB, "test", func(operation string) (func(*gorm.DB), func(*gorm.DB)) {
+		return func(*gorm.DB) { calls = append(calls, "before "+operation) },
+			func(*gorm.DB) { calls = append(calls, "after "+operation) }
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The queries fail at once, and the hooks run all the same
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var todos []domain.Todo
+	db.WithContext(ctx).Find(&todos)
+	db.WithContext(ctx).Exec("SELECT 1")
+
+	want := []string{"before query", "after query", "before raw", "after raw"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("expected %v, got %v", want, calls)
+	}
+}
@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// AccountHandler serves the /me routes, where the signed-in user manages their own account.
+type AccountHandler struct {
+	svc domain.UserService
+}
+
+func NewAccountHandler(svc domain.UserService) *AccountHandler {
+	return &AccountHandler{svc: svc}
+}
+
+// Get handles GET /me
+// @Summary Get the current user
+// @Description Return the account of the signed-in user, including an email change waiting to be confirmed.
+// @Tags account
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} domain.User
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 404 {object} middleware.ErrorResponse
+// @Router /me [get]
+func (h *AccountHandler) Get(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	user, err := h.svc.GetUser(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateAccountRequest represents the request body for changing the account
+type UpdateAccountRequest struct {
+	Email string `json:"email" binding:"required" example:"new@example.com"`
+	// CurrentPassword is left out by an account without a password, which
+	// needs a recent sign-in with the identity provider instead.
+	CurrentPassword string `json:"current_password" example:"password123"`
+}
+
+// Update handles PATCH /me
+// @Summary Change email address
+// @Description Mail a link to the new address and tell the current one. The new address becomes pending_email,
+// @Description and replaces the email once the link is redeemed at POST /verify-email; until then the current email keeps working.
+// @Description A wrong current password counts as a failed login.
+// @Description An account without a password, made by signing in with the identity provider, leaves current_password out: it needs a sign-in with the provider within OIDC_REAUTH_WINDOW, or gets reauthentication_required.
+// @Tags account
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param account body UpdateAccountRequest true "New email and current password"
+// @Success 200 {object} domain.User
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 409 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Failure 429 {object} middleware.ErrorResponse
+// @Router /me [patch]
+func (h *AccountHandler) Update(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req UpdateAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	user, err := h.svc.ChangeEmail(c.Request.Context(), userID, req.Email, req.CurrentPassword)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ChangePasswordRequest represents the request body for changing the password
+type ChangePasswordRequest struct {
+	// CurrentPassword is left out by an account without a password, which
+	// needs a recent sign-in with the identity provider instead.
+	CurrentPassword string `json:"current_password" example:"password123"`
+	NewPassword     string `json:"new_password" binding:"required" example:"correct-horse-battery"`
+}
+
+// ChangePassword handles POST /me/password
+// @Summary Change password
+// @Description Change the password and sign out every session, including this one; the response carries new tokens to carry on with.
+// @Description A password that breaks the password policy is refused with weak_password, listing the broken rules under violations.password.
+// @Description An account without a password, made by signing in with the identity provider, leaves current_password out: it needs a sign-in with the provider within OIDC_REAUTH_WINDOW, or gets reauthentication_required.
+// @Tags account
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param password body ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} domain.TokenPair
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Failure 429 {object} middleware.ErrorResponse
+// @Router /me/password [post]
+func (h *AccountHandler) ChangePassword(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	tokens, err := h.svc.ChangePassword(c.Request.Context(), userID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// DeleteAccountRequest represents the request body for deleting the account
+type DeleteAccountRequest struct {
+	// CurrentPassword is left out by an account without a password, which
+	// needs a recent sign-in with the identity provider instead.
+	CurrentPassword string `json:"current_password" example:"password123"`
+}
+
+// Delete handles DELETE /me
+// @Summary Delete account
+// @Description Delete the account for good, along with its todos and API keys, and sign out every session.
+// @Description An account without a password, made by signing in with the identity provider, leaves current_password out: it needs a sign-in with the provider within OIDC_REAUTH_WINDOW, or gets reauthentication_required.
+// @Tags account
+// @Accept  json
+// @Security BearerAuth
+// @Param account body DeleteAccountRequest true "Current password"
+// @Success 204
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 429 {object} middleware.ErrorResponse
+// @Router /me [delete]
+func (h *AccountHandler) Delete(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	if err := h.svc.DeleteAccount(c.Request.Context(), userID, req.CurrentPassword); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// EnrollTOTPRequest represents the request body for starting two-factor authentication setup
+type EnrollTOTPRequest struct {
+	// CurrentPassword is left out by an account without a password, which
+	// needs a recent sign-in with the identity provider instead.
+	CurrentPassword string `json:"current_password" example:"password123"`
+}
+
+// EnrollTOTP handles POST /me/mfa/totp
+// @Summary Start two-factor authentication setup
+// @Description Create a TOTP secret for an authenticator app. It takes effect once confirmed at POST /me/mfa/totp/confirm;
+// @Description enrolling again before that replaces the secret. A wrong current password counts as a failed login.
+// @Description An account without a password, made by signing in with the identity provider, leaves current_password out: it needs a sign-in with the provider within OIDC_REAUTH_WINDOW, or gets reauthentication_required.
+// @Tags account
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param account body EnrollTOTPRequest true "Current password"
+// @Success 200 {object} domain.TOTPEnrollment
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 409 {object} middleware.ErrorResponse
+// @Failure 429 {object} middleware.ErrorResponse
+// @Router /me/mfa/totp [post]
+func (h *AccountHandler) EnrollTOTP(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req EnrollTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	enrollment, err := h.svc.EnrollTOTP(c.Request.Context(), userID, req.CurrentPassword)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTPRequest carries a code from the authenticator app
+type ConfirmTOTPRequest struct {
+	// CurrentPassword is left out by an account without a password, as for EnrollTOTPRequest.
+	CurrentPassword string `json:"current_password" example:"password123"`
+	Code            string `json:"code" binding:"required" example:"123456"`
+}
+
+// RecoveryCodesResponse lists the recovery codes, shown only once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"k3vq-7mza"`
+}
+
+// ConfirmTOTP handles POST /me/mfa/totp/confirm
+// @Summary Turn on two-factor authentication
+// @Description Confirm the enrollment with a code from the app. From then on login asks for a code.
+// @Description The response lists single-use recovery codes for when the app is lost; they are not shown again.
+// @Description The current password is checked again, as at POST /me/mfa/totp.
+// @Tags account
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param code body ConfirmTOTPRequest true "Current password and a code from the authenticator app"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 409 {object} middleware.ErrorResponse
+// @Failure 429 {object} middleware.ErrorResponse
+// @Router /me/mfa/totp/confirm [post]
+func (h *AccountHandler) ConfirmTOTP(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req ConfirmTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	codes, err := h.svc.ConfirmTOTP(c.Request.Context(), userID, req.CurrentPassword, req.Code)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableMFA handles DELETE /me/mfa
+// @Summary Turn off two-factor authentication
+// @Description Remove the TOTP secret and recovery codes. A wrong current password counts as a failed login.
+// @Description An account without a password, made by signing in with the identity provider, leaves current_password out: it needs a sign-in with the provider within OIDC_REAUTH_WINDOW, or gets reauthentication_required.
+// @Tags account
+// @Accept  json
+// @Security BearerAuth
+// @Param account body DeleteAccountRequest true "Current password"
+// @Success 204
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 409 {object} middleware.ErrorResponse
+// @Failure 429 {object} middleware.ErrorResponse
+// @Router /me/mfa [delete]
+func (h *AccountHandler) DisableMFA(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	if err := h.svc.DisableMFA(c.Request.Context(), userID, req.CurrentPassword); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
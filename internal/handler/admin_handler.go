@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+)
+
+// AdminHandler serves the /admin routes; the router restricts them to admins.
+type AdminHandler struct {
+	svc domain.UserService
+}
+
+func NewAdminHandler(svc domain.UserService) *AdminHandler {
+	return &AdminHandler{svc: svc}
+}
+
+// ListUsersRequest represents the query parameters for listing users
+type ListUsersRequest struct {
+	Limit  int `form:"limit" binding:"omitempty,min=1,max=100" example:"20"`
+	Offset int `form:"offset" binding:"omitempty,min=0" example:"0"`
+}
+
+// ListUsers handles GET /admin/users
+// @Summary List users
+// @Description List every account in sign-up order. Admins only.
+// @Tags admin
+// @Produce  json
+// @Security BearerAuth
+// @Param limit query int false "Page size (1-100, default 20)"
+// @Param offset query int false "Number of users to skip"
+// @Success 200 {array} domain.User
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
+// @Router /admin/users [get]
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	var req ListUsersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	page, err := h.svc.ListUsers(c.Request.Context(), req.Limit, req.Offset)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	middleware.SetPagination(c, middleware.Pagination{
+		Total:  page.Total,
+		Limit:  page.Limit,
+		Offset: req.Offset,
+	})
+	// Always return an array, even for an empty page.
+	users := page.Items
+	if users == nil {
+		users = []domain.User{}
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// Impersonate handles POST /admin/users/:id/impersonate
+// @Summary Impersonate a user
+// @Description Get an access token acting as the user, to see what they see. The token names the admin in its "act" claim,
+// @Description expires with the access token TTL and comes without a refresh token. Admins cannot be impersonated.
+// @Tags admin
+// @Produce  json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} domain.TokenPair
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 404 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
+// @Router /admin/users/{id}/impersonate [post]
+func (h *AdminHandler) Impersonate(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.Error(domain.ErrInvalidUserID)
+		return
+	}
+
+	adminID := c.MustGet("userID").(uuid.UUID)
+
+	tokens, err := h.svc.Impersonate(c.Request.Context(), adminID, userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
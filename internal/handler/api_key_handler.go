@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+type APIKeyHandler struct {
+	svc domain.APIKeyService
+}
+
+func NewAPIKeyHandler(svc domain.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{svc: svc}
+}
+
+// CreateAPIKeyRequest represents the request body for creating an API key
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100" example:"CI bot"`
+	Scopes []string `json:"scopes" binding:"required,min=1" example:"todos:read,todos:write"`
+	// ExpiresAt is optional; without it the key lasts until revoked
+	ExpiresAt *time.Time `json:"expires_at" example:"2030-01-01T00:00:00Z"`
+}
+
+// Create handles POST /api-keys
+// @Summary Create an API key
+// @Description Create a key for machine clients, sent in the X-API-KEY header instead of a Bearer token.
+// @Description The key is only returned by this call; store it right away. Scopes: todos:read, todos:write.
+// @Tags api-keys
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param key body CreateAPIKeyRequest true "API key"
+// @Success 201 {object} domain.CreatedAPIKey
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
+// @Router /api-keys [post]
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	scopes := make([]domain.Scope, len(req.Scopes))
+	for i, scope := range req.Scopes {
+		scopes[i] = domain.Scope(scope)
+	}
+
+	key, err := h.svc.Create(c.Request.Context(), userID, req.Name, scopes, req.ExpiresAt)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// List handles GET /api-keys
+// @Summary List API keys
+// @Description List the current user's API keys that have not been revoked. Keys are identified by their prefix.
+// @Tags api-keys
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {array} domain.APIKey
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
+// @Router /api-keys [get]
+func (h *APIKeyHandler) List(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	keys, err := h.svc.List(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Always return an array, even when there are no keys.
+	if keys == nil {
+		keys = []domain.APIKey{}
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// Revoke handles DELETE /api-keys/:id
+// @Summary Revoke an API key
+// @Description Revoke one of the current user's API keys; it stops working immediately.
+// @Tags api-keys
+// @Produce  json
+// @Security BearerAuth
+// @Param id path string true "API key ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 404 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
+// @Router /api-keys/{id} [delete]
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.Error(domain.ErrInvalidAPIKeyID)
+		return
+	}
+
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	if err := h.svc.Revoke(c.Request.Context(), id, userID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// todoETag renders a todo's version as a strong entity tag
+func todoETag(todo *domain.Todo) string {
+	return `"` + strconv.FormatInt(todo.Version, 10) + `"`
+}
+
+// setTodoETag exposes the todo's current version to the client
+func setTodoETag(c *gin.Context, todo *domain.Todo) {
+	c.Header("ETag", todoETag(todo))
+}
+
+// ifMatchVersions parses the If-Match header into the versions the client
+// expects to modify. It returns none when the header is absent or "*", which
+// skips the check. If-Match uses strong comparison, so weak and foreign tags
+// are left out: they can never match. A header with nothing but those is a
+// version mismatch.
+func ifMatchVersions(header string) ([]int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	var versions []int64
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if !strings.HasPrefix(candidate, `"`) {
+			continue
+		}
+		version, err := strconv.ParseInt(strings.Trim(candidate, `"`), 10, 64)
+		if err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, domain.ErrTodoVersionMismatch
+	}
+	return versions, nil
+}
+
+// ifMatchVersion reads the If-Match header into the version the client expects
+// to modify, 0 when there is no check to make. A list of tags matches if any
+// of them is the todo's current version (RFC 9110), which then has to be looked
+// up; the write itself still checks that the version hasn't moved on since.
+func (h *TodoHandler) ifMatchVersion(c *gin.Context, id, userID uuid.UUID) (int64, error) {
+	versions, err := ifMatchVersions(c.GetHeader("If-Match"))
+	if err != nil || len(versions) == 0 {
+		return 0, err
+	}
+	if len(versions) == 1 {
+		return versions[0], nil
+	}
+
+	current, err := h.svc.FindByID(c.Request.Context(), id, userID)
+	if err != nil {
+		return 0, err
+	}
+	if current == nil {
+		return 0, domain.ErrTodoNotFound
+	}
+	if !slices.Contains(versions, current.Version) {
+		return 0, domain.ErrTodoVersionMismatch
+	}
+	return current.Version, nil
+}
+
+// ifNoneMatch reports whether the If-None-Match header matches the todo, in
+// which case the client's cached copy is current
+func ifNoneMatch(c *gin.Context, todo *domain.Todo) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	etag := todoETag(todo)
+	for _, candidate := range strings.Split(header, ",") {
+		// If-None-Match uses weak comparison: W/"3" matches "3".
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
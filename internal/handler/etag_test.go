@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+)
+
+func newHeaderContext(name, value string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if value != "" {
+		c.Request.Header.Set(name, value)
+	}
+	return c
+}
+
+func TestIfMatchVersions(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    []int64
+		wantErr error
+	}{
+		{header: "", want: nil},
+		{header: "*", want: nil},
+		{header: `"3"`, want: []int64{3}},
+		{header: `W/"3"`, wantErr: domain.ErrTodoVersionMismatch},
+		{header: `"abc"`, wantErr: domain.ErrTodoVersionMismatch},
+		{header: `"3", "4"`, want: []int64{3, 4}},
+		{header: `W/"3", "4", "abc"`, want: []int64{4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, err := ifMatchVersions(tt.header)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected versions %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// versionedTodos serves a single todo at version 3 and records the version deletes expect
+type versionedTodos struct {
+	domain.TodoService
+	deleted int64
+}
+
+func (s *versionedTodos) FindByID(ctx context.Context, id, userID uuid.UUID) (*domain.Todo, error) {
+	return &domain.Todo{ID: id, UserID: userID, Version: 3}, nil
+}
+
+func (s *versionedTodos) Delete(ctx context.Context, id, userID uuid.UUID, version int64) error {
+	if version != 0 && version != 3 {
+		return domain.ErrTodoVersionMismatch
+	}
+	s.deleted = version
+	return nil
+}
+
+func TestIfMatchList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		header      string
+		wantStatus  int
+		wantVersion int64
+	}{
+		{header: `"2", "3"`, wantStatus: http.StatusNoContent, wantVersion: 3},
+		{header: `"1", "2"`, wantStatus: http.StatusPreconditionFailed},
+		{header: `W/"3", "2"`, wantStatus: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			svc := &versionedTodos{}
+			r := gin.New()
+			r.Use(middleware.ErrorHandler())
+			r.DELETE("/todos/:id", func(c *gin.Context) { c.Set("userID", uuid.New()) }, NewTodoHandler(svc).Delete)
+
+			req := httptest.NewRequest(http.MethodDelete, "/todos/"+uuid.NewString(), nil)
+			req.Header.Set("If-Match", tt.header)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if svc.deleted != tt.wantVersion {
+				t.Errorf("expected the delete to expect version %d, got %d", tt.wantVersion, svc.deleted)
+			}
+		})
+	}
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	todo := &domain.Todo{Version: 3}
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "", want: false},
+		{header: `"3"`, want: true},
+		{header: `W/"3"`, want: true},
+		{header: `"2", "3"`, want: true},
+		{header: `"2"`, want: false},
+		{header: "*", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := ifNoneMatch(newHeaderContext("If-None-Match", tt.header), todo); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
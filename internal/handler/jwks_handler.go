@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
+)
+
+type JWKSHandler struct {
+	keys *token.KeySet
+}
+
+func NewJWKSHandler(keys *token.KeySet) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// JWKS handles GET /.well-known/jwks.json
+// @Summary JSON Web Key Set
+// @Description Public keys other services use to verify the API's tokens, matched by the kid header. Served as a plain JWK Set, without the response envelope.
+// @Tags auth
+// @Produce  json
+// @Success 200 {object} token.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) JWKS(c *gin.Context) {
+	// Verifiers may cache the set briefly; a rotated-in key is published before it signs anything.
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/oidc"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	// oidcStateTTL is how long the user has to sign in at the provider
+	oidcStateTTL = 10 * time.Minute
+)
+
+// OIDCHandler serves sign-in with an external OpenID Connect provider.
+//
+// The sign-in in progress (state, nonce and PKCE verifier) is kept in a
+// cookie holding a JWT of type "oidc_state", signed with the API's keys, so
+// that the browser carries it to the callback without being able to change it.
+type OIDCHandler struct {
+	svc    domain.UserService
+	client *oidc.Client
+	keys   *token.KeySet
+	cfg    config.OIDCConfig
+}
+
+func NewOIDCHandler(svc domain.UserService, client *oidc.Client, keys *token.KeySet, cfg config.OIDCConfig) *OIDCHandler {
+	return &OIDCHandler{svc: svc, client: client, keys: keys, cfg: cfg}
+}
+
+// Login handles GET /auth/oidc/login
+// @Summary Sign in with the identity provider
+// @Description Redirect the browser to the OpenID Connect provider to sign in. The provider sends it back to GET /auth/oidc/callback.
+// @Description Only available when OIDC_ISSUER is configured.
+// @Tags auth
+// @Success 302
+// @Header 302 {string} Location "The provider's authorization endpoint"
+// @Failure 500 {object} middleware.ErrorResponse
+// @Router /auth/oidc/login [get]
+func (h *OIDCHandler) Login(c *gin.Context) {
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	authURL, err := h.client.AuthCodeURL(c.Request.Context(), req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	state, err := h.keys.Sign(jwt.MapClaims{
+		"iss":      h.keys.Issuer(),
+		"aud":      token.AudienceOIDCState,
+		"type":     "oidc_state",
+		"state":    req.State,
+		"nonce":    req.Nonce,
+		"verifier": req.Verifier,
+		"exp":      time.Now().Add(oidcStateTTL).Unix(),
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.setStateCookie(c, state, int(oidcStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback handles GET /auth/oidc/callback
+// @Summary Finish signing in with the identity provider
+// @Description Where the provider redirects back to. The first sign-in links the provider account to the account with the same email,
+// @Description or creates an account without a password, provided the provider has verified the email; later sign-ins go by the provider account alone.
+// @Description With two-factor authentication on, the response only has an mfa_token, to exchange with a code at POST /login/mfa.
+// @Tags auth
+// @Produce  json
+// @Param state query string true "State from the sign-in"
+// @Param code query string false "Authorization code"
+// @Param error query string false "Error from the provider"
+// @Success 200 {object} domain.TokenPair
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Router /auth/oidc/callback [get]
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	req, ok := h.authRequest(c)
+	// The cookie is good for one attempt either way
+	h.setStateCookie(c, "", -1)
+	if !ok {
+		c.Error(domain.ErrInvalidOIDCState)
+		return
+	}
+	if reason := c.Query("error"); reason != "" {
+		c.Error(fmt.Errorf("%w: %s", domain.ErrOIDCLoginFailed, reason))
+		return
+	}
+
+	claims, err := h.client.Exchange(c.Request.Context(), c.Query("code"), req)
+	if err != nil {
+		// The details stay in the log: they are about the provider, not the user.
+		slog.WarnContext(c.Request.Context(), "OIDC sign-in failed", "provider", h.cfg.Provider, "error", err)
+		c.Error(domain.ErrOIDCLoginFailed)
+		return
+	}
+
+	tokens, err := h.svc.LoginExternal(c.Request.Context(), domain.ExternalIdentity{
+		Provider:      h.cfg.Provider,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// authRequest reads the sign-in from the state cookie, if it is the one the
+// provider's redirect is for
+func (h *OIDCHandler) authRequest(c *gin.Context) (*oidc.AuthRequest, bool) {
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil {
+		return nil, false
+	}
+	claims := jwt.MapClaims{}
+	parsed, err := h.keys.Parse(cookie, token.AudienceOIDCState, claims)
+	if err != nil || !parsed.Valid || claims["type"] != "oidc_state" {
+		return nil, false
+	}
+	req := &oidc.AuthRequest{}
+	req.State, _ = claims["state"].(string)
+	req.Nonce, _ = claims["nonce"].(string)
+	req.Verifier, _ = claims["verifier"].(string)
+	if req.State == "" || subtle.ConstantTimeCompare([]byte(req.State), []byte(c.Query("state"))) != 1 {
+		return nil, false
+	}
+	return req, true
+}
+
+// setStateCookie sets the state cookie, or deletes it with a negative maxAge.
+// It has to be sent along with the provider's redirect, a top-level
+// navigation from another site, which SameSite=Lax allows.
+func (h *OIDCHandler) setStateCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := strings.HasPrefix(h.cfg.RedirectURL, "https://")
+	c.SetCookie(oidcStateCookie, value, maxAge, "/auth/oidc", "", secure, true)
+}
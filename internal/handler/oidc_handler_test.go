@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+	"github.com/prachaya-orr/relearn-golang/internal/oidc"
+	"github.com/prachaya-orr/relearn-golang/internal/oidc/oidctest"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
+)
+
+// externalLoginService records who LoginExternal was called for
+type externalLoginService struct {
+	domain.UserService
+	identity *domain.ExternalIdentity
+}
+
+func (s *externalLoginService) LoginExternal(_ context.Context, identity domain.ExternalIdentity) (*domain.TokenPair, error) {
+	s.identity = &identity
+	return &domain.TokenPair{AccessToken: "access", RefreshToken: "refresh"}, nil
+}
+
+// newOIDCServer serves the sign-in routes against a fake provider
+func newOIDCServer(t *testing.T) (*httptest.Server, *externalLoginService) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	provider := oidctest.NewServer(t, "todo-api", "secret")
+
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	key, _ := token.NewSigningKey(private)
+	keys, _ := token.NewKeySet("https://api.example.com", key)
+	svc := &externalLoginService{}
+
+	r := gin.New()
+	r.Use(middleware.ErrorHandler())
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	cfg := config.OIDCConfig{
+		Provider:     "fake",
+		Issuer:       provider.Issuer,
+		ClientID:     "todo-api",
+		ClientSecret: "secret",
+		RedirectURL:  server.URL + "/auth/oidc/callback",
+		Scopes:       []string{"openid", "email"},
+	}
+	h := NewOIDCHandler(svc, oidc.NewClient(cfg), keys, cfg)
+	r.GET("/auth/oidc/login", h.Login)
+	r.GET("/auth/oidc/callback", h.Callback)
+	return server, svc
+}
+
+// newBrowser keeps cookies and stops at the redirect back to the API
+func newBrowser(t *testing.T, server *httptest.Server) *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar, CheckRedirect: func(req *http.Request, _ []*http.Request) error {
+		if req.URL.Host == server.Listener.Addr().String() {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}}
+}
+
+// startSignIn follows the redirects to the provider and back, and returns the callback URL
+func startSignIn(t *testing.T, server *httptest.Server, browser *http.Client) *url.URL {
+	t.Helper()
+	resp, err := browser.Get(server.URL + "/auth/oidc/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected a redirect to the provider, got %d", resp.StatusCode)
+	}
+	callback, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback
+}
+
+func getCode(t *testing.T, browser *http.Client, u string) (int, string) {
+	t.Helper()
+	resp, err := browser.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Code string `json:"code"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body.Code
+}
+
+func TestOIDCHandler(t *testing.T) {
+	t.Run("Sign In", func(t *testing.T) {
+		server, svc := newOIDCServer(t)
+		browser := newBrowser(t, server)
+		callback := startSignIn(t, server, browser)
+
+		resp, err := browser.Get(callback.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var tokens domain.TokenPair
+		json.NewDecoder(resp.Body).Decode(&tokens)
+		if resp.StatusCode != http.StatusOK || tokens.AccessToken != "access" {
+			t.Fatalf("expected tokens, got %d %+v", resp.StatusCode, tokens)
+		}
+		want := domain.ExternalIdentity{Provider: "fake", Subject: "fake-user", Email: "fake-user@example.com", EmailVerified: true}
+		if svc.identity == nil || *svc.identity != want {
+			t.Errorf("expected %+v to sign in, got %+v", want, svc.identity)
+		}
+
+		// The state cookie is gone, so the redirect can't be replayed
+		if status, code := getCode(t, browser, callback.String()); status != http.StatusBadRequest || code != "invalid_oidc_state" {
+			t.Errorf("expected invalid_oidc_state, got %d %s", status, code)
+		}
+	})
+
+	t.Run("Other Browser", func(t *testing.T) {
+		server, svc := newOIDCServer(t)
+		callback := startSignIn(t, server, newBrowser(t, server))
+
+		if status, code := getCode(t, newBrowser(t, server), callback.String()); status != http.StatusBadRequest || code != "invalid_oidc_state" {
+			t.Errorf("expected invalid_oidc_state, got %d %s", status, code)
+		}
+		if svc.identity != nil {
+			t.Error("expected nobody to be signed in")
+		}
+	})
+
+	t.Run("Wrong State", func(t *testing.T) {
+		server, _ := newOIDCServer(t)
+		browser := newBrowser(t, server)
+		callback := startSignIn(t, server, browser)
+		query := callback.Query()
+		query.Set("state", "forged")
+		callback.RawQuery = query.Encode()
+
+		if status, code := getCode(t, browser, callback.String()); status != http.StatusBadRequest || code != "invalid_oidc_state" {
+			t.Errorf("expected invalid_oidc_state, got %d %s", status, code)
+		}
+	})
+
+	t.Run("Provider Error", func(t *testing.T) {
+		server, _ := newOIDCServer(t)
+		browser := newBrowser(t, server)
+		callback := startSignIn(t, server, browser)
+		query := url.Values{"state": {callback.Query().Get("state")}, "error": {"access_denied"}}
+		callback.RawQuery = query.Encode()
+
+		if status, code := getCode(t, browser, callback.String()); status != http.StatusUnauthorized || code != "oidc_login_failed" {
+			t.Errorf("expected oidc_login_failed, got %d %s", status, code)
+		}
+	})
+
+	t.Run("Bad Code", func(t *testing.T) {
+		server, _ := newOIDCServer(t)
+		browser := newBrowser(t, server)
+		callback := startSignIn(t, server, browser)
+		query := callback.Query()
+		query.Set("code", "made-up")
+		callback.RawQuery = query.Encode()
+
+		if status, code := getCode(t, browser, callback.String()); status != http.StatusUnauthorized || code != "oidc_login_failed" {
+			t.Errorf("expected oidc_login_failed, got %d %s", status, code)
+		}
+	})
+}
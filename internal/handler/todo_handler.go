@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
 )
 
 // CreateTodoRequest represents the request body for creating a todo
@@ -21,6 +22,26 @@ type UpdateTodoRequest struct {
 	Completed   bool   `json:"completed" example:"true"`
 }
 
+// ListTodosRequest represents the query parameters for listing todos
+type ListTodosRequest struct {
+	Completed *bool  `form:"completed" example:"false"`
+	Search    string `form:"q" example:"milk"`
+	Sort      string `form:"sort" binding:"omitempty,oneof=title created_at updated_at" example:"created_at"`
+	Order     string `form:"order" binding:"omitempty,oneof=asc desc" example:"desc"`
+	Limit     int    `form:"limit" binding:"omitempty,min=1,max=100" example:"20"`
+	Offset    int    `form:"offset" binding:"omitempty,min=0" example:"0"`
+	Cursor    string `form:"cursor"`
+	// IncludeDeleted also lists soft-deleted todos, e.g. to find one to restore
+	IncludeDeleted bool `form:"include_deleted" example:"false"`
+}
+
+// PatchTodoRequest documents the merge patch body; every field is optional
+type PatchTodoRequest struct {
+	Title       *string `json:"title,omitempty" example:"Buy oat milk"`
+	Description *string `json:"description,omitempty" example:"Go to the organic store"`
+	Completed   *bool   `json:"completed,omitempty" example:"true"`
+}
+
 type TodoHandler struct {
 	svc domain.TodoService
 }
@@ -37,24 +58,26 @@ func NewTodoHandler(svc domain.TodoService) *TodoHandler {
 // @Accept  json
 // @Produce  json
 // @Security BearerAuth
+// @Security APIKeyAuth
 // @Param todo body CreateTodoRequest true "Create Todo"
 // @Success 201 {object} domain.Todo
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
 // @Router /todos [post]
 func (h *TodoHandler) Create(c *gin.Context) {
 	var req CreateTodoRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
 	userID := c.MustGet("userID").(uuid.UUID)
 
-	todo, err := h.svc.Create(req.Title, req.Description, userID)
+	todo, err := h.svc.Create(c.Request.Context(), req.Title, req.Description, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -62,50 +85,113 @@ func (h *TodoHandler) Create(c *gin.Context) {
 }
 
 // FindAll handles GET /todos
-// @Summary List all todos
-// @Description Get all todos
+// @Summary List todos
+// @Description List todos owned by the authenticated user. Supports filtering, free-text search,
+// @Description sorting and either offset or cursor (keyset) pagination. The total count and the
+// @Description next cursor are returned in meta.pagination.
 // @Tags todos
 // @Produce  json
 // @Security BearerAuth
+// @Security APIKeyAuth
+// @Param completed query bool false "Filter by completion state"
+// @Param q query string false "Search in title and description"
+// @Param sort query string false "Sort field" Enums(title, created_at, updated_at)
+// @Param order query string false "Sort direction" Enums(asc, desc)
+// @Param limit query int false "Page size (max 100)" default(20)
+// @Param offset query int false "Number of todos to skip (ignored with cursor)"
+// @Param cursor query string false "Cursor from a previous page's meta.pagination.next_cursor"
+// @Param include_deleted query bool false "Also list soft-deleted todos"
 // @Success 200 {array} domain.Todo
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
 // @Router /todos [get]
 func (h *TodoHandler) FindAll(c *gin.Context) {
-	todos, err := h.svc.FindAll()
+	var req ListTodosRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	query := domain.TodoQuery{
+		UserID:         c.MustGet("userID").(uuid.UUID),
+		Completed:      req.Completed,
+		Search:         req.Search,
+		IncludeDeleted: req.IncludeDeleted,
+		SortBy:         req.Sort,
+		SortDesc:       req.Order == "desc",
+		Limit:          req.Limit,
+		Offset:         req.Offset,
+	}
+	if req.Cursor != "" {
+		cursor, err := domain.DecodeTodoCursor(req.Cursor)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		query.Cursor = cursor
+	}
+
+	page, err := h.svc.FindAll(c.Request.Context(), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+
+	middleware.SetPagination(c, middleware.Pagination{
+		Total:      page.Total,
+		Limit:      page.Limit,
+		Offset:     query.Offset,
+		NextCursor: page.NextCursor,
+	})
+	// Always return an array, even for an empty page.
+	todos := page.Items
+	if todos == nil {
+		todos = []domain.Todo{}
+	}
 	c.JSON(http.StatusOK, todos)
 }
 
 // FindByID handles GET /todos/:id
 // @Summary Get a todo
-// @Description Get a todo by ID
+// @Description Get a todo by ID. Todos owned by other users are reported as not found.
+// @Description The response carries an ETag; send it back in If-None-Match to get 304 when unchanged.
 // @Tags todos
 // @Produce  json
 // @Security BearerAuth
+// @Security APIKeyAuth
 // @Param id path string true "Todo ID"
+// @Param If-None-Match header string false "ETag of a cached copy"
 // @Success 200 {object} domain.Todo
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Header 200 {string} ETag "Current version of the todo"
+// @Success 304 "Not Modified"
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 404 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
 // @Router /todos/{id} [get]
 func (h *TodoHandler) FindByID(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := uuid.Parse(idParam)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		c.Error(domain.ErrInvalidTodoID)
 		return
 	}
 
-	todo, err := h.svc.FindByID(id)
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	todo, err := h.svc.FindByID(c.Request.Context(), id, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	if todo == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		c.Error(domain.ErrTodoNotFound)
+		return
+	}
+
+	setTodoETag(c, todo)
+	if ifNoneMatch(c, todo) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
@@ -113,97 +199,235 @@ func (h *TodoHandler) FindByID(c *gin.Context) {
 }
 
 // Update handles PUT /todos/:id
-// @Summary Update a todo
-// @Description Update a todo by ID
+// @Summary Replace a todo
+// @Description Replace the editable fields of a todo by ID. Omitted fields are reset to their
+// @Description zero values; use PATCH to change only some fields.
 // @Tags todos
 // @Accept  json
 // @Produce  json
 // @Security BearerAuth
+// @Security APIKeyAuth
 // @Param id path string true "Todo ID"
 // @Param todo body UpdateTodoRequest true "Update Todo"
+// @Param If-Match header string false "ETag the update is based on"
 // @Success 200 {object} domain.Todo
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Header 200 {string} ETag "New version of the todo"
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 404 {object} middleware.ErrorResponse
+// @Failure 412 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
 // @Router /todos/{id} [put]
 func (h *TodoHandler) Update(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := uuid.Parse(idParam)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		c.Error(domain.ErrInvalidTodoID)
 		return
 	}
 
 	var req UpdateTodoRequest
 
-	// Note: For partial updates, strictly you might want PATCH and pointers,
-	// but for simplicity in this boiler plate we accept zero values.
+	// PUT replaces the whole todo, so zero values are intentional here; partial updates go through Patch.
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	version, err := h.ifMatchVersion(c, id, userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	todo, err := h.svc.Update(c.Request.Context(), id, userID, version, req.Title, req.Description, req.Completed)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	setTodoETag(c, todo)
+	c.JSON(http.StatusOK, todo)
+}
+
+// Patch handles PATCH /todos/:id
+// @Summary Partially update a todo
+// @Description Change only the fields present in the body. Send a JSON Merge Patch (RFC 7396) as
+// @Description application/merge-patch+json or application/json, where null resets a field, or a
+// @Description JSON Patch (RFC 6902) as application/json-patch+json using add, replace, remove and
+// @Description test on /title, /description and /completed. Only /description can be removed, which
+// @Description clears it; removing /title or /completed is refused with 422.
+// @Tags todos
+// @Accept  json
+// @Accept  application/merge-patch+json
+// @Accept  application/json-patch+json
+// @Produce  json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param id path string true "Todo ID"
+// @Param todo body PatchTodoRequest true "Merge patch, or an array of JSONPatchOperation"
+// @Param If-Match header string false "ETag the patch is based on"
+// @Success 200 {object} domain.Todo
+// @Header 200 {string} ETag "New version of the todo"
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 404 {object} middleware.ErrorResponse
+// @Failure 409 {object} middleware.ErrorResponse
+// @Failure 412 {object} middleware.ErrorResponse
+// @Failure 415 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
+// @Router /todos/{id} [patch]
+func (h *TodoHandler) Patch(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := uuid.Parse(idParam)
+	if err != nil {
+		c.Error(domain.ErrInvalidTodoID)
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	version, err := h.ifMatchVersion(c, id, userID)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	todo, err := h.svc.Update(id, req.Title, req.Description, req.Completed)
+	var patch domain.TodoPatch
+	switch c.ContentType() {
+	case mimeMergePatch, gin.MIMEJSON:
+		patch, err = parseMergePatch(body)
+	case mimeJSONPatch:
+		// JSON Patch operations (notably "test") are evaluated against the current todo.
+		current, findErr := h.svc.FindByID(c.Request.Context(), id, userID)
+		if findErr != nil {
+			c.Error(findErr)
+			return
+		}
+		if current == nil {
+			c.Error(domain.ErrTodoNotFound)
+			return
+		}
+		if version == 0 {
+			// Pin the write to the version the operations were evaluated against.
+			version = current.Version
+		}
+		patch, err = applyJSONPatch(*current, body)
+	default:
+		c.Error(errUnsupportedPatchType)
+		return
+	}
 	if err != nil {
-		// In a real app we would check for specific errors like 'not found'
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
+	todo, err := h.svc.Patch(c.Request.Context(), id, userID, version, patch)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	setTodoETag(c, todo)
 	c.JSON(http.StatusOK, todo)
 }
 
 // Delete handles DELETE /todos/:id
 // @Summary Delete a todo
-// @Description Delete a todo by ID
+// @Description Soft-delete a todo by ID. It can be restored until the retention period purges it.
 // @Tags todos
 // @Produce  json
 // @Security BearerAuth
+// @Security APIKeyAuth
 // @Param id path string true "Todo ID"
+// @Param If-Match header string false "ETag the deletion is based on"
 // @Success 204 "No Content"
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 404 {object} middleware.ErrorResponse
+// @Failure 412 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
 // @Router /todos/{id} [delete]
 func (h *TodoHandler) Delete(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := uuid.Parse(idParam)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		c.Error(domain.ErrInvalidTodoID)
 		return
 	}
 
-	if err := h.svc.Delete(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	version, err := h.ifMatchVersion(c, id, userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	err = h.svc.Delete(c.Request.Context(), id, userID, version)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
 
-// DeleteAll handles DELETE /todos
-// @Summary Delete all todos
-// @Description Delete all todos in the database (Requires API Key)
+// Restore handles POST /todos/:id/restore
+// @Summary Restore a deleted todo
+// @Description Undo the soft deletion of a todo. Restoring a todo that is not deleted is a no-op.
 // @Tags todos
 // @Produce  json
 // @Security BearerAuth
-// @Param X-API-KEY header string true "API Key"
-// @Success 204 "No Content"
-// @Failure 401 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /todos [delete]
-func (h *TodoHandler) DeleteAll(c *gin.Context) {
-	// API Key Authentication
-	apiKey := c.GetHeader("X-API-KEY")
-	if apiKey == "" {
-		apiKey = c.Query("api-key") // fallback to query param if needed
+// @Security APIKeyAuth
+// @Param id path string true "Todo ID"
+// @Success 200 {object} domain.Todo
+// @Header 200 {string} ETag "New version of the todo"
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 404 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
+// @Router /todos/{id}/restore [post]
+func (h *TodoHandler) Restore(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := uuid.Parse(idParam)
+	if err != nil {
+		c.Error(domain.ErrInvalidTodoID)
+		return
 	}
 
-	if apiKey != "delete" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing API Key"})
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	todo, err := h.svc.Restore(c.Request.Context(), id, userID)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	if err := h.svc.DeleteAll(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	setTodoETag(c, todo)
+	c.JSON(http.StatusOK, todo)
+}
+
+// DeleteAll handles DELETE /todos
+// @Summary Delete all todos
+// @Description Soft-delete all todos of every user. Admins only.
+// @Tags todos
+// @Produce  json
+// @Security BearerAuth
+// @Success 204 "No Content"
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
+// @Router /todos [delete]
+func (h *TodoHandler) DeleteAll(c *gin.Context) {
+	// The route requires domain.PermissionDeleteAllTodos, see cmd/api.
+	if err := h.svc.DeleteAll(c.Request.Context()); err != nil {
+		c.Error(err)
 		return
 	}
 	c.Status(http.StatusNoContent)
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+	"github.com/prachaya-orr/relearn-golang/internal/repository"
+	"github.com/prachaya-orr/relearn-golang/internal/repository/repositorytest"
+	"github.com/prachaya-orr/relearn-golang/internal/service"
+)
+
+// TestTodoHandlerAbortsQueries checks that the request's context reaches the
+// database: a query that hangs ends with the request, not on its own.
+func TestTodoHandlerAbortsQueries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := repositorytest.NewBlockingDB(t)
+	h := NewTodoHandler(service.NewTodoService(repository.NewTodoRepository(db.DB)))
+
+	r := gin.New()
+	r.Use(middleware.ErrorHandler(), middleware.Timeout(50*time.Millisecond, nil))
+	r.GET("/todos", func(c *gin.Context) { c.Set("userID", uuid.New()) }, h.FindAll)
+
+	t.Run("Timeout", func(t *testing.T) {
+		start := time.Now()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos", nil))
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d: %s", w.Code, w.Body)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected the query to be abandoned at the deadline, took %s", elapsed)
+		}
+	})
+
+	t.Run("Client Gone", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos", nil).WithContext(ctx))
+
+		if w.Code != 499 {
+			t.Errorf("expected 499, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	if db.Queries() == 0 {
+		t.Error("expected the handler to query the database")
+	}
+}
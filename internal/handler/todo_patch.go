@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+)
+
+// Content types accepted by PATCH /todos/:id
+const (
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+)
+
+var errUnsupportedPatchType = &middleware.HTTPError{
+	Status:  http.StatusUnsupportedMediaType,
+	Code:    "unsupported_media_type",
+	Message: "PATCH accepts " + mimeMergePatch + ", " + mimeJSONPatch + " or application/json",
+}
+
+// JSONPatchOperation is a single RFC 6902 operation
+type JSONPatchOperation struct {
+	Op    string          `json:"op" example:"replace"`
+	Path  string          `json:"path" example:"/completed"`
+	Value json.RawMessage `json:"value,omitempty" swaggertype:"object"`
+}
+
+// todoDocument is the patchable JSON representation of a todo
+type todoDocument struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Completed   bool   `json:"completed"`
+}
+
+// parseMergePatch reads an RFC 7396 merge patch. Members that are absent stay
+// untouched and null resets a field, so "completed": false and a missing
+// "completed" mean different things.
+func parseMergePatch(body []byte) (domain.TodoPatch, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		return domain.TodoPatch{}, fmt.Errorf("%w: body must be a JSON object", domain.ErrInvalidTodoPatch)
+	}
+
+	var patch domain.TodoPatch
+	for name, raw := range members {
+		isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+		switch name {
+		case "title":
+			var title string
+			if isNull {
+				return domain.TodoPatch{}, domain.ErrTodoTitleRequired
+			}
+			if err := json.Unmarshal(raw, &title); err != nil {
+				return domain.TodoPatch{}, fmt.Errorf("%w: title must be a string", domain.ErrInvalidTodoPatch)
+			}
+			patch.Title = &title
+		case "description":
+			var description string
+			if !isNull {
+				if err := json.Unmarshal(raw, &description); err != nil {
+					return domain.TodoPatch{}, fmt.Errorf("%w: description must be a string", domain.ErrInvalidTodoPatch)
+				}
+			}
+			patch.Description = &description
+		case "completed":
+			var completed bool
+			if !isNull {
+				if err := json.Unmarshal(raw, &completed); err != nil {
+					return domain.TodoPatch{}, fmt.Errorf("%w: completed must be a boolean", domain.ErrInvalidTodoPatch)
+				}
+			}
+			patch.Completed = &completed
+		default:
+			return domain.TodoPatch{}, fmt.Errorf("%w: field %q cannot be patched", domain.ErrInvalidTodoPatch, name)
+		}
+	}
+	return patch, nil
+}
+
+// applyJSONPatch runs RFC 6902 operations against the current todo and returns
+// the resulting changes. Only add, replace, remove and test are supported, on
+// the /title, /description and /completed members. Of those only /description
+// is optional, so it is the only one that can be removed.
+func applyJSONPatch(current domain.Todo, body []byte) (domain.TodoPatch, error) {
+	var ops []JSONPatchOperation
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return domain.TodoPatch{}, fmt.Errorf("%w: body must be an array of operations", domain.ErrInvalidTodoPatch)
+	}
+
+	doc := todoDocument{Title: current.Title, Description: current.Description, Completed: current.Completed}
+	touched := map[string]bool{}
+
+	for i, op := range ops {
+		switch op.Op {
+		case "add", "replace":
+			if op.Value == nil {
+				return domain.TodoPatch{}, fmt.Errorf("%w: operation %d is missing a value", domain.ErrInvalidTodoPatch, i)
+			}
+			if err := setDocumentMember(&doc, op.Path, op.Value); err != nil {
+				return domain.TodoPatch{}, fmt.Errorf("%w: operation %d: %v", domain.ErrInvalidTodoPatch, i, err)
+			}
+		case "remove":
+			switch op.Path {
+			case "/title":
+				return domain.TodoPatch{}, domain.ErrTodoTitleRequired
+			case "/completed":
+				return domain.TodoPatch{}, fmt.Errorf("%w: operation %d: /completed is required and cannot be removed", domain.ErrInvalidTodoPatch, i)
+			}
+			if err := setDocumentMember(&doc, op.Path, nil); err != nil {
+				return domain.TodoPatch{}, fmt.Errorf("%w: operation %d: %v", domain.ErrInvalidTodoPatch, i, err)
+			}
+		case "test":
+			matches, err := documentMemberEquals(doc, op.Path, op.Value)
+			if err != nil {
+				return domain.TodoPatch{}, fmt.Errorf("%w: operation %d: %v", domain.ErrInvalidTodoPatch, i, err)
+			}
+			if !matches {
+				return domain.TodoPatch{}, fmt.Errorf("%w: operation %d on %s", domain.ErrTodoPatchTestFailed, i, op.Path)
+			}
+			continue
+		default:
+			return domain.TodoPatch{}, fmt.Errorf("%w: operation %d: op %q is not supported", domain.ErrInvalidTodoPatch, i, op.Op)
+		}
+		touched[op.Path] = true
+	}
+
+	var patch domain.TodoPatch
+	if touched["/title"] {
+		patch.Title = &doc.Title
+	}
+	if touched["/description"] {
+		patch.Description = &doc.Description
+	}
+	if touched["/completed"] {
+		patch.Completed = &doc.Completed
+	}
+	return patch, nil
+}
+
+// setDocumentMember sets the member at path, or resets it to its zero value when value is nil
+func setDocumentMember(doc *todoDocument, path string, value json.RawMessage) error {
+	var target any
+	switch path {
+	case "/title":
+		doc.Title = ""
+		target = &doc.Title
+	case "/description":
+		doc.Description = ""
+		target = &doc.Description
+	case "/completed":
+		doc.Completed = false
+		target = &doc.Completed
+	default:
+		return fmt.Errorf("path %q cannot be patched", path)
+	}
+	if value == nil {
+		return nil
+	}
+	if err := json.Unmarshal(value, target); err != nil {
+		return fmt.Errorf("value for %s has the wrong type", path)
+	}
+	return nil
+}
+
+// documentMemberEquals compares the member at path with value as JSON
+func documentMemberEquals(doc todoDocument, path string, value json.RawMessage) (bool, error) {
+	var current any
+	switch path {
+	case "/title":
+		current = doc.Title
+	case "/description":
+		current = doc.Description
+	case "/completed":
+		current = doc.Completed
+	default:
+		return false, fmt.Errorf("path %q cannot be tested", path)
+	}
+
+	var expected any
+	if err := json.Unmarshal(value, &expected); err != nil {
+		return false, fmt.Errorf("test value is not valid JSON")
+	}
+	return expected == current, nil
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+func TestParseMergePatch(t *testing.T) {
+	t.Run("Absent vs Null vs Value", func(t *testing.T) {
+		patch, err := parseMergePatch([]byte(`{"description": null, "completed": false}`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if patch.Title != nil {
+			t.Error("expected absent title to stay nil")
+		}
+		if patch.Description == nil || *patch.Description != "" {
+			t.Error("expected null description to reset it")
+		}
+		if patch.Completed == nil || *patch.Completed {
+			t.Error("expected completed to be explicitly false")
+		}
+	})
+
+	t.Run("Null Title", func(t *testing.T) {
+		_, err := parseMergePatch([]byte(`{"title": null}`))
+		if !errors.Is(err, domain.ErrTodoTitleRequired) {
+			t.Errorf("expected ErrTodoTitleRequired, got %v", err)
+		}
+	})
+
+	t.Run("Read-Only Field", func(t *testing.T) {
+		_, err := parseMergePatch([]byte(`{"user_id": "someone-else"}`))
+		if !errors.Is(err, domain.ErrInvalidTodoPatch) {
+			t.Errorf("expected ErrInvalidTodoPatch, got %v", err)
+		}
+	})
+
+	t.Run("Wrong Type", func(t *testing.T) {
+		_, err := parseMergePatch([]byte(`{"completed": "yes"}`))
+		if !errors.Is(err, domain.ErrInvalidTodoPatch) {
+			t.Errorf("expected ErrInvalidTodoPatch, got %v", err)
+		}
+	})
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	current := domain.Todo{Title: "Buy milk", Description: "Whole", Completed: false}
+
+	t.Run("Replace And Remove", func(t *testing.T) {
+		patch, err := applyJSONPatch(current, []byte(`[
+			{"op": "test", "path": "/title", "value": "Buy milk"},
+			{"op": "replace", "path": "/completed", "value": true},
+			{"op": "remove", "path": "/description"}
+		]`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if patch.Title != nil {
+			t.Error("expected untouched title to stay nil")
+		}
+		if patch.Completed == nil || !*patch.Completed {
+			t.Error("expected completed to be set")
+		}
+		if patch.Description == nil || *patch.Description != "" {
+			t.Error("expected description to be removed")
+		}
+	})
+
+	t.Run("Failed Test", func(t *testing.T) {
+		_, err := applyJSONPatch(current, []byte(`[
+			{"op": "test", "path": "/completed", "value": true},
+			{"op": "replace", "path": "/title", "value": "Too late"}
+		]`))
+		if !errors.Is(err, domain.ErrTodoPatchTestFailed) {
+			t.Errorf("expected ErrTodoPatchTestFailed, got %v", err)
+		}
+	})
+
+	t.Run("Remove Title", func(t *testing.T) {
+		_, err := applyJSONPatch(current, []byte(`[{"op": "remove", "path": "/title"}]`))
+		if !errors.Is(err, domain.ErrTodoTitleRequired) {
+			t.Errorf("expected ErrTodoTitleRequired, got %v", err)
+		}
+	})
+
+	t.Run("Remove Completed", func(t *testing.T) {
+		_, err := applyJSONPatch(current, []byte(`[{"op": "remove", "path": "/completed"}]`))
+		if !errors.Is(err, domain.ErrInvalidTodoPatch) {
+			t.Errorf("expected ErrInvalidTodoPatch, got %v", err)
+		}
+	})
+
+	t.Run("Unsupported Operation", func(t *testing.T) {
+		_, err := applyJSONPatch(current, []byte(`[{"op": "move", "from": "/title", "path": "/description"}]`))
+		if !errors.Is(err, domain.ErrInvalidTodoPatch) {
+			t.Errorf("expected ErrInvalidTodoPatch, got %v", err)
+		}
+	})
+
+	t.Run("Unknown Path", func(t *testing.T) {
+		_, err := applyJSONPatch(current, []byte(`[{"op": "replace", "path": "/user_id", "value": "x"}]`))
+		if !errors.Is(err, domain.ErrInvalidTodoPatch) {
+			t.Errorf("expected ErrInvalidTodoPatch, got %v", err)
+		}
+	})
+}
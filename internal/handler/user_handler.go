@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/prachaya-orr/relearn-golang/internal/domain"
 )
 
@@ -22,25 +23,28 @@ type AuthRequest struct {
 
 // SignUp handles POST /signup
 // @Summary Register a new user
-// @Description Register a new user with email and password
+// @Description Register a new user with email and password. A link to verify the email is mailed; login works once it is followed.
+// @Description A password that breaks the password policy is refused with weak_password, listing the broken rules under violations.password.
 // @Tags auth
 // @Accept  json
 // @Produce  json
 // @Param user body AuthRequest true "User credentials"
 // @Success 201 {object} domain.User
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 409 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
 // @Router /signup [post]
 func (h *UserHandler) SignUp(c *gin.Context) {
 	var req AuthRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	user, err := h.svc.SignUp(req.Email, req.Password)
+	user, err := h.svc.SignUp(c.Request.Context(), req.Email, req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -49,25 +53,72 @@ func (h *UserHandler) SignUp(c *gin.Context) {
 
 // Login handles POST /login
 // @Summary Login user
-// @Description Login with email and password to get tokens
+// @Description Login with email and password to get tokens.
+// @Description With two-factor authentication on, the response only has an mfa_token, to exchange with a code at POST /login/mfa.
+// @Description Repeated failures for an email or from an IP must wait before trying again (429); an email with too many failures is locked for a while (423).
+// @Description Both responses carry Retry-After in seconds.
 // @Tags auth
 // @Accept  json
 // @Produce  json
 // @Param user body AuthRequest true "User credentials"
 // @Success 200 {object} domain.TokenPair
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 403 {object} middleware.ErrorResponse
+// @Failure 423 {object} middleware.ErrorResponse
+// @Header 423 {integer} Retry-After "Seconds until the lockout ends"
+// @Failure 429 {object} middleware.ErrorResponse
+// @Header 429 {integer} Retry-After "Seconds until the next attempt is allowed"
 // @Router /login [post]
 func (h *UserHandler) Login(c *gin.Context) {
 	var req AuthRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	tokens, err := h.svc.Login(req.Email, req.Password)
+	tokens, err := h.svc.Login(c.Request.Context(), req.Email, req.Password, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// LoginMFARequest represents the request body for the second step of a login
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	// Code is from the authenticator app, or one of the recovery codes.
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// LoginMFA handles POST /login/mfa
+// @Summary Complete a two-factor login
+// @Description Exchange the mfa_token from POST /login and a TOTP or recovery code for tokens.
+// @Description Wrong codes count as failed logins and are throttled the same way.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param login body LoginMFARequest true "MFA token and code"
+// @Success 200 {object} domain.TokenPair
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 423 {object} middleware.ErrorResponse
+// @Header 423 {integer} Retry-After "Seconds until the lockout ends"
+// @Failure 429 {object} middleware.ErrorResponse
+// @Header 429 {integer} Retry-After "Seconds until the next attempt is allowed"
+// @Router /login/mfa [post]
+func (h *UserHandler) LoginMFA(c *gin.Context) {
+	var req LoginMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	tokens, err := h.svc.LoginMFA(c.Request.Context(), req.MFAToken, req.Code, c.ClientIP())
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -87,21 +138,157 @@ type RefreshTokenRequest struct {
 // @Produce  json
 // @Param token body RefreshTokenRequest true "Refresh Token"
 // @Success 200 {object} domain.TokenPair
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
 // @Router /refresh-token [post]
 func (h *UserHandler) RefreshToken(c *gin.Context) {
 	var req RefreshTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	tokens, err := h.svc.RefreshToken(req.RefreshToken)
+	tokens, err := h.svc.RefreshToken(c.Request.Context(), req.RefreshToken)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, tokens)
 }
+
+// Logout handles POST /logout
+// @Summary Logout
+// @Description Revoke the refresh token along with every refresh and access token issued since the same login
+// @Tags auth
+// @Accept  json
+// @Param token body RefreshTokenRequest true "Refresh Token"
+// @Success 204
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 401 {object} middleware.ErrorResponse
+// @Router /logout [post]
+func (h *UserHandler) Logout(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	if err := h.svc.Logout(c.Request.Context(), req.RefreshToken); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// LogoutAll handles POST /logout-all
+// @Summary Logout from all devices
+// @Description Revoke every refresh and access token of the current user
+// @Tags auth
+// @Security BearerAuth
+// @Success 204
+// @Failure 401 {object} middleware.ErrorResponse
+// @Failure 500 {object} middleware.ErrorResponse
+// @Router /logout-all [post]
+func (h *UserHandler) LogoutAll(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	if err := h.svc.LogoutAll(c.Request.Context(), userID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// TokenRequest carries a token mailed to the user
+type TokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyEmail handles POST /verify-email
+// @Summary Verify email address
+// @Description Redeem the token from the link mailed at sign-up, or from the link mailed to a new address by PATCH /me, which then becomes the email.
+// @Description Login is refused until the email is verified.
+// @Tags auth
+// @Accept  json
+// @Param token body TokenRequest true "Verification token"
+// @Success 204
+// @Failure 400 {object} middleware.ErrorResponse
+// @Router /verify-email [post]
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	var req TokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	if err := h.svc.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ForgotPasswordRequest represents the request body for asking a password reset link
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required" example:"test@example.com"`
+}
+
+// ForgotPassword handles POST /password/forgot
+// @Summary Request a password reset
+// @Description Mail a password reset link. The answer is the same whether the email has an account or not.
+// @Tags auth
+// @Accept  json
+// @Param request body ForgotPasswordRequest true "Account email"
+// @Success 202
+// @Failure 400 {object} middleware.ErrorResponse
+// @Router /password/forgot [post]
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	if err := h.svc.ForgotPassword(c.Request.Context(), req.Email); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// ResetPasswordRequest represents the request body for choosing a new password
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required" example:"new-password123"`
+}
+
+// ResetPassword handles POST /password/reset
+// @Summary Reset password
+// @Description Redeem a password reset token and set a new password. Every session of the user is signed out.
+// @Description The new password has to meet the password policy; when it doesn't, the token stays valid.
+// @Tags auth
+// @Accept  json
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 204
+// @Failure 400 {object} middleware.ErrorResponse
+// @Failure 422 {object} middleware.ErrorResponse
+// @Router /password/reset [post]
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	if err := h.svc.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
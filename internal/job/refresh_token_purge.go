@@ -0,0 +1,40 @@
+package job
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// RunRefreshTokenPurge deletes the records of expired refresh tokens, once at
+// start and then every interval, until ctx is cancelled.
+func RunRefreshTokenPurge(ctx context.Context, tokens domain.RefreshTokenRepository, interval time.Duration) {
+	purge := func() {
+		purged, err := tokens.PurgeExpired(ctx, time.Now())
+		if err != nil {
+			if ctx.Err() != nil {
+				return // stopped mid-purge; the rest goes next time
+			}
+			slog.ErrorContext(ctx, "refresh token purge failed", "error", err)
+			return
+		}
+		if purged > 0 {
+			slog.InfoContext(ctx, "purged expired refresh tokens", "count", purged)
+		}
+	}
+
+	purge()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purge()
+		}
+	}
+}
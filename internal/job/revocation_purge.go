@@ -0,0 +1,40 @@
+package job
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// RunRevocationPurge deletes the revocations of expired access tokens, once at
+// start and then every interval, until ctx is cancelled.
+func RunRevocationPurge(ctx context.Context, revocations domain.TokenRevocationStore, interval time.Duration) {
+	purge := func() {
+		purged, err := revocations.PurgeExpired(ctx, time.Now())
+		if err != nil {
+			if ctx.Err() != nil {
+				return // stopped mid-purge; the rest goes next time
+			}
+			slog.ErrorContext(ctx, "revocation purge failed", "error", err)
+			return
+		}
+		if purged > 0 {
+			slog.InfoContext(ctx, "purged revocations of expired tokens", "count", purged)
+		}
+	}
+
+	purge()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purge()
+		}
+	}
+}
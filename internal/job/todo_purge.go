@@ -0,0 +1,40 @@
+package job
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// RunTodoPurge permanently removes todos that have been soft-deleted for longer
+// than retention, once at start and then every interval, until ctx is cancelled.
+func RunTodoPurge(ctx context.Context, svc domain.TodoService, interval, retention time.Duration) {
+	purge := func() {
+		purged, err := svc.PurgeDeleted(ctx, retention)
+		if err != nil {
+			if ctx.Err() != nil {
+				return // stopped mid-purge; the rest goes next time
+			}
+			slog.ErrorContext(ctx, "todo purge failed", "error", err)
+			return
+		}
+		if purged > 0 {
+			slog.InfoContext(ctx, "purged deleted todos", "count", purged, "retention", retention.String())
+		}
+	}
+
+	purge()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purge()
+		}
+	}
+}
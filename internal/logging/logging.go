@@ -0,0 +1,93 @@
+// Package logging sets up the API's structured logs, written with log/slog.
+// Every line logged with a request's context carries the request's ID, its
+// trace ID when it has one and, once it is known, the ID of the user making it.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/tracing"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	userIDKey
+)
+
+// WithRequestID returns a copy of ctx whose logs carry the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID in ctx, or "" when there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithUserID returns a copy of ctx whose logs carry the user ID id.
+func WithUserID(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, userIDKey, id)
+}
+
+// New returns a logger writing to w at the configured level and format.
+func New(w io.Writer, cfg config.LogConfig) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.Level)) // checked when the config was loaded
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler = slog.NewJSONHandler(w, opts)
+	if cfg.Format == config.LogText {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// NewGormLogger logs GORM's failed queries as errors and those slower than
+// the configured threshold as warnings; at debug level, every query. The
+// query's values are left out: they include password hashes and emails.
+func NewGormLogger(logger *slog.Logger, cfg config.LogConfig) gormlogger.Interface {
+	level := gormlogger.Warn
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		level = gormlogger.Info
+	}
+	return gormlogger.NewSlogLogger(logger, gormlogger.Config{
+		SlowThreshold:             cfg.SlowQueryThreshold,
+		LogLevel:                  level,
+		IgnoreRecordNotFoundError: true,
+		ParameterizedQueries:      true,
+	})
+}
+
+// contextHandler adds the request, trace and user IDs found in the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if id := tracing.TraceID(ctx); id != "" {
+		r.AddAttrs(slog.String("trace_id", id))
+	}
+	if id, ok := ctx.Value(userIDKey).(uuid.UUID); ok {
+		r.AddAttrs(slog.String("user_id", id.String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
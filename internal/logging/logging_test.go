@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/repository/repositorytest"
+	"gorm.io/gorm"
+)
+
+// lines decodes the JSON lines logged to buf
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("expected a JSON line, got %q", line)
+		}
+		out = append(out, record)
+	}
+	return out
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, config.LogConfig{Level: "info", Format: config.LogJSON})
+	userID := uuid.New()
+	ctx := WithUserID(WithRequestID(context.Background(), "req-1"), userID)
+
+	logger.InfoContext(ctx, "hello", "n", 1)
+	logger.DebugContext(ctx, "too detailed")
+	logger.With("job", "purge").Info("no request")
+
+	got := lines(t, &buf)
+	if len(got) != 2 {
+		t.Fatalf("expected debug to be left out, got %v", got)
+	}
+	if got[0]["msg"] != "hello" || got[0]["request_id"] != "req-1" || got[0]["user_id"] != userID.String() {
+		t.Errorf("expected the IDs from the context, got %v", got[0])
+	}
+	if _, ok := got[1]["request_id"]; ok || got[1]["job"] != "purge" {
+		t.Errorf("expected no request ID outside a request, got %v", got[1])
+	}
+	if RequestID(ctx) != "req-1" || RequestID(context.Background()) != "" {
+		t.Error("expected RequestID to read the context")
+	}
+}
+
+func TestGormLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, config.LogConfig{Level: "info", Format: config.LogJSON})
+	db := repositorytest.NewBlockingDB(t).Session(&gorm.Session{Logger: NewGormLogger(logger, config.LogConfig{})})
+
+	// The query hangs until the context is done, and then fails
+	ctx, cancel := context.WithCancel(WithRequestID(context.Background(), "req-2"))
+	cancel()
+	db.WithContext(ctx).Where("email = ?", "secret@example.com").First(&domain.User{})
+
+	got := lines(t, &buf)
+	if len(got) != 1 || got[0]["level"] != "ERROR" || got[0]["request_id"] != "req-2" {
+		t.Fatalf("expected the failed query logged for the request, got %v", got)
+	}
+	if strings.Contains(buf.String(), "secret@example.com") {
+		t.Errorf("expected the query's values to be left out, got %s", buf.String())
+	}
+}
@@ -0,0 +1,28 @@
+// Package mailer delivers the API's emails. SMTP sends them for real; Outbox
+// keeps them, and optionally writes them to disk, for tests and local development.
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/mail"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// format renders msg as an RFC 5322 message. Bodies are plain UTF-8 text.
+func format(from string, msg domain.MailMessage, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", (&mail.Address{Address: msg.To}).String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return b.Bytes()
+}
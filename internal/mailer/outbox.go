@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// Outbox keeps emails instead of sending them. With a directory each email is
+// also written there as an .eml file, which any mail client can open.
+type Outbox struct {
+	mu       sync.Mutex
+	from     string
+	dir      string
+	messages []domain.MailMessage
+}
+
+// NewOutbox creates an outbox writing to dir, or keeping emails in memory only when dir is empty.
+func NewOutbox(from, dir string) *Outbox {
+	return &Outbox{from: from, dir: dir}
+}
+
+func (o *Outbox) Send(msg domain.MailMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, msg)
+	if o.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(o.dir, 0o700); err != nil {
+		return err
+	}
+	now := time.Now()
+	// The address is only there to make the files easy to tell apart.
+	name := fmt.Sprintf("%d-%s.eml", now.UnixNano(), strings.NewReplacer("/", "_", "\\", "_").Replace(msg.To))
+	return os.WriteFile(filepath.Join(o.dir, name), format(o.from, msg, now), 0o600)
+}
+
+// Messages returns the emails sent so far, oldest first.
+func (o *Outbox) Messages() []domain.MailMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]domain.MailMessage(nil), o.messages...)
+}
@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+func TestOutbox(t *testing.T) {
+	dir := t.TempDir()
+	outbox := NewOutbox("Todo App <no-reply@example.com>", dir)
+
+	msg := domain.MailMessage{To: "jane@example.com", Subject: "Vérifiez", Body: "Hello\r\n"}
+	if err := outbox.Send(msg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if got := outbox.Messages(); len(got) != 1 || got[0] != msg {
+		t.Errorf("expected the message to be kept, got %+v", got)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected one .eml file, got %d", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	for _, want := range []string{
+		"From: Todo App <no-reply@example.com>\r\n",
+		"To: <jane@example.com>\r\n",
+		"Subject: =?utf-8?q?V=C3=A9rifiez?=\r\n",
+		"\r\n\r\nHello\r\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected the file to contain %q, got:\n%s", want, data)
+		}
+	}
+}
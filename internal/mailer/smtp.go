@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// SMTP sends emails through an SMTP server. The connection is upgraded with
+// STARTTLS when the server offers it, and credentials are only sent over TLS.
+type SMTP struct {
+	addr   string
+	from   string // header, may carry a display name
+	sender string // envelope address
+	auth   smtp.Auth
+}
+
+// NewSMTP creates a mailer for the server in cfg. cfg is expected to be
+// validated already (config.Load does).
+func NewSMTP(cfg config.MailConfig) (*SMTP, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, err
+	}
+	m := &SMTP{
+		addr:   net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		from:   from.String(),
+		sender: from.Address,
+	}
+	if cfg.SMTPUsername != "" {
+		m.auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	return m, nil
+}
+
+func (m *SMTP) Send(msg domain.MailMessage) error {
+	return smtp.SendMail(m.addr, m.auth, m.sender, []string{msg.To}, format(m.from, msg, time.Now()))
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/gormhooks"
+	"gorm.io/gorm"
+)
+
+// queryStartKey is where a query's start time waits for the query to finish.
+const queryStartKey = "metrics:query_start"
+
+// gormPlugin times every query GORM runs.
+type gormPlugin struct {
+	metrics *Metrics
+}
+
+// GormPlugin returns a GORM plugin recording each query's duration; register it with db.Use.
+func (m *Metrics) GormPlugin() gorm.Plugin {
+	return gormPlugin{metrics: m}
+}
+
+func (gormPlugin) Name() string {
+	return "metrics"
+}
+
+func (p gormPlugin) Initialize(db *gorm.DB) error {
+	return gormhooks.Register(db, "metrics", func(operation string) (func(*gorm.DB), func(*gorm.DB)) {
+		return start, p.observe(operation)
+	})
+}
+
+func start(db *gorm.DB) {
+	db.InstanceSet(queryStartKey, time.Now())
+}
+
+func (p gormPlugin) observe(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		started, ok := db.InstanceGet(queryStartKey)
+		if !ok {
+			return
+		}
+		p.metrics.ObserveQuery(operation, db.Statement.Table, time.Since(started.(time.Time)))
+	}
+}
@@ -0,0 +1,110 @@
+// Package metrics keeps the API's Prometheus metrics: HTTP requests, sign-ins
+// and token refreshes, database queries and the connection pool. They are
+// registered with a registry of their own, served at /metrics.
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// queryBuckets are finer than the default buckets: most queries take milliseconds.
+var queryBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+// Metrics holds the collectors the API updates.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	logins          *prometheus.CounterVec
+	refreshes       *prometheus.CounterVec
+	queryDuration   *prometheus.HistogramVec
+}
+
+// New creates the metrics, along with the Go runtime and process ones.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests answered, by method, route template and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time taken to answer HTTP requests, by method, route template and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_logins_total",
+			Help: `Sign-in attempts, by method (password, mfa or external) and result: "success", "mfa_required", or the error code.`,
+		}, []string{"method", "result"}),
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_token_refreshes_total",
+			Help: `Refresh token rotations, by result: "success" or the error code.`,
+		}, []string{"result"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "Time taken by database queries, by operation and table, failed or not.",
+			Buckets: queryBuckets,
+		}, []string{"operation", "table"}),
+	}
+	m.registry.MustRegister(
+		m.requests, m.requestDuration, m.logins, m.refreshes, m.queryDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Registry is where the metrics are registered, for reading them in tests.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// RegisterDB reports the connection pool's statistics from db.Stats(),
+// labelled with name.
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveRequest counts an answered request. route is the route template,
+// e.g. "/todos/:id", so that the labels don't grow with every ID.
+func (m *Metrics) ObserveRequest(method, route string, status int, elapsed time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(method, route, code).Inc()
+	m.requestDuration.WithLabelValues(method, route, code).Observe(elapsed.Seconds())
+}
+
+// ObserveQuery records how long a database query took.
+func (m *Metrics) ObserveQuery(operation, table string, elapsed time.Duration) {
+	m.queryDuration.WithLabelValues(operation, table).Observe(elapsed.Seconds())
+}
+
+// result labels the outcome of a sign-in or refresh; domain error codes are a
+// fixed set, so they make bounded labels.
+func result(tokens *domain.TokenPair, err error) string {
+	var domainErr *domain.Error
+	switch {
+	case err == nil && tokens != nil && tokens.MFAToken != "":
+		return "mfa_required"
+	case err == nil:
+		return "success"
+	case errors.As(err, &domainErr):
+		return domainErr.Code
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,136 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/metrics"
+	"github.com/prachaya-orr/relearn-golang/internal/repository/repositorytest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// loginService answers every sign-in and refresh with the same result
+type loginService struct {
+	domain.UserService
+	tokens *domain.TokenPair
+	err    error
+}
+
+func (s *loginService) Login(context.Context, string, string, string) (*domain.TokenPair, error) {
+	return s.tokens, s.err
+}
+
+func (s *loginService) LoginMFA(context.Context, string, string, string) (*domain.TokenPair, error) {
+	return s.tokens, s.err
+}
+
+func (s *loginService) RefreshToken(context.Context, string) (*domain.TokenPair, error) {
+	return s.tokens, s.err
+}
+
+func TestInstrumentUserService(t *testing.T) {
+	ctx := context.Background()
+	m := metrics.New()
+	stub := &loginService{}
+	svc := m.InstrumentUserService(stub)
+
+	stub.tokens, stub.err = &domain.TokenPair{AccessToken: "access", RefreshToken: "refresh"}, nil
+	svc.Login(ctx, "user@example.com", "password", "")
+	svc.LoginMFA(ctx, "mfa", "123456", "")
+	svc.RefreshToken(ctx, "refresh")
+	stub.tokens, stub.err = &domain.TokenPair{MFAToken: "mfa"}, nil
+	svc.Login(ctx, "user@example.com", "password", "")
+	stub.tokens, stub.err = nil, domain.ErrInvalidCredentials
+	svc.Login(ctx, "user@example.com", "wrong", "")
+	svc.Login(ctx, "user@example.com", "wrong", "")
+	stub.err = domain.ErrRefreshTokenReused
+	svc.RefreshToken(ctx, "refresh")
+	stub.err = errors.New("connection refused")
+	svc.RefreshToken(ctx, "refresh")
+
+	want := `
+# HELP auth_logins_total Sign-in attempts, by method (password, mfa or external) and result: "success", "mfa_required", or the error code.
+# TYPE auth_logins_total counter
+auth_logins_total{method="mfa",result="success"} 1
+auth_logins_total{method="password",result="invalid_credentials"} 2
+auth_logins_total{method="password",result="mfa_required"} 1
+auth_logins_total{method="password",result="success"} 1
+# HELP auth_token_refreshes_total Refresh token rotations, by result: "success" or the error code.
+# TYPE auth_token_refreshes_total counter
+auth_token_refreshes_total{result="error"} 1
+auth_token_refreshes_total{result="refresh_token_reused"} 1
+auth_token_refreshes_total{result="success"} 1
+`
+	if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(want), "auth_logins_total", "auth_token_refreshes_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGormPlugin(t *testing.T) {
+	db := repositorytest.NewBlockingDB(t)
+	m := metrics.New()
+	if err := db.Use(m.GormPlugin()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The query times out, and is timed all the same
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var todos []domain.Todo
+	if err := db.WithContext(ctx).Find(&todos).Error; err == nil {
+		t.Fatal("expected the query to time out")
+	}
+
+	families, err := m.Registry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "db_query_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["operation"] == "query" && labels["table"] == "todos" && metric.GetHistogram().GetSampleCount() == 1 {
+				return
+			}
+		}
+	}
+	t.Error(`expected a query on "todos" to be timed`)
+}
+
+func TestHandler(t *testing.T) {
+	db := repositorytest.NewBlockingDB(t)
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := metrics.New()
+	m.RegisterDB(sqlDB, "postgres")
+	m.ObserveRequest(http.MethodGet, "/todos/:id", http.StatusOK, 30*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/todos/:id",status="200"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/todos/:id",status="200"} 1`,
+		`go_sql_max_open_connections{db_name="postgres"}`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected the metrics to include %s", want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// userService counts sign-ins and token refreshes on the way through to the
+// UserService it wraps.
+type userService struct {
+	domain.UserService
+	metrics *Metrics
+}
+
+// InstrumentUserService returns svc, counting its sign-ins and refreshes.
+func (m *Metrics) InstrumentUserService(svc domain.UserService) domain.UserService {
+	return &userService{UserService: svc, metrics: m}
+}
+
+func (s *userService) Login(ctx context.Context, email, password, clientIP string) (*domain.TokenPair, error) {
+	tokens, err := s.UserService.Login(ctx, email, password, clientIP)
+	s.metrics.logins.WithLabelValues("password", result(tokens, err)).Inc()
+	return tokens, err
+}
+
+func (s *userService) LoginMFA(ctx context.Context, mfaToken, code, clientIP string) (*domain.TokenPair, error) {
+	tokens, err := s.UserService.LoginMFA(ctx, mfaToken, code, clientIP)
+	s.metrics.logins.WithLabelValues("mfa", result(tokens, err)).Inc()
+	return tokens, err
+}
+
+func (s *userService) LoginExternal(ctx context.Context, identity domain.ExternalIdentity) (*domain.TokenPair, error) {
+	tokens, err := s.UserService.LoginExternal(ctx, identity)
+	s.metrics.logins.WithLabelValues("external", result(tokens, err)).Inc()
+	return tokens, err
+}
+
+func (s *userService) RefreshToken(ctx context.Context, refreshToken string) (*domain.TokenPair, error) {
+	tokens, err := s.UserService.RefreshToken(ctx, refreshToken)
+	s.metrics.refreshes.WithLabelValues(result(tokens, err)).Inc()
+	return tokens, err
+}
@@ -1,21 +1,65 @@
 package middleware
 
 import (
-	"fmt"
-	"net/http"
-	"os"
+	"errors"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/logging"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// Errors reported by AuthMiddleware
+var (
+	errAuthHeaderMissing = domain.NewUnauthorizedError("authorization_missing", "Authorization header missing")
+	errAuthHeaderFormat  = domain.NewUnauthorizedError("authorization_malformed", "Invalid authorization header format")
+	errInvalidToken      = domain.NewUnauthorizedError("invalid_token", "Invalid or expired token")
+	errInvalidClaims     = domain.NewUnauthorizedError("invalid_token_claims", "Invalid token claims")
+	errInvalidSubject    = domain.NewUnauthorizedError("invalid_token_subject", "Invalid token subject")
+	errAccessTokenNeeded = domain.NewUnauthorizedError("invalid_token_type", "Invalid token type, access token required")
+	errTokenRevoked      = domain.NewUnauthorizedError("token_revoked", "Token has been revoked")
+	errAPIKeyNotAccepted = domain.NewUnauthorizedError("api_key_not_accepted", "API keys are not accepted here, use an access token")
+)
+
+// abortWithError reports err to ErrorHandler and stops the chain
+func abortWithError(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
+
+// AuthMiddleware accepts unexpired access tokens signed by a key in keys that
+// are not on the revocation list, or an X-API-KEY header that apiKeys
+// resolves. With apiKeys nil only access tokens are accepted, which is what
+// routes that manage the account itself use.
+//
+// Requests made with an API key get the key's scopes instead of a role, so
+// they are limited by RequireScope and never pass RequireRole.
+func AuthMiddleware(keys *token.KeySet, revocations domain.TokenRevocationStore, apiKeys domain.APIKeyService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-KEY"); apiKey != "" {
+			if apiKeys == nil {
+				abortWithError(c, errAPIKeyNotAccepted)
+				return
+			}
+			key, err := apiKeys.Authenticate(c.Request.Context(), apiKey)
+			if err != nil {
+				abortWithError(c, err)
+				return
+			}
+			c.Set("userID", key.UserID)
+			c.Request = c.Request.WithContext(logging.WithUserID(c.Request.Context(), key.UserID))
+			c.Set("apiKeyID", key.ID)
+			c.Set("apiKeyScopes", key.Scopes)
+			c.Next()
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
+			abortWithError(c, errAuthHeaderMissing)
 			return
 		}
 
@@ -26,40 +70,31 @@ func AuthMiddleware() gin.HandlerFunc {
 		} else if len(parts) == 1 {
 			tokenString = parts[0]
 		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+			abortWithError(c, errAuthHeaderFormat)
 			return
 		}
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			secret = "secret"
-		}
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(secret), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		claims := jwt.MapClaims{}
+		parsed, err := keys.Parse(tokenString, token.AudienceAccess, claims)
+		if errors.Is(err, jwt.ErrTokenInvalidAudience) {
+			abortWithError(c, errAccessTokenNeeded)
 			return
 		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		if err != nil || !parsed.Valid {
+			abortWithError(c, errInvalidToken)
 			return
 		}
 
 		// Set User ID to context to be used in handlers
 		// Note: JWT library parses numbers as float64 by default, but UUIDs are strings
-		if sub, ok := claims["sub"].(string); ok {
-			userID, err := uuid.Parse(sub)
-			if err == nil {
-				c.Set("userID", userID)
-			}
+		// Handlers scope every query to this ID, so a token without a usable subject is rejected.
+		sub, _ := claims["sub"].(string)
+		userID, err := uuid.Parse(sub)
+		if err != nil {
+			abortWithError(c, errInvalidSubject)
+			return
 		}
+		c.Set("userID", userID)
+		c.Request = c.Request.WithContext(logging.WithUserID(c.Request.Context(), userID))
 
 		// Ensure it's an access token
 		if claims["type"] != "access" {
@@ -68,11 +103,35 @@ func AuthMiddleware() gin.HandlerFunc {
 			// However for now let's allow if type is strictly "access" or missing (legacy/migration)
 			// Actually, let's strictly enforce "access" since we just implemented it.
 			if typ, ok := claims["type"].(string); ok && typ != "access" {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token type, access token required"})
+				abortWithError(c, errAccessTokenNeeded)
 				return
 			}
 		}
 
+		// A token without a jti could never be revoked, so it is not accepted either.
+		jti, _ := claims["jti"].(string)
+		tokenID, err := uuid.Parse(jti)
+		if err != nil {
+			abortWithError(c, errInvalidClaims)
+			return
+		}
+		revoked, err := revocations.IsRevoked(c.Request.Context(), tokenID)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if revoked {
+			abortWithError(c, errTokenRevoked)
+			return
+		}
+
+		// Tokens issued before roles existed have no role claim; they get the least privileged one.
+		role := domain.RoleUser
+		if claim, ok := claims["role"].(string); ok {
+			role = domain.Role(claim)
+		}
+		c.Set("userRole", role)
+
 		c.Next()
 	}
 }
@@ -0,0 +1,164 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+	"github.com/prachaya-orr/relearn-golang/internal/repository"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
+)
+
+// stubAPIKeys accepts the key "tk_valid" with read access to todos
+type stubAPIKeys struct {
+	domain.APIKeyService
+}
+
+func (stubAPIKeys) Authenticate(_ context.Context, key string) (*domain.APIKey, error) {
+	if key != "tk_valid" {
+		return nil, domain.ErrInvalidAPIKey
+	}
+	return &domain.APIKey{ID: uuid.New(), UserID: uuid.New(), Scopes: domain.Scopes{domain.ScopeTodosRead}}, nil
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	revocations := repository.NewMemoryRevokedTokenStore()
+	revokedID := uuid.New()
+	revocations.Revoke(ctx, revokedID, time.Now().Add(time.Hour))
+
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	key, _ := token.NewSigningKey(private)
+	keys, _ := token.NewKeySet("https://api.example.com", key)
+
+	// Tokens are for the audience their type names, unless the claims say otherwise
+	createToken := func(claims jwt.MapClaims) string {
+		if _, ok := claims["iss"]; !ok {
+			claims["iss"] = keys.Issuer()
+		}
+		if _, ok := claims["aud"]; !ok {
+			claims["aud"] = claims["type"]
+		}
+		claims["sub"] = uuid.NewString()
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		s, _ := keys.Sign(claims)
+		return s
+	}
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  uuid.NewString(),
+		"jti":  uuid.NewString(),
+		"type": "access",
+		"exp":  time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("secret"))
+
+	tests := []struct {
+		name        string
+		token       string
+		apiKey      string
+		sessionOnly bool
+		wantStatus  int
+		wantCode    string
+	}{
+		{
+			name:       "Valid",
+			token:      createToken(jwt.MapClaims{"type": "access", "jti": uuid.NewString()}),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Revoked",
+			token:      createToken(jwt.MapClaims{"type": "access", "jti": revokedID.String()}),
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "token_revoked",
+		},
+		{
+			name:       "Shared Secret",
+			token:      hmacToken,
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "invalid_token",
+		},
+		{
+			name:       "Missing jti",
+			token:      createToken(jwt.MapClaims{"type": "access"}),
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "invalid_token_claims",
+		},
+		{
+			name:       "Other Issuer",
+			token:      createToken(jwt.MapClaims{"iss": "https://other.example.com", "type": "access", "jti": uuid.NewString()}),
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "invalid_token",
+		},
+		{
+			name:       "Refresh Token",
+			token:      createToken(jwt.MapClaims{"type": "refresh", "jti": uuid.NewString()}),
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "invalid_token_type",
+		},
+		{
+			name:       "API Key",
+			apiKey:     "tk_valid",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Invalid API Key",
+			apiKey:     "tk_invalid",
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "invalid_api_key",
+		},
+		{
+			name:        "API Key Not Accepted",
+			apiKey:      "tk_valid",
+			sessionOnly: true,
+			wantStatus:  http.StatusUnauthorized,
+			wantCode:    "api_key_not_accepted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(middleware.ErrorHandler())
+			var apiKeys domain.APIKeyService = stubAPIKeys{}
+			if tt.sessionOnly {
+				apiKeys = nil
+			}
+			r.GET("/", middleware.AuthMiddleware(keys, revocations, apiKeys), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-KEY", tt.apiKey)
+			} else {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+
+			var body middleware.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("expected JSON body, got %q", w.Body.String())
+			}
+			if body.Code != tt.wantCode {
+				t.Errorf("expected code %q, got %q", tt.wantCode, body.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+)
+
+// CORS headers sent for allowed origins
+var (
+	corsAllowMethods  = strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}, ", ")
+	corsAllowHeaders  = strings.Join([]string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "X-API-KEY", "X-Request-ID"}, ", ")
+	corsExposeHeaders = strings.Join([]string{"ETag", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "X-Request-ID"}, ", ")
+	corsMaxAge        = strconv.Itoa(int((10 * time.Minute).Seconds()))
+)
+
+// CORS lets browsers on the configured origins call the API and answers their
+// preflight requests. Without configured origins only same-origin pages can.
+func CORS(cfg config.CORSConfig) gin.HandlerFunc {
+	allowAny := slices.Contains(cfg.AllowedOrigins, "*")
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		if !allowAny && !slices.Contains(cfg.AllowedOrigins, strings.TrimSuffix(origin, "/")) {
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+			h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			h.Set("Access-Control-Max-Age", corsMaxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
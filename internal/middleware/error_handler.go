@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// ErrorResponse is the body written for every failed request
+type ErrorResponse struct {
+	Error  string            `json:"error" example:"todo not found"`
+	Code   string            `json:"code" example:"todo_not_found"`
+	Fields map[string]string `json:"fields,omitempty"`
+	// Violations lists the business rules each field broke, e.g. {"password": ["min_length"]}.
+	Violations map[string][]string `json:"violations,omitempty"`
+}
+
+// HTTPError is a failure that only exists at the HTTP layer, such as an unsupported content type
+type HTTPError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+// statusClientClosedRequest is nginx's status for a request whose client went
+// away before the answer; no one reads it, but it keeps such requests out of the 5xx.
+const statusClientClosedRequest = 499
+
+// statusByKind maps each domain error kind to its HTTP status code
+var statusByKind = map[domain.ErrorKind]int{
+	domain.KindBadRequest:         http.StatusBadRequest,
+	domain.KindValidation:         http.StatusUnprocessableEntity,
+	domain.KindNotFound:           http.StatusNotFound,
+	domain.KindConflict:           http.StatusConflict,
+	domain.KindUnauthorized:       http.StatusUnauthorized,
+	domain.KindPreconditionFailed: http.StatusPreconditionFailed,
+	domain.KindForbidden:          http.StatusForbidden,
+	domain.KindTooManyRequests:    http.StatusTooManyRequests,
+	domain.KindLocked:             http.StatusLocked,
+}
+
+// ErrorHandler renders the last error pushed with c.Error.
+// Handlers and middlewares only report errors; the status code and body are decided here.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 {
+			return
+		}
+
+		ginErr := c.Errors.Last()
+		status, body := renderError(ginErr)
+		var retryErr *domain.RetryAfterError
+		if errors.As(ginErr.Err, &retryErr) {
+			// Whole seconds, rounded up so a client waiting exactly that long isn't turned away again.
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryErr.After.Seconds()))))
+		}
+		if status >= http.StatusInternalServerError {
+			slog.ErrorContext(c.Request.Context(), "request failed", "method", c.Request.Method, "path", c.Request.URL.Path, "error", ginErr.Err)
+		}
+		c.AbortWithStatusJSON(status, body)
+	}
+}
+
+func renderError(ginErr *gin.Error) (int, ErrorResponse) {
+	err := ginErr.Err
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Status, ErrorResponse{Error: httpErr.Message, Code: httpErr.Code}
+	}
+
+	var domainErr *domain.Error
+	if errors.As(err, &domainErr) {
+		if status, ok := statusByKind[domainErr.Kind]; ok {
+			// err.Error() keeps any context wrapped around the domain error.
+			body := ErrorResponse{Error: err.Error(), Code: domainErr.Code}
+			var violationsErr *domain.ViolationsError
+			if errors.As(err, &violationsErr) {
+				body.Violations = violationsErr.Violations
+			}
+			return status, body
+		}
+	}
+
+	// Binding failures: input that breaks validation rules vs input that can't be decoded.
+	if ginErr.IsType(gin.ErrorTypeBind) {
+		var validationErrs validator.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			fields := make(map[string]string, len(validationErrs))
+			for _, fe := range validationErrs {
+				fields[fe.Field()] = fe.Tag()
+			}
+			return http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error(), Code: "validation_failed", Fields: fields}
+		}
+		return http.StatusBadRequest, ErrorResponse{Error: err.Error(), Code: "invalid_request"}
+	}
+
+	// The request ran out of time (see Timeout), or its client hung up, while waiting on the database.
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusServiceUnavailable, ErrorResponse{Error: "the request took too long", Code: "request_timeout"}
+	}
+	if errors.Is(err, context.Canceled) {
+		return statusClientClosedRequest, ErrorResponse{Error: "the request was cancelled", Code: "request_cancelled"}
+	}
+
+	return http.StatusInternalServerError, ErrorResponse{Error: "internal server error", Code: "internal_error"}
+}
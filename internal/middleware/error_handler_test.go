@@ -0,0 +1,161 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+)
+
+func TestErrorHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type bindTarget struct {
+		Title string `json:"title" binding:"required"`
+	}
+
+	tests := []struct {
+		name           string
+		handler        gin.HandlerFunc
+		body           string
+		wantStatus     int
+		wantCode       string
+		wantRetry      string
+		wantViolations []string
+	}{
+		{
+			name:       "Not Found",
+			handler:    func(c *gin.Context) { c.Error(domain.ErrTodoNotFound) },
+			wantStatus: http.StatusNotFound,
+			wantCode:   "todo_not_found",
+		},
+		{
+			name:       "Conflict",
+			handler:    func(c *gin.Context) { c.Error(domain.ErrEmailTaken) },
+			wantStatus: http.StatusConflict,
+			wantCode:   "email_already_registered",
+		},
+		{
+			name:       "Validation Wrapped",
+			handler:    func(c *gin.Context) { c.Error(fmt.Errorf("%w: bad sort", domain.ErrInvalidTodoQuery)) },
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   "invalid_todo_query",
+		},
+		{
+			name:       "Unauthorized",
+			handler:    func(c *gin.Context) { c.Error(domain.ErrInvalidCredentials) },
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "invalid_credentials",
+		},
+		{
+			name: "Locked With Retry-After",
+			handler: func(c *gin.Context) {
+				c.Error(domain.NewRetryAfterError(domain.NewLockedError("account_locked", "locked"), 1500*time.Millisecond))
+			},
+			wantStatus: http.StatusLocked,
+			wantCode:   "account_locked",
+			wantRetry:  "2",
+		},
+		{
+			name: "Violations",
+			handler: func(c *gin.Context) {
+				c.Error(domain.NewViolationsError(domain.ErrWeakPassword, map[string][]string{"password": {"min_length", "breached"}}))
+			},
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantCode:       "weak_password",
+			wantViolations: []string{"min_length", "breached"},
+		},
+		{
+			name:       "Forbidden",
+			handler:    func(c *gin.Context) { c.Error(domain.ErrInsufficientPermission) },
+			wantStatus: http.StatusForbidden,
+			wantCode:   "insufficient_permission",
+		},
+		{
+			name: "Binding Validation",
+			handler: func(c *gin.Context) {
+				var req bindTarget
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.Error(err).SetType(gin.ErrorTypeBind)
+				}
+			},
+			body:       `{}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   "validation_failed",
+		},
+		{
+			name: "Malformed Body",
+			handler: func(c *gin.Context) {
+				var req bindTarget
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.Error(err).SetType(gin.ErrorTypeBind)
+				}
+			},
+			body:       `{"title":`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_request",
+		},
+		{
+			name:       "Deadline Exceeded",
+			handler:    func(c *gin.Context) { c.Error(fmt.Errorf("query todos: %w", context.DeadlineExceeded)) },
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   "request_timeout",
+		},
+		{
+			name:       "Client Gone",
+			handler:    func(c *gin.Context) { c.Error(context.Canceled) },
+			wantStatus: 499,
+			wantCode:   "request_cancelled",
+		},
+		{
+			name:       "Unknown Error Is Hidden",
+			handler:    func(c *gin.Context) { c.Error(errors.New("connection refused")) },
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   "internal_error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(middleware.ErrorHandler())
+			r.POST("/", tt.handler)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetry {
+				t.Errorf("expected Retry-After %q, got %q", tt.wantRetry, got)
+			}
+
+			var body middleware.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("expected JSON body, got %q", w.Body.String())
+			}
+			if body.Code != tt.wantCode {
+				t.Errorf("expected code %q, got %q", tt.wantCode, body.Code)
+			}
+			if got := body.Violations["password"]; !slices.Equal(got, tt.wantViolations) {
+				t.Errorf("expected password violations %v, got %v", tt.wantViolations, got)
+			}
+			if tt.wantStatus == http.StatusInternalServerError && body.Error != "internal server error" {
+				t.Errorf("expected internal details to be hidden, got %q", body.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prachaya-orr/relearn-golang/internal/metrics"
+)
+
+// unmatchedRoute labels requests for paths no route matches, so that
+// scanning for URLs can't add a label per path.
+const unmatchedRoute = "unmatched"
+
+// Metrics counts each request and how long it took, by method, route
+// template and status.
+func Metrics(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		m.ObserveRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
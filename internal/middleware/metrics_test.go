@@ -0,0 +1,36 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prachaya-orr/relearn-golang/internal/metrics"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := metrics.New()
+	r := gin.New()
+	r.Use(middleware.Metrics(m))
+	r.GET("/todos/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/todos/1", "/todos/2", "/wp-login.php"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Requests are counted by route template, not by path
+	want := `
+# HELP http_requests_total HTTP requests answered, by method, route template and status.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/todos/:id",status="200"} 2
+http_requests_total{method="GET",route="unmatched",status="404"} 1
+`
+	if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(want), "http_requests_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// RateLimitKeyFunc picks the client a request is counted against
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// RateLimitByIP counts requests per client IP, for routes anyone can call.
+func RateLimitByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitByClient counts requests per API key, or per user for access
+// tokens, so that a user's keys don't eat into each other's limits. It has to
+// run after AuthMiddleware; without a user it falls back to the client IP.
+func RateLimitByClient(c *gin.Context) string {
+	if id, ok := c.Get("apiKeyID"); ok {
+		return "api_key:" + id.(uuid.UUID).String()
+	}
+	if id, ok := c.Get("userID"); ok {
+		return "user:" + id.(uuid.UUID).String()
+	}
+	return RateLimitByIP(c)
+}
+
+// RateLimitPolicy is the limit for one group of routes
+type RateLimitPolicy struct {
+	// Name keeps the counters of different policies apart.
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    RateLimitKeyFunc
+}
+
+// RateLimit allows each client policy.Limit requests per policy.Window and
+// answers 429 with a Retry-After past that.
+//
+// The window slides: the count of the previous fixed window is weighted by
+// how much of it still overlaps, which smooths out the burst a fixed window
+// allows at its edges while the store only keeps two counters per client.
+// Rejected requests are counted too, so a client has to back off to recover.
+//
+// Every response carries the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset (seconds) headers of the IETF RateLimit header draft.
+// Should the store fail, requests are let through rather than failing with it.
+// A Limit of 0 turns the policy off.
+func RateLimit(store domain.RateLimitStore, policy RateLimitPolicy) gin.HandlerFunc {
+	if policy.Limit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	policyHeader := strconv.Itoa(policy.Limit) + ";w=" + strconv.Itoa(int(policy.Window.Seconds()))
+
+	return func(c *gin.Context) {
+		at := time.Now()
+		windowStart := at.Truncate(policy.Window)
+		key := policy.Name + ":" + policy.Key(c)
+
+		previous, err := store.Count(c.Request.Context(), key, windowStart.Add(-policy.Window))
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "rate limit store failed", "policy", policy.Name, "error", err)
+			c.Next()
+			return
+		}
+		current, err := store.Increment(c.Request.Context(), key, windowStart, windowStart.Add(2*policy.Window))
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "rate limit store failed", "policy", policy.Name, "error", err)
+			c.Next()
+			return
+		}
+
+		overlap := 1 - float64(at.Sub(windowStart))/float64(policy.Window)
+		used := int(math.Ceil(float64(previous)*overlap)) + int(current)
+		reset := windowStart.Add(policy.Window).Sub(at)
+
+		c.Header("RateLimit-Policy", policyHeader)
+		c.Header("RateLimit-Limit", strconv.Itoa(policy.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(max(policy.Limit-used, 0)))
+		c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+
+		if used > policy.Limit {
+			abortWithError(c, domain.NewRetryAfterError(domain.ErrRateLimited, reset))
+			return
+		}
+		c.Next()
+	}
+}
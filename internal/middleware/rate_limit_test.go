@@ -0,0 +1,120 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+)
+
+// fakeRateLimitStore counts in a map, the way Redis or Postgres would per key and window
+type fakeRateLimitStore struct {
+	counts map[string]int64
+	err    error
+}
+
+func newFakeRateLimitStore() *fakeRateLimitStore {
+	return &fakeRateLimitStore{counts: make(map[string]int64)}
+}
+
+func (s *fakeRateLimitStore) Increment(ctx context.Context, key string, windowStart, expiresAt time.Time) (int64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	k := key + "@" + windowStart.String()
+	s.counts[k]++
+	return s.counts[k], nil
+}
+
+func (s *fakeRateLimitStore) Count(ctx context.Context, key string, windowStart time.Time) (int64, error) {
+	return s.counts[key+"@"+windowStart.String()], s.err
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := newFakeRateLimitStore()
+	r := gin.New()
+	r.Use(middleware.ErrorHandler())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	// Stands in for AuthMiddleware
+	setUser := func(c *gin.Context) {
+		if id := c.GetHeader("X-User"); id != "" {
+			c.Set("userID", uuid.MustParse(id))
+		}
+	}
+	r.GET("/public", middleware.RateLimit(store, middleware.RateLimitPolicy{
+		Name: "public", Limit: 2, Window: time.Hour, Key: middleware.RateLimitByIP,
+	}), ok)
+	r.GET("/private", setUser, middleware.RateLimit(store, middleware.RateLimitPolicy{
+		Name: "private", Limit: 1, Window: time.Hour, Key: middleware.RateLimitByClient,
+	}), ok)
+
+	send := func(path, ip, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Headers And Limit", func(t *testing.T) {
+		for i, wantRemaining := range []string{"1", "0"} {
+			w := send("/public", "10.0.0.1", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("request %d: expected status 200, got %d", i+1, w.Code)
+			}
+			if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+				t.Errorf("expected RateLimit-Limit 2, got %q", got)
+			}
+			if got := w.Header().Get("RateLimit-Remaining"); got != wantRemaining {
+				t.Errorf("expected RateLimit-Remaining %s, got %q", wantRemaining, got)
+			}
+			if w.Header().Get("RateLimit-Reset") == "" {
+				t.Error("expected a RateLimit-Reset header")
+			}
+		}
+
+		w := send("/public", "10.0.0.1", "")
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status 429, got %d", w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+	})
+
+	t.Run("Other IP", func(t *testing.T) {
+		if w := send("/public", "10.0.0.2", ""); w.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", w.Code)
+		}
+	})
+
+	t.Run("Per User", func(t *testing.T) {
+		user, other := uuid.NewString(), uuid.NewString()
+		send("/private", "10.0.0.3", user)
+		if w := send("/private", "10.0.0.3", user); w.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status 429, got %d", w.Code)
+		}
+		if w := send("/private", "10.0.0.3", other); w.Code != http.StatusOK {
+			t.Errorf("expected another user behind the same IP to pass, got %d", w.Code)
+		}
+	})
+
+	t.Run("Store Failure Lets Requests Through", func(t *testing.T) {
+		store.err = errors.New("connection refused")
+		defer func() { store.err = nil }()
+		if w := send("/public", "10.0.0.1", ""); w.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", w.Code)
+		}
+	})
+}
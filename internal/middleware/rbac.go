@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+var errInsufficientScope = domain.NewForbiddenError("insufficient_scope", "API key lacks the required scope")
+
+// RequireRole only lets through users whose role is one of roles.
+// It has to run after AuthMiddleware, which puts the role in the context.
+func RequireRole(roles ...domain.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(roles, currentRole(c)) {
+			abortWithError(c, domain.ErrInsufficientPermission)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission only lets through users whose role grants permission.
+// It has to run after AuthMiddleware, which puts the role in the context.
+func RequirePermission(permission domain.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentRole(c).Can(permission) {
+			abortWithError(c, domain.ErrInsufficientPermission)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope limits requests made with an API key to keys granted scope.
+// Requests made with an access token are not scoped and pass.
+func RequireScope(scope domain.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scopes, ok := c.Get("apiKeyScopes"); ok && !scopes.(domain.Scopes).Has(scope) {
+			abortWithError(c, errInsufficientScope)
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentRole is the role set by AuthMiddleware, or "" (no permissions) without one
+func currentRole(c *gin.Context) domain.Role {
+	role, _ := c.Get("userRole")
+	r, _ := role.(domain.Role)
+	return r
+}
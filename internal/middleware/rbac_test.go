@@ -0,0 +1,91 @@
+package middleware_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+	"github.com/prachaya-orr/relearn-golang/internal/repository"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
+)
+
+func TestRequireRolePermissionAndScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	key, _ := token.NewSigningKey(private)
+	keys, _ := token.NewKeySet("https://api.example.com", key)
+
+	createToken := func(role string) string {
+		claims := jwt.MapClaims{
+			"iss":  keys.Issuer(),
+			"aud":  token.AudienceAccess,
+			"sub":  uuid.NewString(),
+			"jti":  uuid.NewString(),
+			"type": "access",
+			"exp":  time.Now().Add(time.Minute).Unix(),
+		}
+		if role != "" {
+			claims["role"] = role
+		}
+		s, _ := keys.Sign(claims)
+		return s
+	}
+
+	r := gin.New()
+	r.Use(middleware.ErrorHandler())
+	auth := middleware.AuthMiddleware(keys, repository.NewMemoryRevokedTokenStore(), stubAPIKeys{})
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/admin", auth, middleware.RequireRole(domain.RoleAdmin), ok)
+	r.DELETE("/todos", auth, middleware.RequirePermission(domain.PermissionDeleteAllTodos), ok)
+	r.GET("/todos", auth, middleware.RequireScope(domain.ScopeTodosRead), ok)
+	r.POST("/todos", auth, middleware.RequireScope(domain.ScopeTodosWrite), ok)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		role       string
+		apiKey     string
+		wantStatus int
+	}{
+		{name: "Admin Role", method: http.MethodGet, path: "/admin", role: "admin", wantStatus: http.StatusOK},
+		{name: "User Role", method: http.MethodGet, path: "/admin", role: "user", wantStatus: http.StatusForbidden},
+		{name: "Missing Role Claim", method: http.MethodGet, path: "/admin", wantStatus: http.StatusForbidden},
+		{name: "Admin Permission", method: http.MethodDelete, path: "/todos", role: "admin", wantStatus: http.StatusOK},
+		{name: "User Permission", method: http.MethodDelete, path: "/todos", role: "user", wantStatus: http.StatusForbidden},
+		{name: "Unknown Role", method: http.MethodDelete, path: "/todos", role: "root", wantStatus: http.StatusForbidden},
+		// Deleting every todo once also accepted a shared key in the query string
+		{name: "Query API Key With User Role", method: http.MethodDelete, path: "/todos?api-key=delete", role: "user", wantStatus: http.StatusForbidden},
+		{name: "API Key Has No Permission", method: http.MethodDelete, path: "/todos", apiKey: "tk_valid", wantStatus: http.StatusForbidden},
+		{name: "Token Unscoped", method: http.MethodPost, path: "/todos", role: "user", wantStatus: http.StatusOK},
+		{name: "API Key Scope", method: http.MethodGet, path: "/todos", apiKey: "tk_valid", wantStatus: http.StatusOK},
+		{name: "API Key Missing Scope", method: http.MethodPost, path: "/todos", apiKey: "tk_valid", wantStatus: http.StatusForbidden},
+		{name: "API Key Has No Role", method: http.MethodGet, path: "/admin", apiKey: "tk_valid", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-KEY", tt.apiKey)
+			} else {
+				req.Header.Set("Authorization", "Bearer "+createToken(tt.role))
+			}
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
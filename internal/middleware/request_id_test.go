@@ -0,0 +1,91 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/logging"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+)
+
+// captureLogs sends the default logger's output to a buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, config.LogConfig{Level: "info", Format: config.LogJSON}))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logs := captureLogs(t)
+	userID := uuid.New()
+
+	r := gin.New()
+	r.Use(middleware.RequestID(), middleware.AccessLog(), middleware.ResponseInterceptor(), middleware.ErrorHandler())
+	r.GET("/todos/:id", func(c *gin.Context) {
+		// What AuthMiddleware does for a signed-in user
+		c.Request = c.Request.WithContext(logging.WithUserID(c.Request.Context(), userID))
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	get := func(requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/todos/1", nil)
+		if requestID != "" {
+			req.Header.Set(middleware.RequestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Generated", func(t *testing.T) {
+		w := get("")
+		id := w.Header().Get(middleware.RequestIDHeader)
+		if _, err := uuid.Parse(id); err != nil {
+			t.Fatalf("expected a generated ID, got %q", id)
+		}
+		var body middleware.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if body.Meta.RequestID != id {
+			t.Errorf("expected the ID in the meta, got %q", body.Meta.RequestID)
+		}
+	})
+
+	t.Run("From Client", func(t *testing.T) {
+		if id := get("lb-1234").Header().Get(middleware.RequestIDHeader); id != "lb-1234" {
+			t.Errorf("expected the client's ID to be kept, got %q", id)
+		}
+		for _, bad := range []string{"two words", "line\nbreak", strings.Repeat("x", 129)} {
+			if id := get(bad).Header().Get(middleware.RequestIDHeader); id == bad {
+				t.Errorf("expected %q to be replaced", bad)
+			}
+		}
+	})
+
+	t.Run("Access Log", func(t *testing.T) {
+		logs.Reset()
+		get("access-1")
+
+		var line map[string]any
+		if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+			t.Fatalf("expected one JSON line, got %q", logs.String())
+		}
+		want := map[string]any{"msg": "request", "request_id": "access-1", "user_id": userID.String(), "route": "/todos/:id", "status": float64(http.StatusOK)}
+		for key, value := range want {
+			if line[key] != value {
+				t.Errorf("expected %s %v, got %v", key, value, line[key])
+			}
+		}
+	})
+}
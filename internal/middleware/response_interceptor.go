@@ -6,6 +6,8 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prachaya-orr/relearn-golang/internal/logging"
+	"github.com/prachaya-orr/relearn-golang/internal/tracing"
 )
 
 // ResponseWriter is a wrapper around gin.ResponseWriter to capture the response body
@@ -21,8 +23,29 @@ func (w *ResponseWriter) Write(b []byte) (int, error) {
 
 // Meta holds the response metadata
 type Meta struct {
-	Code       int    `json:"code"`
-	StatusCode string `json:"statusCode"`
+	Code       int         `json:"code"`
+	StatusCode string      `json:"statusCode"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+	// RequestID is the X-Request-ID of the request, for finding its logs.
+	RequestID string `json:"requestId,omitempty"`
+	// TraceID is the ID of the request's trace, for finding its spans.
+	TraceID string `json:"traceId,omitempty"`
+}
+
+// Pagination describes where a page sits within a listing
+type Pagination struct {
+	Total      int64  `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// paginationKey is the gin context key handlers use to hand pagination to the interceptor
+const paginationKey = "responseMeta.pagination"
+
+// SetPagination attaches pagination details to the meta of the current response
+func SetPagination(c *gin.Context, p Pagination) {
+	c.Set(paginationKey, &p)
 }
 
 // APIResponse is the simple standardized response structure requested
@@ -44,6 +67,12 @@ func ResponseInterceptor() gin.HandlerFunc {
 		// Determine status
 		status := c.Writer.Status()
 
+		// 204 and 304 responses must not carry a body, so there is nothing to wrap
+		if status == http.StatusNoContent || status == http.StatusNotModified {
+			w.ResponseWriter.WriteHeaderNow()
+			return
+		}
+
 		// Parse the original body
 		var originalBody interface{}
 		// Try to parse as JSON, otherwise use as string
@@ -78,9 +107,14 @@ func ResponseInterceptor() gin.HandlerFunc {
 			Meta: Meta{
 				Code:       status,
 				StatusCode: http.StatusText(status),
+				RequestID:  logging.RequestID(c.Request.Context()),
+				TraceID:    tracing.TraceID(c.Request.Context()),
 			},
 			Data: originalBody,
 		}
+		if p, ok := c.Get(paginationKey); ok {
+			response.Meta.Pagination = p.(*Pagination)
+		}
 
 		// Marshal the new response
 		newBody, err := json.Marshal(response)
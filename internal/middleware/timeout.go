@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Timeout gives every request a deadline, after which the database queries
+// it runs are cancelled and ErrorHandler answers 503. routes overrides
+// timeout for single routes, keyed by method and route as registered, e.g.
+// "GET /todos/:id".
+func Timeout(timeout time.Duration, routes map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d := timeout
+		if routeTimeout, ok := routes[c.Request.Method+" "+c.FullPath()]; ok {
+			d = routeTimeout
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
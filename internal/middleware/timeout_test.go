@@ -0,0 +1,73 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+)
+
+func TestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// waitForQuery stands in for a handler blocked on the database: it only
+	// returns once the request's context is done.
+	waitForQuery := func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		c.Error(c.Request.Context().Err())
+	}
+	var deadline time.Duration
+	recordDeadline := func(c *gin.Context) {
+		at, _ := c.Request.Context().Deadline()
+		deadline = time.Until(at)
+		c.Status(http.StatusNoContent)
+	}
+
+	r := gin.New()
+	r.Use(middleware.ErrorHandler(), middleware.Timeout(20*time.Millisecond, map[string]time.Duration{
+		"DELETE /todos/:id": time.Hour,
+	}))
+	r.GET("/todos/:id", waitForQuery)
+	r.GET("/slow", recordDeadline)
+	r.DELETE("/todos/:id", recordDeadline)
+
+	t.Run("Deadline", func(t *testing.T) {
+		start := time.Now()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/1", nil))
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", w.Code)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected the request to be cut short, took %s", elapsed)
+		}
+	})
+
+	t.Run("Route Override", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/todos/1", nil))
+		if w.Code != http.StatusNoContent || deadline < time.Minute {
+			t.Errorf("expected the route's own timeout, got %d with %s left", w.Code, deadline)
+		}
+
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+		if deadline > 20*time.Millisecond {
+			t.Errorf("expected the default timeout elsewhere, got %s left", deadline)
+		}
+	})
+
+	t.Run("Client Gone", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/1", nil).WithContext(ctx))
+		if w.Code != 499 {
+			t.Errorf("expected 499, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prachaya-orr/relearn-golang/internal/middleware"
+	"github.com/prachaya-orr/relearn-golang/internal/tracing/tracingtest"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := tracingtest.NewRecorder(t)
+	logs := captureLogs(t)
+
+	r := gin.New()
+	r.Use(middleware.Tracing(recorder), middleware.AccessLog(), middleware.ResponseInterceptor(), middleware.ErrorHandler())
+	r.GET("/todos/:id", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	r.GET("/broken", func(c *gin.Context) { c.Error(errors.New("connection refused")) })
+
+	t.Run("Continues Caller's Trace", func(t *testing.T) {
+		const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+		req := httptest.NewRequest(http.MethodGet, "/todos/1", nil)
+		req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		span := recorder.Span("GET /todos/:id")
+		if span == nil {
+			t.Fatalf("expected a span named after the route, got %v", recorder.Spans())
+		}
+		if span.SpanContext.TraceID().String() != traceID || span.Parent.SpanID().String() != parentID || !span.Parent.IsRemote() {
+			t.Errorf("expected the caller's trace to be continued, got trace %s parent %s", span.SpanContext.TraceID(), span.Parent.SpanID())
+		}
+		if span.SpanKind != trace.SpanKindServer || span.Status.Code != codes.Unset {
+			t.Errorf("expected a successful server span, got %v %v", span.SpanKind, span.Status.Code)
+		}
+
+		var body middleware.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if body.Meta.TraceID != traceID {
+			t.Errorf("expected the trace ID in the meta, got %q", body.Meta.TraceID)
+		}
+		var line map[string]any
+		json.Unmarshal(logs.Bytes(), &line)
+		if line["trace_id"] != traceID {
+			t.Errorf("expected the access log to carry the trace ID, got %v", line["trace_id"])
+		}
+	})
+
+	t.Run("New Trace", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/2", nil))
+
+		var body middleware.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &body)
+		spans := recorder.Spans()
+		if last := spans[len(spans)-1]; body.Meta.TraceID != last.SpanContext.TraceID().String() || last.Parent.IsValid() {
+			t.Errorf("expected a new trace, got %q", body.Meta.TraceID)
+		}
+	})
+
+	t.Run("Server Error", func(t *testing.T) {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/broken", nil))
+
+		span := recorder.Span("GET /broken")
+		if span == nil || span.Status.Code != codes.Error || len(span.Events) == 0 {
+			t.Errorf("expected a failed span with the error, got %+v", span)
+		}
+	})
+}
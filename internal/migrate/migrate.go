@@ -0,0 +1,314 @@
+// Package migrate applies numbered SQL migrations and records them in the
+// schema_migrations table.
+//
+// Migrations live in pairs of files named NNNNNN_name.up.sql and
+// NNNNNN_name.down.sql. Each one runs in its own transaction together with
+// its bookkeeping row, and a Postgres advisory lock keeps two deployments
+// from migrating the same database at once.
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// lockKey identifies this application's migration lock among other advisory locks.
+const lockKey int64 = 72_657_065_726_110 // "relearn" in ASCII, truncated
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+var namePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Migration is one numbered schema change together with its rollback.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// String renders the migration as it appears on disk, e.g. 000002_create_todos.
+func (m Migration) String() string {
+	return fmt.Sprintf("%06d_%s", m.Version, m.Name)
+}
+
+// Status reports whether and when a migration was applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a row of the bookkeeping table.
+type schemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null;default:now()"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Load reads every migration pair in fsys, sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %q does not match NNNNNN_name.(up|down).sql", entry.Name())
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %q and %q", version, m.Name, match[2])
+		}
+
+		direction := &m.Up
+		if match[3] == "down" {
+			direction = &m.Down
+		}
+		if *direction != "" {
+			return nil, fmt.Errorf("duplicate %s migration for version %d", match[3], version)
+		}
+		*direction = string(body)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Create writes an empty up/down pair numbered after the highest version in dir.
+func Create(dir, name string) (upPath, downPath string, err error) {
+	if !namePattern.MatchString(name) {
+		return "", "", fmt.Errorf("migration name %q must be lower_snake_case", name)
+	}
+
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	next := Migration{Version: 1, Name: name}
+	if len(migrations) > 0 {
+		next.Version = migrations[len(migrations)-1].Version + 1
+	}
+
+	upPath = filepath.Join(dir, next.String()+".up.sql")
+	downPath = filepath.Join(dir, next.String()+".down.sql")
+	if err := os.WriteFile(upPath, []byte("-- "+next.String()+" (up)\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(downPath, []byte("-- "+next.String()+" (down)\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	return upPath, downPath, nil
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New creates a Migrator for the given migrations, as returned by Load.
+func New(db *gorm.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status() ([]Status, error) {
+	var statuses []Status
+	err := m.locked(func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			status := Status{Migration: migration}
+			if row, ok := applied[migration.Version]; ok {
+				status.Applied = true
+				status.AppliedAt = &row.AppliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Up applies the next n pending migrations, or all of them when n <= 0.
+func (m *Migrator) Up(n int) ([]Migration, error) {
+	return m.run(func(applied map[int64]schemaMigration) ([]Migration, []Migration) {
+		return planUp(m.migrations, applied, n), nil
+	})
+}
+
+// Down rolls back the last n applied migrations, or all of them when n <= 0.
+func (m *Migrator) Down(n int) ([]Migration, error) {
+	return m.run(func(applied map[int64]schemaMigration) ([]Migration, []Migration) {
+		return nil, planDown(m.migrations, applied, n)
+	})
+}
+
+// Goto migrates up or down until exactly the migrations up to version are applied.
+// Version 0 rolls everything back.
+func (m *Migrator) Goto(version int64) ([]Migration, error) {
+	if version != 0 && !m.has(version) {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+	return m.run(func(applied map[int64]schemaMigration) ([]Migration, []Migration) {
+		return planGoto(m.migrations, applied, version)
+	})
+}
+
+func (m *Migrator) has(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// run plans and executes migrations while holding the migration lock.
+// plan returns the migrations to apply and then the ones to roll back.
+func (m *Migrator) run(plan func(applied map[int64]schemaMigration) (up, down []Migration)) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		up, down := plan(applied)
+		for _, migration := range down {
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("rolling back %s: %w", migration, err)
+			}
+			done = append(done, migration)
+		}
+		for _, migration := range up {
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("applying %s: %w", migration, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// locked runs fn on a single connection holding the advisory lock. The lock is
+// session-scoped, so it has to be taken and released on the same connection.
+func (m *Migrator) locked(fn func(conn *gorm.DB) error) error {
+	return m.db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", lockKey).Error; err != nil {
+			return fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", lockKey)
+
+		if err := conn.AutoMigrate(&schemaMigration{}); err != nil {
+			return fmt.Errorf("creating schema_migrations: %w", err)
+		}
+		return fn(conn)
+	})
+}
+
+func appliedMigrations(conn *gorm.DB) (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := conn.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// planUp picks the first n pending migrations in ascending order.
+func planUp(migrations []Migration, applied map[int64]schemaMigration, n int) []Migration {
+	var pending []Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	if n > 0 && n < len(pending) {
+		pending = pending[:n]
+	}
+	return pending
+}
+
+// planDown picks the last n applied migrations in descending order.
+func planDown(migrations []Migration, applied map[int64]schemaMigration, n int) []Migration {
+	var rollback []Migration
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if _, ok := applied[migrations[i].Version]; ok {
+			rollback = append(rollback, migrations[i])
+		}
+	}
+	if n > 0 && n < len(rollback) {
+		rollback = rollback[:n]
+	}
+	return rollback
+}
+
+// planGoto rolls back everything applied above version, then applies everything pending up to it.
+func planGoto(migrations []Migration, applied map[int64]schemaMigration, version int64) (up, down []Migration) {
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if _, ok := applied[migrations[i].Version]; ok && migrations[i].Version > version {
+			down = append(down, migrations[i])
+		}
+	}
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; !ok && migration.Version <= version {
+			up = append(up, migration)
+		}
+	}
+	return up, down
+}
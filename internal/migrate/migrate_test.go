@@ -0,0 +1,136 @@
+package migrate
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func testMigrations() []Migration {
+	return []Migration{
+		{Version: 1, Name: "create_users"},
+		{Version: 2, Name: "create_todos"},
+		{Version: 3, Name: "add_index"},
+	}
+}
+
+func applied(versions ...int64) map[int64]schemaMigration {
+	rows := map[int64]schemaMigration{}
+	for _, v := range versions {
+		rows[v] = schemaMigration{Version: v}
+	}
+	return rows
+}
+
+func versions(migrations []Migration) []int64 {
+	var out []int64
+	for _, m := range migrations {
+		out = append(out, m.Version)
+	}
+	return out
+}
+
+func equal(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"000002_create_todos.up.sql":   {Data: []byte("CREATE TABLE todos ();")},
+			"000002_create_todos.down.sql": {Data: []byte("DROP TABLE todos;")},
+			"000001_create_users.up.sql":   {Data: []byte("CREATE TABLE users ();")},
+			"000001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+			"README.md":                    {Data: []byte("ignored")},
+		}
+		migrations, err := Load(fsys)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !equal(versions(migrations), []int64{1, 2}) {
+			t.Errorf("expected versions [1 2], got %v", versions(migrations))
+		}
+		if migrations[1].Down != "DROP TABLE todos;" {
+			t.Errorf("expected down SQL to be loaded, got %q", migrations[1].Down)
+		}
+	})
+
+	t.Run("Missing Down", func(t *testing.T) {
+		fsys := fstest.MapFS{"000001_create_users.up.sql": {Data: []byte("SELECT 1;")}}
+		if _, err := Load(fsys); err == nil {
+			t.Error("expected error for a migration without a down file")
+		}
+	})
+
+	t.Run("Bad File Name", func(t *testing.T) {
+		fsys := fstest.MapFS{"create_users.sql": {Data: []byte("SELECT 1;")}}
+		if _, err := Load(fsys); err == nil {
+			t.Error("expected error for an unnumbered file")
+		}
+	})
+}
+
+func TestPlan(t *testing.T) {
+	migrations := testMigrations()
+
+	t.Run("Up All", func(t *testing.T) {
+		got := versions(planUp(migrations, applied(1), 0))
+		if !equal(got, []int64{2, 3}) {
+			t.Errorf("expected [2 3], got %v", got)
+		}
+	})
+
+	t.Run("Up N", func(t *testing.T) {
+		got := versions(planUp(migrations, applied(), 2))
+		if !equal(got, []int64{1, 2}) {
+			t.Errorf("expected [1 2], got %v", got)
+		}
+	})
+
+	t.Run("Down N", func(t *testing.T) {
+		got := versions(planDown(migrations, applied(1, 2, 3), 2))
+		if !equal(got, []int64{3, 2}) {
+			t.Errorf("expected [3 2], got %v", got)
+		}
+	})
+
+	t.Run("Goto Lower Version", func(t *testing.T) {
+		up, down := planGoto(migrations, applied(1, 2, 3), 1)
+		if len(up) != 0 || !equal(versions(down), []int64{3, 2}) {
+			t.Errorf("expected to roll back [3 2], got up %v down %v", versions(up), versions(down))
+		}
+	})
+
+	t.Run("Goto Higher Version", func(t *testing.T) {
+		up, down := planGoto(migrations, applied(1), 3)
+		if len(down) != 0 || !equal(versions(up), []int64{2, 3}) {
+			t.Errorf("expected to apply [2 3], got up %v down %v", versions(up), versions(down))
+		}
+	})
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/000007_existing.up.sql", []byte("SELECT 1;"), 0o644)
+	os.WriteFile(dir+"/000007_existing.down.sql", []byte("SELECT 1;"), 0o644)
+
+	upPath, downPath, err := Create(dir, "add_todo_priority")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if upPath != dir+"/000008_add_todo_priority.up.sql" || downPath != dir+"/000008_add_todo_priority.down.sql" {
+		t.Errorf("expected version 8 files, got %s and %s", upPath, downPath)
+	}
+
+	if _, _, err := Create(dir, "Bad Name"); err == nil {
+		t.Error("expected error for a name that is not lower_snake_case")
+	}
+}
@@ -0,0 +1,306 @@
+// Package oidc signs users in with an external OpenID Connect provider, using
+// the authorization code flow with PKCE (RFC 7636).
+//
+// The provider's endpoints come from its discovery document and its signing
+// keys from its JWK Set; both are fetched on first use. The ID token is the
+// only thing taken from the provider: it is verified against those keys and
+// has to be issued by the provider, to this client, for this very request.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
+)
+
+// leeway allows for clocks that are a little apart from the provider's
+const leeway = time.Minute
+
+// Client talks to one provider on behalf of this API.
+type Client struct {
+	cfg        config.OIDCConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]crypto.PublicKey
+}
+
+// discovery is the part of the provider's discovery document that is used
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func NewClient(cfg config.OIDCConfig) *Client {
+	return &Client{cfg: cfg, httpClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// AuthRequest is one sign-in in progress. It has to be kept, out of the
+// user's reach to change, between AuthCodeURL and Exchange.
+type AuthRequest struct {
+	// State ties the provider's redirect back to the browser that started the sign-in.
+	State string `json:"state"`
+	// Nonce ties the ID token to this sign-in.
+	Nonce string `json:"nonce"`
+	// Verifier is the PKCE code verifier; only its hash is sent to the authorization endpoint.
+	Verifier string `json:"verifier"`
+}
+
+// NewAuthRequest starts a sign-in with fresh random values.
+func NewAuthRequest() (*AuthRequest, error) {
+	values := make([]string, 3)
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return &AuthRequest{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// codeChallenge is the S256 PKCE challenge for the verifier
+func (r *AuthRequest) codeChallenge() string {
+	sum := sha256.Sum256([]byte(r.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL is where to send the user to sign in at the provider.
+func (c *Client) AuthCodeURL(ctx context.Context, req *AuthRequest) (string, error) {
+	d, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: bad authorization endpoint: %w", err)
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", c.cfg.ClientID)
+	query.Set("redirect_uri", c.cfg.RedirectURL)
+	query.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	query.Set("state", req.State)
+	query.Set("nonce", req.Nonce)
+	query.Set("code_challenge", req.codeChallenge())
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Claims is who the provider says signed in.
+type Claims struct {
+	// Subject identifies the user at the provider, for good; emails can change.
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// idTokenClaims are the ID token claims that are checked or used
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	AuthorizedBy  string `json:"azp"`
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+}
+
+// Exchange redeems the code the provider redirected back with, for the
+// sign-in req started, and returns the verified claims of the ID token.
+func (c *Client) Exchange(ctx context.Context, code string, req *AuthRequest) (*Claims, error) {
+	d, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"code_verifier": {req.Verifier},
+		"client_id":     {c.cfg.ClientID},
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+	if c.cfg.ClientSecret != "" {
+		// client_secret_basic, with both parts form-encoded first (RFC 6749, section 2.3.1)
+		httpReq.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+
+	var response struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := c.fetchJSON(httpReq, &response)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || response.Error != "" {
+		return nil, fmt.Errorf("oidc: token endpoint answered %d %s: %s", status, response.Error, response.ErrorDescription)
+	}
+	if response.IDToken == "" {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+	return c.verify(ctx, d, response.IDToken, req.Nonce)
+}
+
+// verify checks the ID token's signature, issuer, audience, expiry and nonce
+func (c *Client) verify(ctx context.Context, d *discovery, idToken, nonce string) (*Claims, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := c.key(ctx, d, kid)
+		if err != nil {
+			return nil, err
+		}
+		// The key decides the algorithm, never the token
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if t.Method.Alg() != jwt.SigningMethodRS256.Alg() {
+				return nil, fmt.Errorf("unexpected signing method %s for an RSA key", t.Method.Alg())
+			}
+		case ed25519.PublicKey:
+			if t.Method.Alg() != jwt.SigningMethodEdDSA.Alg() {
+				return nil, fmt.Errorf("unexpected signing method %s for an Ed25519 key", t.Method.Alg())
+			}
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(c.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: invalid ID token: %w", err)
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("oidc: ID token was issued for another sign-in")
+	}
+	if claims.AuthorizedBy != "" && claims.AuthorizedBy != c.cfg.ClientID {
+		return nil, errors.New("oidc: ID token was issued to another client")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("oidc: ID token has no subject")
+	}
+
+	// Some providers send email_verified as a string
+	verified := claims.EmailVerified == true || claims.EmailVerified == "true"
+	return &Claims{Subject: claims.Subject, Email: claims.Email, EmailVerified: verified}, nil
+}
+
+// discover fetches the discovery document, once it has been fetched successfully
+func (c *Client) discover(ctx context.Context) (*discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+
+	issuer := strings.TrimSuffix(c.cfg.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	d := &discovery{}
+	status, err := c.fetchJSON(req, d)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery answered %d", status)
+	}
+	// The document must be the issuer's own, or it could hand out someone else's keys (OpenID Connect Discovery, section 4.3)
+	if strings.TrimSuffix(d.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("oidc: discovery document is for issuer %q, not %q", d.Issuer, c.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document lacks an endpoint")
+	}
+	c.discovery = d
+	return d, nil
+}
+
+// key returns the provider's key with ID kid. The JWK Set is fetched again
+// for a kid not seen before, as the provider may have rotated its keys.
+func (c *Client) key(ctx context.Context, d *discovery, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set token.JWKS
+	status, err := c.fetchJSON(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: JWK Set answered %d", status)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys of types that can't be used are skipped, not fatal
+		if key, err := jwk.PublicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	c.keys = keys
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// fetchJSON sends req and decodes the JSON answer into v, whatever the status
+func (c *Client) fetchJSON(req *http.Request, v any) (int, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("oidc: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, fmt.Errorf("oidc: %w", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("oidc: %s answered with invalid JSON: %w", req.URL, err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,171 @@
+package oidc_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/oidc"
+	"github.com/prachaya-orr/relearn-golang/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:8080/auth/oidc/callback"
+
+func newClient(provider *oidctest.Provider) *oidc.Client {
+	return oidc.NewClient(config.OIDCConfig{
+		Provider:     "fake",
+		Issuer:       provider.Issuer,
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "email"},
+	})
+}
+
+// authorize sends the user to the provider and returns the query it redirects back with
+func authorize(t *testing.T, client *oidc.Client, req *oidc.AuthRequest) url.Values {
+	t.Helper()
+	authURL, err := client.AuthCodeURL(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected an authorization URL, got %v", err)
+	}
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatalf("expected a redirect back, got status %d", resp.StatusCode)
+	}
+	if !strings.HasPrefix(location.String(), redirectURL) {
+		t.Fatalf("expected a redirect to %s, got %s", redirectURL, location)
+	}
+	return location.Query()
+}
+
+func TestClient(t *testing.T) {
+	provider := oidctest.NewServer(t, "todo-api", "s3cret/+")
+	client := newClient(provider)
+
+	t.Run("Success", func(t *testing.T) {
+		req, _ := oidc.NewAuthRequest()
+		back := authorize(t, client, req)
+		if back.Get("state") != req.State {
+			t.Errorf("expected the state to come back, got %q", back.Get("state"))
+		}
+
+		claims, err := client.Exchange(context.Background(), back.Get("code"), req)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if claims.Subject != "fake-user" || claims.Email != "fake-user@example.com" || !claims.EmailVerified {
+			t.Errorf("expected the provider's user, got %+v", claims)
+		}
+	})
+
+	t.Run("Code Works Once", func(t *testing.T) {
+		req, _ := oidc.NewAuthRequest()
+		code := authorize(t, client, req).Get("code")
+		client.Exchange(context.Background(), code, req)
+		if _, err := client.Exchange(context.Background(), code, req); err == nil {
+			t.Error("expected a redeemed code to be refused")
+		}
+	})
+
+	t.Run("Wrong Verifier", func(t *testing.T) {
+		req, _ := oidc.NewAuthRequest()
+		code := authorize(t, client, req).Get("code")
+		other, _ := oidc.NewAuthRequest()
+		forged := &oidc.AuthRequest{State: req.State, Nonce: req.Nonce, Verifier: other.Verifier}
+		if _, err := client.Exchange(context.Background(), code, forged); err == nil {
+			t.Error("expected PKCE to refuse a code redeemed without its verifier")
+		}
+	})
+
+	t.Run("Wrong Nonce", func(t *testing.T) {
+		req, _ := oidc.NewAuthRequest()
+		code := authorize(t, client, req).Get("code")
+		forged := *req
+		forged.Nonce = "replayed"
+		if _, err := client.Exchange(context.Background(), code, &forged); err == nil {
+			t.Error("expected an ID token for another sign-in to be refused")
+		}
+	})
+
+	t.Run("Wrong Client Secret", func(t *testing.T) {
+		wrong := oidc.NewClient(config.OIDCConfig{Issuer: provider.Issuer, ClientID: provider.ClientID, ClientSecret: "guess", RedirectURL: redirectURL, Scopes: []string{"openid"}})
+		req, _ := oidc.NewAuthRequest()
+		code := authorize(t, wrong, req).Get("code")
+		if _, err := wrong.Exchange(context.Background(), code, req); err == nil {
+			t.Error("expected the token endpoint to refuse the client")
+		}
+	})
+}
+
+func TestClientRejectsIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+	}{
+		{name: "Other Issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "Other Audience", modify: func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{name: "Authorized For Other Client", modify: func(c jwt.MapClaims) { c["aud"] = []string{"todo-api", "another-client"}; c["azp"] = "another-client" }},
+		{name: "Expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "No Subject", modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := oidctest.NewServer(t, "todo-api", "")
+			provider.ModifyClaims = tt.modify
+			client := newClient(provider)
+
+			req, _ := oidc.NewAuthRequest()
+			code := authorize(t, client, req).Get("code")
+			if _, err := client.Exchange(context.Background(), code, req); err == nil {
+				t.Error("expected the ID token to be refused")
+			}
+		})
+	}
+
+	t.Run("Email Verified As String", func(t *testing.T) {
+		provider := oidctest.NewServer(t, "todo-api", "")
+		provider.ModifyClaims = func(c jwt.MapClaims) { c["email_verified"] = "true" }
+		client := newClient(provider)
+
+		req, _ := oidc.NewAuthRequest()
+		claims, err := client.Exchange(context.Background(), authorize(t, client, req).Get("code"), req)
+		if err != nil || !claims.EmailVerified {
+			t.Errorf("expected a verified email, got %+v, %v", claims, err)
+		}
+	})
+}
+
+func TestClientDiscovery(t *testing.T) {
+	provider := oidctest.NewServer(t, "todo-api", "")
+	// Another server relaying the provider's discovery document as its own
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := http.Get(provider.Issuer + r.URL.Path)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer resp.Body.Close()
+		io.Copy(w, resp.Body)
+	}))
+	defer relay.Close()
+
+	client := oidc.NewClient(config.OIDCConfig{Issuer: relay.URL, ClientID: "todo-api", RedirectURL: redirectURL, Scopes: []string{"openid"}})
+	req, _ := oidc.NewAuthRequest()
+	if _, err := client.AuthCodeURL(context.Background(), req); err == nil || !strings.Contains(err.Error(), "issuer") {
+		t.Errorf("expected a discovery document for another issuer to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+// Package oidctest is a fake OpenID Connect provider, for tests and for
+// trying the sign-in flow locally (see cmd/fake-oidc).
+//
+// It serves discovery, a JWK Set, an authorization endpoint that signs in
+// its User straight away, without asking anything, and a token endpoint that
+// checks the client, the redirect URI and PKCE like a real provider would.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
+)
+
+// User is who signs in at the fake provider.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Provider is a fake OpenID Connect provider for a single client. It is an
+// http.Handler; Issuer has to be the URL it is served at.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// User signs in at the authorization endpoint.
+	User User
+	// ModifyClaims, when set, changes the claims of every ID token before it is signed.
+	ModifyClaims func(claims jwt.MapClaims)
+
+	keys *token.KeySet
+	mux  *http.ServeMux
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+// grant is an authorization code waiting to be redeemed
+type grant struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	user          User
+	expiresAt     time.Time
+}
+
+// NewProvider creates a provider with a fresh RSA signing key. A provider
+// without a client secret takes public clients, which authenticate with PKCE alone.
+func NewProvider(issuer, clientID, clientSecret string) (*Provider, error) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	key, err := token.NewSigningKey(private)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := token.NewKeySet(issuer, key)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		User:         User{Subject: "fake-user", Email: "fake-user@example.com", EmailVerified: true},
+		keys:         keys,
+		mux:          http.NewServeMux(),
+		codes:        map[string]grant{},
+	}
+	p.mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	p.mux.HandleFunc("GET /jwks", p.jwks)
+	p.mux.HandleFunc("GET /authorize", p.authorize)
+	p.mux.HandleFunc("POST /token", p.token)
+	return p, nil
+}
+
+// NewServer serves a new provider on a local test server, closed when the test ends.
+func NewServer(t testing.TB, clientID, clientSecret string) *Provider {
+	t.Helper()
+	// The issuer is the server's URL, known only once it is started
+	var p *Provider
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	p, err := NewProvider(server.URL, clientID, clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.ServeHTTP(w, r)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + "/authorize",
+		"token_endpoint":                        p.Issuer + "/token",
+		"jwks_uri":                              p.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.keys.JWKS())
+}
+
+// authorize signs User in and redirects back with a code, or with an error
+// for a request the provider would refuse.
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	if query.Get("client_id") != p.ClientID || redirectURI == "" {
+		http.Error(w, "unknown client or redirect_uri", http.StatusBadRequest)
+		return
+	}
+	back, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	values := back.Query()
+	values.Set("state", query.Get("state"))
+	switch {
+	case query.Get("response_type") != "code":
+		values.Set("error", "unsupported_response_type")
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		values.Set("error", "invalid_request")
+		values.Set("error_description", "PKCE with S256 is required")
+	default:
+		code := randomString()
+		p.mu.Lock()
+		p.codes[code] = grant{
+			redirectURI:   redirectURI,
+			codeChallenge: query.Get("code_challenge"),
+			nonce:         query.Get("nonce"),
+			user:          p.User,
+			expiresAt:     time.Now().Add(time.Minute),
+		}
+		p.mu.Unlock()
+		values.Set("code", code)
+	}
+	back.RawQuery = values.Encode()
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+// token redeems an authorization code, once, for an ID token
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	if !p.authenticClient(r) {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	p.mu.Lock()
+	code := r.PostForm.Get("code")
+	g, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if !ok || time.Now().After(g.expiresAt) || g.redirectURI != r.PostForm.Get("redirect_uri") || challenge != g.codeChallenge {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.Issuer,
+		"sub":            g.user.Subject,
+		"aud":            p.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          g.nonce,
+		"email":          g.user.Email,
+		"email_verified": g.user.EmailVerified,
+	}
+	if p.ModifyClaims != nil {
+		p.ModifyClaims(claims)
+	}
+	idToken, err := p.keys.Sign(claims)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// authenticClient checks the client ID and, for a confidential client, the
+// secret, sent with client_secret_basic or client_secret_post.
+func (p *Provider) authenticClient(r *http.Request) bool {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.ClientID {
+		return false
+	}
+	return p.ClientSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(p.ClientSecret)) == 1
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
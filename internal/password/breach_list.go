@@ -0,0 +1,85 @@
+// Package password holds password hashing and the password checks that
+// need more than the policy settings, such as the breached password list.
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// hashPrefixLength is how much of a SHA-1 hash selects a range, as in the
+// Pwned Passwords range API.
+const hashPrefixLength = 5
+
+// BreachList is an offline list of breached passwords, kept as SHA-1 hashes
+// grouped by their first five hex digits. A lookup asks for the range of a
+// prefix and looks for the rest of the hash in it, the k-anonymity scheme of
+// the Pwned Passwords API, so the list could be swapped for that API without
+// the password or its full hash ever leaving the process.
+type BreachList struct {
+	ranges map[string][]string // prefix -> sorted suffixes
+}
+
+// LoadBreachList reads path, one entry per line: an upper- or lower-case
+// SHA-1 hash optionally followed by ":count" (the Pwned Passwords download
+// format), or else a password in clear. Empty lines and lines starting with
+// # are skipped.
+func LoadBreachList(path string) (*BreachList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &BreachList{ranges: make(map[string][]string)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		if !isSHA1(hash) {
+			hash = sha1Hex(line)
+		}
+		hash = strings.ToUpper(hash)
+		prefix := hash[:hashPrefixLength]
+		list.ranges[prefix] = append(list.ranges[prefix], hash[hashPrefixLength:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	for _, suffixes := range list.ranges {
+		slices.Sort(suffixes)
+	}
+	return list, nil
+}
+
+// Range returns the hash suffixes listed under a five digit prefix.
+func (l *BreachList) Range(prefix string) []string {
+	return l.ranges[strings.ToUpper(prefix)]
+}
+
+func (l *BreachList) IsBreached(password string) (bool, error) {
+	hash := sha1Hex(password)
+	_, found := slices.BinarySearch(l.Range(hash[:hashPrefixLength]), hash[hashPrefixLength:])
+	return found, nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1(s string) bool {
+	if len(s) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,43 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBreachList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	content := "# common passwords\n" +
+		"\n" +
+		"correcthorse\n" +
+		// SHA-1 of "password123", as in the Pwned Passwords download
+		"cbfdac6008f9cab4083784cbd1874f76618d2a97:251682\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadBreachList(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{password: "correcthorse", want: true},
+		{password: "password123", want: true},
+		{password: "Password123", want: false},
+		{password: "# common passwords", want: false},
+	}
+	for _, tt := range tests {
+		if got, _ := list.IsBreached(tt.password); got != tt.want {
+			t.Errorf("IsBreached(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+
+	if _, err := LoadBreachList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,71 @@
+package password
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+)
+
+// ErrUnknownHash is returned for a stored hash none of the hashers can read.
+var ErrUnknownHash = errors.New("password: unknown hash format")
+
+// Hasher hashes new passwords with the configured algorithm, and verifies
+// hashes of every supported algorithm, so switching algorithms or raising
+// the cost doesn't lock anyone out. Hashes made otherwise than Hash would
+// now make them report NeedsRehash.
+type Hasher struct {
+	algorithm string
+	bcrypt    Bcrypt
+	argon2id  Argon2id
+}
+
+func NewHasher(cfg config.PasswordHashConfig) *Hasher {
+	return &Hasher{
+		algorithm: cfg.Algorithm,
+		bcrypt:    Bcrypt{Cost: cfg.BcryptCost},
+		argon2id: Argon2id{
+			Memory:      uint32(cfg.Argon2Memory),
+			Iterations:  uint32(cfg.Argon2Iterations),
+			Parallelism: uint8(cfg.Argon2Parallelism),
+		},
+	}
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == config.HashBcrypt {
+		return h.bcrypt.Hash(password)
+	}
+	return h.argon2id.Hash(password)
+}
+
+func (h *Hasher) Verify(encoded, password string) (bool, error) {
+	switch algorithm(encoded) {
+	case config.HashArgon2id:
+		return h.argon2id.Verify(encoded, password)
+	case config.HashBcrypt:
+		return h.bcrypt.Verify(encoded, password)
+	}
+	return false, ErrUnknownHash
+}
+
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	if algorithm(encoded) != h.algorithm {
+		return true
+	}
+	if h.algorithm == config.HashBcrypt {
+		return h.bcrypt.NeedsRehash(encoded)
+	}
+	return h.argon2id.NeedsRehash(encoded)
+}
+
+// algorithm tells which hasher made encoded, from its leading $id$
+func algorithm(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return config.HashArgon2id
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return config.HashBcrypt
+	}
+	return ""
+}
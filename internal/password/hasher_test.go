@@ -0,0 +1,98 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+)
+
+func TestHasher(t *testing.T) {
+	cheap := config.PasswordHashConfig{
+		Algorithm:         config.HashArgon2id,
+		BcryptCost:        4,
+		Argon2Memory:      64,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	}
+	withBcrypt := cheap
+	withBcrypt.Algorithm = config.HashBcrypt
+
+	for _, cfg := range []config.PasswordHashConfig{cheap, withBcrypt} {
+		t.Run(cfg.Algorithm, func(t *testing.T) {
+			h := NewHasher(cfg)
+			encoded, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if algorithm(encoded) != cfg.Algorithm {
+				t.Errorf("expected a %s hash, got %q", cfg.Algorithm, encoded)
+			}
+			if ok, err := h.Verify(encoded, "correct horse"); !ok || err != nil {
+				t.Errorf("expected the password to match, got %v, %v", ok, err)
+			}
+			if ok, err := h.Verify(encoded, "battery staple"); ok || err != nil {
+				t.Errorf("expected another password not to match, got %v, %v", ok, err)
+			}
+			if h.NeedsRehash(encoded) {
+				t.Error("expected a fresh hash to be up to date")
+			}
+			if again, _ := h.Hash("correct horse"); again == encoded {
+				t.Error("expected every hash to have its own salt")
+			}
+		})
+	}
+
+	t.Run("Argon2id Format", func(t *testing.T) {
+		encoded, _ := NewHasher(cheap).Hash("correct horse")
+		if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+			t.Errorf("expected a PHC string with the parameters, got %q", encoded)
+		}
+	})
+
+	t.Run("Rehash", func(t *testing.T) {
+		argon2Hash, _ := NewHasher(cheap).Hash("correct horse")
+		bcryptHash, _ := NewHasher(withBcrypt).Hash("correct horse")
+
+		stronger := cheap
+		stronger.Argon2Iterations = 2
+		strongerBcrypt := withBcrypt
+		strongerBcrypt.BcryptCost = 5
+
+		tests := []struct {
+			name    string
+			cfg     config.PasswordHashConfig
+			encoded string
+		}{
+			{name: "Other Algorithm", cfg: cheap, encoded: bcryptHash},
+			{name: "Back To Bcrypt", cfg: withBcrypt, encoded: argon2Hash},
+			{name: "Argon2id Parameters", cfg: stronger, encoded: argon2Hash},
+			{name: "Bcrypt Cost", cfg: strongerBcrypt, encoded: bcryptHash},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				h := NewHasher(tt.cfg)
+				if !h.NeedsRehash(tt.encoded) {
+					t.Errorf("expected %q to need a rehash", tt.encoded)
+				}
+				// Outdated hashes keep working until they are replaced
+				if ok, err := h.Verify(tt.encoded, "correct horse"); !ok || err != nil {
+					t.Errorf("expected the password to match, got %v, %v", ok, err)
+				}
+			})
+		}
+	})
+
+	t.Run("Unknown Hash", func(t *testing.T) {
+		h := NewHasher(cheap)
+		for _, encoded := range []string{"", "plaintext", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA", "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5"} {
+			if _, err := h.Verify(encoded, "correct horse"); !errors.Is(err, ErrUnknownHash) {
+				t.Errorf("expected ErrUnknownHash for %q, got %v", encoded, err)
+			}
+			if !h.NeedsRehash(encoded) {
+				t.Errorf("expected %q to need a rehash", encoded)
+			}
+		}
+	})
+}
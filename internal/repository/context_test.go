@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/repository/repositorytest"
+)
+
+func TestQueriesFollowContext(t *testing.T) {
+	db := repositorytest.NewBlockingDB(t)
+	todos := NewTodoRepository(db.DB)
+	users := NewUserRepository(db.DB)
+	userID := uuid.New()
+
+	tests := []struct {
+		name  string
+		query func(ctx context.Context) error
+	}{
+		{name: "Find Todos", query: func(ctx context.Context) error {
+			_, err := todos.FindAll(ctx, domain.TodoQuery{UserID: userID, SortBy: domain.TodoSortCreatedAt, Limit: 10})
+			return err
+		}},
+		{name: "Create Todo", query: func(ctx context.Context) error {
+			return todos.Create(ctx, &domain.Todo{Title: "Write tests", UserID: userID})
+		}},
+		{name: "Find User", query: func(ctx context.Context) error {
+			_, err := users.FindByID(ctx, userID)
+			return err
+		}},
+		{name: "Delete User", query: func(ctx context.Context) error {
+			return users.Delete(ctx, userID) // in a transaction
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Run("Cancelled", func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(20*time.Millisecond, cancel)
+				if err := tt.query(ctx); !errors.Is(err, context.Canceled) {
+					t.Errorf("expected the query to be cancelled, got %v", err)
+				}
+			})
+			t.Run("Deadline", func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+				if err := tt.query(ctx); !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("expected the query to time out, got %v", err)
+				}
+			})
+		})
+	}
+
+	if db.Queries() == 0 {
+		t.Error("expected the queries to reach the database")
+	}
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"gorm.io/gorm"
+)
+
+type identityRepository struct {
+	db *gorm.DB
+}
+
+func NewIdentityRepository(db *gorm.DB) domain.IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) FindByProviderSubject(ctx context.Context, provider, subject string) (*domain.Identity, error) {
+	var identity domain.Identity
+	err := r.db.WithContext(ctx).First(&identity, "provider = ? AND subject = ?", provider, subject).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *identityRepository) Create(ctx context.Context, identity *domain.Identity) error {
+	return r.db.WithContext(ctx).Create(identity).Error
+}
+
+func (r *identityRepository) MarkSignedIn(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&domain.Identity{}).Where("id = ?", id).Update("last_sign_in_at", at).Error
+}
+
+func (r *identityRepository) LastSignInAt(ctx context.Context, userID uuid.UUID) (*time.Time, error) {
+	var last *time.Time
+	err := r.db.WithContext(ctx).Model(&domain.Identity{}).Where("user_id = ?", userID).Select("MAX(last_sign_in_at)").Scan(&last).Error
+	if err != nil {
+		return nil, err
+	}
+	return last, nil
+}
+
+func (r *identityRepository) CreateUser(ctx context.Context, user *domain.User, identity *domain.Identity) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(user).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return domain.ErrEmailTaken
+		}
+		if err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// memoryLoginAttemptStore keeps failed login tallies in process memory.
+// Tallies are evicted once they run out.
+type memoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]domain.LoginAttempt
+}
+
+// NewMemoryLoginAttemptStore creates a failed login store for a single API
+// instance. Tallies are lost on restart and not seen by other instances.
+func NewMemoryLoginAttemptStore() domain.LoginAttemptStore {
+	return &memoryLoginAttemptStore{attempts: make(map[string]domain.LoginAttempt)}
+}
+
+func (s *memoryLoginAttemptStore) Get(_ context.Context, key string) (*domain.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+func (s *memoryLoginAttemptStore) RecordFailure(_ context.Context, key string, at, resetBefore time.Time) (*domain.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, attempt := range s.attempts {
+		if attempt.LastFailedAt.Before(resetBefore) {
+			delete(s.attempts, k)
+		}
+	}
+	attempt := s.attempts[key]
+	attempt.Key = key
+	attempt.Failures++
+	attempt.LastFailedAt = at
+	s.attempts[key] = attempt
+	return &attempt, nil
+}
+
+func (s *memoryLoginAttemptStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
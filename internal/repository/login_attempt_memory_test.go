@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryLoginAttemptStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryLoginAttemptStore()
+	now := time.Now()
+
+	store.RecordFailure(ctx, "email:a@example.com", now, now.Add(-time.Hour))
+	attempt, _ := store.RecordFailure(ctx, "email:a@example.com", now, now.Add(-time.Hour))
+	if attempt.Failures != 2 {
+		t.Errorf("expected 2 failures, got %d", attempt.Failures)
+	}
+
+	t.Run("Starts Over After Reset Window", func(t *testing.T) {
+		later := now.Add(2 * time.Hour)
+		attempt, _ := store.RecordFailure(ctx, "email:a@example.com", later, later.Add(-time.Hour))
+		if attempt.Failures != 1 {
+			t.Errorf("expected the tally to start over, got %d failures", attempt.Failures)
+		}
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		store.Reset(ctx, "email:a@example.com")
+		if attempt, _ := store.Get(ctx, "email:a@example.com"); attempt != nil {
+			t.Errorf("expected no failures after reset, got %d", attempt.Failures)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type loginAttemptRepository struct {
+	db *gorm.DB
+}
+
+// NewLoginAttemptRepository creates a failed login store shared by every API instance.
+func NewLoginAttemptRepository(db *gorm.DB) domain.LoginAttemptStore {
+	return &loginAttemptRepository{db: db}
+}
+
+func (r *loginAttemptRepository) Get(ctx context.Context, key string) (*domain.LoginAttempt, error) {
+	var attempt domain.LoginAttempt
+	err := r.db.WithContext(ctx).First(&attempt, "key = ?", key).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (r *loginAttemptRepository) RecordFailure(ctx context.Context, key string, at, resetBefore time.Time) (*domain.LoginAttempt, error) {
+	// Failures are the rare case, so this is a cheap moment to drop tallies that have run out.
+	if err := r.db.WithContext(ctx).Where("last_failed_at < ?", resetBefore).Delete(&domain.LoginAttempt{}).Error; err != nil {
+		return nil, err
+	}
+
+	// A single upsert, so concurrent failures for the same key are all counted.
+	attempt := domain.LoginAttempt{Key: key, Failures: 1, LastFailedAt: at}
+	err := r.db.WithContext(ctx).Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"failures":       gorm.Expr("login_attempts.failures + 1"),
+				"last_failed_at": at,
+			}),
+		},
+		clause.Returning{},
+	).Create(&attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (r *loginAttemptRepository) Reset(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).Where("key = ?", key).Delete(&domain.LoginAttempt{}).Error
+}
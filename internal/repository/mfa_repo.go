@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type mfaRepository struct {
+	db *gorm.DB
+}
+
+func NewMFARepository(db *gorm.DB) domain.MFARepository {
+	return &mfaRepository{db: db}
+}
+
+func (r *mfaRepository) FindTOTP(ctx context.Context, userID uuid.UUID) (*domain.TOTPCredential, error) {
+	var credential domain.TOTPCredential
+	err := r.db.WithContext(ctx).First(&credential, "user_id = ?", userID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (r *mfaRepository) SaveTOTP(ctx context.Context, credential *domain.TOTPCredential) error {
+	// A confirmed credential is never overwritten, even by a concurrent enrollment.
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"secret":         credential.Secret,
+			"confirmed_at":   nil,
+			"last_used_step": 0,
+			"created_at":     gorm.Expr("excluded.created_at"),
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "totp_credentials.confirmed_at IS NULL"}}},
+	}).Create(credential)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+func (r *mfaRepository) ConfirmTOTP(ctx context.Context, userID uuid.UUID, at time.Time, step int64, codeHashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.TOTPCredential{}).
+			Where("user_id = ? AND confirmed_at IS NULL", userID).
+			Updates(map[string]interface{}{"confirmed_at": at, "last_used_step": step})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return domain.ErrMFANotEnrolled
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&domain.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]domain.RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = domain.RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r *mfaRepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	// Conditional update so that a code is accepted once, even by concurrent logins.
+	result := r.db.WithContext(ctx).Model(&domain.TOTPCredential{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (r *mfaRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&domain.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (r *mfaRepository) Delete(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&domain.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("user_id = ?", userID).Delete(&domain.TOTPCredential{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return domain.ErrMFANotEnrolled
+		}
+		return nil
+	})
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"gorm.io/gorm"
+)
+
+type oneTimeTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewOneTimeTokenRepository(db *gorm.DB) domain.OneTimeTokenRepository {
+	return &oneTimeTokenRepository{db: db}
+}
+
+func (r *oneTimeTokenRepository) Create(ctx context.Context, token *domain.OneTimeToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *oneTimeTokenRepository) FindByHash(ctx context.Context, tokenHash string) (*domain.OneTimeToken, error) {
+	var token domain.OneTimeToken
+	err := r.db.WithContext(ctx).First(&token, "token_hash = ?", tokenHash).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *oneTimeTokenRepository) MarkUsed(ctx context.Context, id uuid.UUID) error {
+	// Conditional update so that of two concurrent redemptions only one succeeds.
+	result := r.db.WithContext(ctx).Model(&domain.OneTimeToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrInvalidOneTimeToken
+	}
+	return nil
+}
+
+func (r *oneTimeTokenRepository) InvalidateForUser(ctx context.Context, userID uuid.UUID, purpose domain.TokenPurpose) error {
+	return r.db.WithContext(ctx).Model(&domain.OneTimeToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// rateLimitSweepInterval is how often expired counters are evicted
+const rateLimitSweepInterval = time.Minute
+
+type rateLimitKey struct {
+	key         string
+	windowStart time.Time
+}
+
+// memoryRateLimitStore keeps rate limit counters in process memory.
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	counters  map[rateLimitKey]*domain.RateLimitCounter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryRateLimitStore creates a rate limit store for a single API
+// instance. With several instances each one allows the full limit.
+func NewMemoryRateLimitStore() domain.RateLimitStore {
+	return &memoryRateLimitStore{
+		counters: make(map[rateLimitKey]*domain.RateLimitCounter),
+		now:      time.Now,
+	}
+}
+
+func (s *memoryRateLimitStore) Increment(_ context.Context, key string, windowStart, expiresAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Sweeping on every request would make each one pay for the whole map.
+	now := s.now()
+	if now.Sub(s.lastSweep) >= rateLimitSweepInterval {
+		for k, counter := range s.counters {
+			if counter.ExpiresAt.Before(now) {
+				delete(s.counters, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	k := rateLimitKey{key: key, windowStart: windowStart}
+	counter, ok := s.counters[k]
+	if !ok {
+		counter = &domain.RateLimitCounter{Key: key, WindowStart: windowStart, ExpiresAt: expiresAt}
+		s.counters[k] = counter
+	}
+	counter.Count++
+	return counter.Count, nil
+}
+
+func (s *memoryRateLimitStore) Count(_ context.Context, key string, windowStart time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if counter, ok := s.counters[rateLimitKey{key: key, windowStart: windowStart}]; ok {
+		return counter.Count, nil
+	}
+	return 0, nil
+}
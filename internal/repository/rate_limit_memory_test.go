@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRateLimitStore().(*memoryRateLimitStore)
+	now := time.Now()
+	window := now.Truncate(time.Minute)
+
+	store.Increment(ctx, "ip:10.0.0.1", window, window.Add(2*time.Minute))
+	count, _ := store.Increment(ctx, "ip:10.0.0.1", window, window.Add(2*time.Minute))
+	if count != 2 {
+		t.Errorf("expected a count of 2, got %d", count)
+	}
+	if count, _ := store.Count(ctx, "ip:10.0.0.1", window.Add(-time.Minute)); count != 0 {
+		t.Errorf("expected the previous window to be empty, got %d", count)
+	}
+
+	t.Run("Evicts Expired Counters", func(t *testing.T) {
+		store.now = func() time.Time { return now.Add(time.Hour) }
+		store.Increment(ctx, "ip:10.0.0.2", window.Add(time.Hour), window.Add(time.Hour+2*time.Minute))
+		if count, _ := store.Count(ctx, "ip:10.0.0.1", window); count != 0 {
+			t.Errorf("expected the expired counter to be gone, got %d", count)
+		}
+	})
+}
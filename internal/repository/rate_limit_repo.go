@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type rateLimitRepository struct {
+	db *gorm.DB
+}
+
+// NewRateLimitRepository creates a rate limit store shared by every API instance.
+func NewRateLimitRepository(db *gorm.DB) domain.RateLimitStore {
+	return &rateLimitRepository{db: db}
+}
+
+func (r *rateLimitRepository) Increment(ctx context.Context, key string, windowStart, expiresAt time.Time) (int64, error) {
+	counter := domain.RateLimitCounter{Key: key, WindowStart: windowStart, Count: 1, ExpiresAt: expiresAt}
+	err := r.db.WithContext(ctx).Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}, {Name: "window_start"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("rate_limit_counters.count + 1")}),
+		},
+		clause.Returning{},
+	).Create(&counter).Error
+	if err != nil {
+		return 0, err
+	}
+
+	// The first request of a window is a cheap moment to drop the key's expired counters.
+	if counter.Count == 1 {
+		err := r.db.WithContext(ctx).Where("key = ? AND expires_at < ?", key, time.Now()).Delete(&domain.RateLimitCounter{}).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	return counter.Count, nil
+}
+
+func (r *rateLimitRepository) Count(ctx context.Context, key string, windowStart time.Time) (int64, error) {
+	var counter domain.RateLimitCounter
+	err := r.db.WithContext(ctx).First(&counter, "key = ? AND window_start = ?", key, windowStart).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return counter.Count, nil
+}
@@ -0,0 +1,98 @@
+// Package repositorytest has a database for testing how the repositories,
+// and the layers above them, behave when queries hang.
+package repositorytest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// BlockingDB is a Postgres database whose every query hangs, like one stuck
+// behind a lock, until its context is done.
+type BlockingDB struct {
+	*gorm.DB
+	// started counts the queries sent
+	started atomic.Int64
+}
+
+// NewBlockingDB opens a BlockingDB, closed when the test ends.
+func NewBlockingDB(t testing.TB) *BlockingDB {
+	t.Helper()
+	b := &BlockingDB{}
+	sqlDB := sql.OpenDB(blockingConnector{db: b})
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.DB = db
+	return b
+}
+
+// Queries returns how many queries were sent so far.
+func (b *BlockingDB) Queries() int64 {
+	return b.started.Load()
+}
+
+type blockingConnector struct {
+	db *BlockingDB
+}
+
+func (c blockingConnector) Connect(context.Context) (driver.Conn, error) {
+	return blockingConn{db: c.db}, nil
+}
+
+func (c blockingConnector) Driver() driver.Driver {
+	return blockingDriver{}
+}
+
+type blockingDriver struct{}
+
+func (blockingDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("repositorytest: open the database with NewBlockingDB")
+}
+
+// blockingConn implements driver.QueryerContext and driver.ExecerContext, so
+// database/sql sends it queries without preparing them first.
+type blockingConn struct {
+	db *BlockingDB
+}
+
+func (c blockingConn) wait(ctx context.Context) error {
+	c.db.started.Add(1)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (c blockingConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	return nil, c.wait(ctx)
+}
+
+func (c blockingConn) ExecContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Result, error) {
+	return nil, c.wait(ctx)
+}
+
+func (c blockingConn) BeginTx(ctx context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	return nil, c.wait(ctx)
+}
+
+func (blockingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("repositorytest: statements are not prepared")
+}
+
+func (blockingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("repositorytest: transactions start with BeginTx")
+}
+
+func (blockingConn) Close() error {
+	return nil
+}
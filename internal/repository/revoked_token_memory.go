@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// memoryRevokedTokenStore keeps revocations in process memory. Entries are
+// evicted by PurgeExpired once their token has expired.
+type memoryRevokedTokenStore struct {
+	mu        sync.RWMutex
+	expiresAt map[uuid.UUID]time.Time
+	now       func() time.Time
+}
+
+// NewMemoryRevokedTokenStore creates a revocation store for a single API
+// instance. Revocations are lost on restart and not seen by other instances.
+func NewMemoryRevokedTokenStore() domain.TokenRevocationStore {
+	return &memoryRevokedTokenStore{
+		expiresAt: make(map[uuid.UUID]time.Time),
+		now:       time.Now,
+	}
+}
+
+func (s *memoryRevokedTokenStore) Revoke(_ context.Context, jti uuid.UUID, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if expiresAt.After(s.now()) {
+		s.expiresAt[jti] = expiresAt
+	}
+	return nil
+}
+
+func (s *memoryRevokedTokenStore) IsRevoked(_ context.Context, jti uuid.UUID) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	exp, ok := s.expiresAt[jti]
+	return ok && exp.After(s.now()), nil
+}
+
+func (s *memoryRevokedTokenStore) PurgeExpired(_ context.Context, expiredBefore time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for id, exp := range s.expiresAt {
+		if exp.Before(expiredBefore) {
+			delete(s.expiresAt, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
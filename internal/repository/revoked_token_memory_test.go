@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMemoryRevokedTokenStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemoryRevokedTokenStore().(*memoryRevokedTokenStore)
+	store.now = func() time.Time { return now }
+
+	revoked := uuid.New()
+	store.Revoke(ctx, revoked, now.Add(time.Minute))
+
+	t.Run("Revoked", func(t *testing.T) {
+		if ok, _ := store.IsRevoked(ctx, revoked); !ok {
+			t.Error("expected token to be revoked")
+		}
+		if ok, _ := store.IsRevoked(ctx, uuid.New()); ok {
+			t.Error("expected unknown token not to be revoked")
+		}
+	})
+
+	t.Run("Evicted After Expiry", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		if ok, _ := store.IsRevoked(ctx, revoked); ok {
+			t.Error("expected expired entry to be ignored")
+		}
+
+		store.Revoke(ctx, uuid.New(), now.Add(time.Minute))
+		purged, err := store.PurgeExpired(ctx, now)
+		if err != nil || purged != 1 {
+			t.Errorf("expected 1 entry purged, got %d (%v)", purged, err)
+		}
+		if _, ok := store.expiresAt[revoked]; ok {
+			t.Error("expected expired entry to be evicted")
+		}
+		if len(store.expiresAt) != 1 {
+			t.Errorf("expected 1 entry, got %d", len(store.expiresAt))
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type revokedTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewRevokedTokenRepository creates a revocation store shared by every API instance.
+func NewRevokedTokenRepository(db *gorm.DB) domain.TokenRevocationStore {
+	return &revokedTokenRepository{db: db}
+}
+
+func (r *revokedTokenRepository) Revoke(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.RevokedToken{ID: jti, ExpiresAt: expiresAt}).Error
+}
+
+func (r *revokedTokenRepository) IsRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&domain.RevokedToken{}).
+		Where("id = ? AND expires_at > ?", jti, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *revokedTokenRepository) PurgeExpired(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < ?", expiredBefore).Delete(&domain.RevokedToken{})
+	return result.RowsAffected, result.Error
+}
@@ -1,6 +1,11 @@
 package repository
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/prachaya-orr/relearn-golang/internal/domain"
 	"gorm.io/gorm"
@@ -15,19 +20,93 @@ func NewTodoRepository(db *gorm.DB) domain.TodoRepository {
 	return &todoRepository{db: db}
 }
 
-func (r *todoRepository) Create(todo *domain.Todo) error {
-	return r.db.Create(todo).Error
+func (r *todoRepository) Create(ctx context.Context, todo *domain.Todo) error {
+	return r.db.WithContext(ctx).Create(todo).Error
+}
+
+// todoSortColumns maps the public sort fields to their database columns.
+var todoSortColumns = map[string]string{
+	domain.TodoSortTitle:     "title",
+	domain.TodoSortCreatedAt: "created_at",
+	domain.TodoSortUpdatedAt: "updated_at",
 }
 
-func (r *todoRepository) FindAll() ([]domain.Todo, error) {
+// likeEscaper escapes LIKE wildcards so search terms are matched literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (r *todoRepository) FindAll(ctx context.Context, query domain.TodoQuery) (*domain.TodoPage, error) {
+	column, ok := todoSortColumns[query.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown sort field %q", domain.ErrInvalidTodoQuery, query.SortBy)
+	}
+
+	db := r.db.WithContext(ctx)
+	if query.IncludeDeleted {
+		db = db.Unscoped()
+	}
+	db = db.Model(&domain.Todo{}).Where("user_id = ?", query.UserID)
+	if query.Completed != nil {
+		db = db.Where("completed = ?", *query.Completed)
+	}
+	if query.Search != "" {
+		pattern := "%" + likeEscaper.Replace(query.Search) + "%"
+		db = db.Where("(title ILIKE ? OR description ILIKE ?)", pattern, pattern)
+	}
+	// Reusable from here on: the count and the page query branch off the same filters.
+	db = db.Session(&gorm.Session{})
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	page := db.Order(fmt.Sprintf("%s %s, id %s", column, direction, direction))
+	if query.Cursor != nil {
+		value, err := cursorValue(query.SortBy, query.Cursor.Value)
+		if err != nil {
+			return nil, err
+		}
+		page = page.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, comparison), value, query.Cursor.ID)
+	} else if query.Offset > 0 {
+		page = page.Offset(query.Offset)
+	}
+
+	// Fetch one extra row to learn whether another page follows.
 	var todos []domain.Todo
-	err := r.db.Find(&todos).Error
-	return todos, err
+	if err := page.Limit(query.Limit + 1).Find(&todos).Error; err != nil {
+		return nil, err
+	}
+
+	result := &domain.TodoPage{Items: todos, Total: total, Limit: query.Limit}
+	if len(todos) > query.Limit {
+		result.Items = todos[:query.Limit]
+		result.NextCursor = domain.NewTodoCursor(result.Items[query.Limit-1], query.SortBy).Encode()
+	}
+	return result, nil
+}
+
+// cursorValue converts a cursor's sort key back to the column's type
+func cursorValue(sortBy, value string) (interface{}, error) {
+	switch sortBy {
+	case domain.TodoSortCreatedAt, domain.TodoSortUpdatedAt:
+		t, err := time.Parse(domain.TodoCursorTimeFormat, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", domain.ErrInvalidTodoQuery)
+		}
+		return t, nil
+	default:
+		return value, nil
+	}
 }
 
-func (r *todoRepository) FindByID(id uuid.UUID) (*domain.Todo, error) {
+func (r *todoRepository) FindByID(ctx context.Context, id, userID uuid.UUID) (*domain.Todo, error) {
 	var todo domain.Todo
-	err := r.db.First(&todo, "id = ?", id).Error
+	err := r.db.WithContext(ctx).First(&todo, "id = ? AND user_id = ?", id, userID).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil // Return nil if not found, not an error
@@ -37,14 +116,67 @@ func (r *todoRepository) FindByID(id uuid.UUID) (*domain.Todo, error) {
 	return &todo, nil
 }
 
-func (r *todoRepository) Update(todo *domain.Todo) error {
-	return r.db.Save(todo).Error
+func (r *todoRepository) Update(ctx context.Context, todo *domain.Todo) error {
+	// Compare-and-swap on version so concurrent writers cannot clobber each other.
+	result := r.db.WithContext(ctx).Model(todo).
+		Where("user_id = ? AND version = ?", todo.UserID, todo.Version).
+		Updates(map[string]interface{}{
+			"title":       todo.Title,
+			"description": todo.Description,
+			"completed":   todo.Completed,
+			"version":     gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrTodoVersionMismatch
+	}
+	todo.Version++
+	return nil
 }
 
-func (r *todoRepository) Delete(id uuid.UUID) error {
-	return r.db.Delete(&domain.Todo{}, "id = ?", id).Error
+func (r *todoRepository) Delete(ctx context.Context, id, userID uuid.UUID, version int64) error {
+	db := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID)
+	if version != 0 {
+		db = db.Where("version = ?", version)
+	}
+	result := db.Delete(&domain.Todo{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if version != 0 {
+			return domain.ErrTodoVersionMismatch
+		}
+		return domain.ErrTodoNotFound
+	}
+	return nil
+}
+
+func (r *todoRepository) DeleteAll(ctx context.Context) error {
+	return r.db.WithContext(ctx).Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&domain.Todo{}).Error
+}
+
+func (r *todoRepository) Restore(ctx context.Context, id, userID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Unscoped().Model(&domain.Todo{}).
+		Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, userID).
+		Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"version":    gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrTodoNotFound
+	}
+	return nil
 }
 
-func (r *todoRepository) DeleteAll() error {
-	return r.db.Exec("DELETE FROM todos").Error
+func (r *todoRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).
+		Delete(&domain.Todo{})
+	return result.RowsAffected, result.Error
 }
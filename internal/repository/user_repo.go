@@ -1,6 +1,12 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 	"github.com/prachaya-orr/relearn-golang/internal/domain"
 	"gorm.io/gorm"
 )
@@ -13,15 +19,138 @@ func NewUserRepository(db *gorm.DB) domain.UserRepository {
 	return &userRepository{db: db}
 }
 
-func (r *userRepository) Create(user *domain.User) error {
-	return r.db.Create(user).Error
+func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
+	err := r.db.WithContext(ctx).Create(user).Error
+	// Two concurrent sign-ups can both pass the service's existence check;
+	// the unique index settles it. Requires gorm.Config.TranslateError.
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return domain.ErrEmailTaken
+	}
+	return err
+}
+
+func (r *userRepository) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	var user domain.User
+	// Emails are stored lowercased; lower(email) also finds any stored before that.
+	err := r.db.WithContext(ctx).Where("lower(email) = ?", strings.ToLower(email)).First(&user).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
 }
 
-func (r *userRepository) FindByEmail(email string) (*domain.User, error) {
+func (r *userRepository) FindByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
 	var user domain.User
-	err := r.db.Where("email = ?", email).First(&user).Error
+	err := r.db.WithContext(ctx).First(&user, "id = ?", id).Error
 	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
 		return nil, err
 	}
 	return &user, nil
 }
+
+func (r *userRepository) FindAll(ctx context.Context, limit, offset int) (*domain.UserPage, error) {
+	page := &domain.UserPage{Limit: limit}
+	if err := r.db.WithContext(ctx).Model(&domain.User{}).Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+	err := r.db.WithContext(ctx).Order("created_at, id").Limit(limit).Offset(offset).Find(&page.Items).Error
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (r *userRepository) UpdateRole(ctx context.Context, id uuid.UUID, role domain.Role) error {
+	result := r.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&domain.User{}).
+		Where("id = ? AND email_verified_at IS NULL", id).
+		Update("email_verified_at", at).Error
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	result := r.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Update("password", passwordHash)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) SetPendingEmail(ctx context.Context, id uuid.UUID, email string) error {
+	result := r.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Update("pending_email", email)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) ConfirmEmail(ctx context.Context, id uuid.UUID, email string, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"email":             email,
+		"pending_email":     nil,
+		"email_verified_at": at,
+	})
+	if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+		return domain.ErrEmailTaken
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	// Unscoped: a soft-deleted user would keep their email taken and their data around.
+	// Everything the user owns is deleted here rather than left to ON DELETE
+	// CASCADE: databases set up by AutoMigrate have no foreign keys, and an API
+	// key that outlived its owner would still authenticate.
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", id).Delete(&domain.Todo{}).Error; err != nil {
+			return err
+		}
+		for _, owned := range []interface{}{
+			&domain.Identity{},
+			&domain.APIKey{},
+			&domain.RefreshToken{},
+			&domain.OneTimeToken{},
+			&domain.TOTPCredential{},
+			&domain.RecoveryCode{},
+		} {
+			if err := tx.Where("user_id = ?", id).Delete(owned).Error; err != nil {
+				return err
+			}
+		}
+		result := tx.Unscoped().Delete(&domain.User{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return domain.ErrUserNotFound
+		}
+		return nil
+	})
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// normalizeEmail is the form emails are stored and looked up in: addresses
+// that only differ in case or surrounding spaces belong to the same account.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// parseEmail normalizes email and checks that it is a bare address, without a display name.
+func parseEmail(email string) (string, error) {
+	email = normalizeEmail(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", domain.ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// accountEmails mails and redeems the one-time tokens of the email
+// verification, password reset and email change flows, for both userService and
+// userOldService. Tokens are 32 random bytes, stored hashed like refresh
+// tokens, and only the most recently mailed one of each flow works.
+type accountEmails struct {
+	tokens    domain.OneTimeTokenRepository
+	mailer    domain.Mailer
+	appURL    string
+	verifyTTL time.Duration
+	resetTTL  time.Duration
+	now       func() time.Time
+}
+
+func newAccountEmails(tokens domain.OneTimeTokenRepository, mailer domain.Mailer, cfg config.AuthConfig) *accountEmails {
+	return &accountEmails{
+		tokens:    tokens,
+		mailer:    mailer,
+		appURL:    strings.TrimSuffix(cfg.AppURL, "/"),
+		verifyTTL: cfg.EmailVerificationTTL,
+		resetTTL:  cfg.PasswordResetTTL,
+		now:       time.Now,
+	}
+}
+
+// sendVerification mails user the link that verifies their email
+func (a *accountEmails) sendVerification(ctx context.Context, user *domain.User) error {
+	return a.send(ctx, user, user.Email, domain.TokenPurposeVerifyEmail, a.verifyTTL, "/verify-email",
+		"Verify your email address",
+		"Welcome! Follow this link to verify your email address:\n\n%s\n\nThe link expires in %s. If you did not sign up, you can ignore this email.\n")
+}
+
+// sendPasswordReset mails user the link that lets them choose a new password
+func (a *accountEmails) sendPasswordReset(ctx context.Context, user *domain.User) error {
+	return a.send(ctx, user, user.Email, domain.TokenPurposeResetPassword, a.resetTTL, "/reset-password",
+		"Reset your password",
+		"Follow this link to choose a new password:\n\n%s\n\nThe link expires in %s. If you did not ask for it, you can ignore this email; your password stays as it is.\n")
+}
+
+// sendPasswordResetLater mails the reset link off the request path: how long
+// sending takes would otherwise tell known emails from unknown ones. The caller
+// can't be told about a failure either way, so it is only logged.
+func (a *accountEmails) sendPasswordResetLater(ctx context.Context, user *domain.User) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := a.sendPasswordReset(ctx, user); err != nil {
+			slog.ErrorContext(ctx, "failed to send password reset email", "user_id", user.ID, "error", err)
+		}
+	}()
+}
+
+// sendEmailChange mails newEmail the link that makes it user's email, and
+// lets the current address know, so a stolen session can't take the account
+// over unnoticed.
+func (a *accountEmails) sendEmailChange(ctx context.Context, user *domain.User, newEmail string) error {
+	err := a.mailer.Send(domain.MailMessage{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body:    fmt.Sprintf("Someone asked to change your account's email address to %s. It changes once the link mailed there is followed.\n\nIf it wasn't you, change your password now.\n", newEmail),
+	})
+	if err != nil {
+		return err
+	}
+	return a.send(ctx, user, newEmail, domain.TokenPurposeChangeEmail, a.verifyTTL, "/verify-email",
+		"Confirm your new email address",
+		"Follow this link to make this your account's email address:\n\n%s\n\nThe link expires in %s. If you did not ask for it, you can ignore this email.\n")
+}
+
+func (a *accountEmails) send(ctx context.Context, user *domain.User, to string, purpose domain.TokenPurpose, ttl time.Duration, path, subject, body string) error {
+	if err := a.tokens.InvalidateForUser(ctx, user.ID, purpose); err != nil {
+		return err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	record := &domain.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: a.now().Add(ttl),
+	}
+	if err := a.tokens.Create(ctx, record); err != nil {
+		return err
+	}
+
+	link := a.appURL + path + "?token=" + url.QueryEscape(token)
+	return a.mailer.Send(domain.MailMessage{
+		To:      to,
+		Subject: subject,
+		Body:    fmt.Sprintf(body, link, humanDuration(ttl)),
+	})
+}
+
+// use redeems a token found with lookup. Of two concurrent uses only one succeeds.
+func (a *accountEmails) use(ctx context.Context, record *domain.OneTimeToken) error {
+	return a.tokens.MarkUsed(ctx, record.ID)
+}
+
+// lookup returns the token mailed for one of purposes if it can still be
+// redeemed, without using it up (see use).
+func (a *accountEmails) lookup(ctx context.Context, token string, purposes ...domain.TokenPurpose) (*domain.OneTimeToken, error) {
+	record, err := a.tokens.FindByHash(ctx, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if record == nil || !slices.Contains(purposes, record.Purpose) || record.UsedAt != nil || !a.now().Before(record.ExpiresAt) {
+		return nil, domain.ErrInvalidOneTimeToken
+	}
+	return record, nil
+}
+
+// humanDuration spells out d for an email, e.g. "48 hours" or "30 minutes"
+func humanDuration(d time.Duration) string {
+	n, unit := int(d/time.Minute), "minute"
+	if d >= time.Hour && d%time.Hour == 0 {
+		n, unit = int(d/time.Hour), "hour"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
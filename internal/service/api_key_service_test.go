@@ -0,0 +1,178 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/service"
+)
+
+// MockAPIKeyRepository is an in-memory API key store
+type MockAPIKeyRepository struct {
+	keys map[uuid.UUID]*domain.APIKey
+}
+
+func NewMockAPIKeyRepo() *MockAPIKeyRepository {
+	return &MockAPIKeyRepository{keys: make(map[uuid.UUID]*domain.APIKey)}
+}
+
+func (m *MockAPIKeyRepository) Create(ctx context.Context, key *domain.APIKey) error {
+	key.ID = uuid.New()
+	key.CreatedAt = time.Now()
+	k := *key
+	m.keys[key.ID] = &k
+	return nil
+}
+
+func (m *MockAPIKeyRepository) FindByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	for _, key := range m.keys {
+		if key.KeyHash == keyHash {
+			k := *key
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockAPIKeyRepository) FindByUser(ctx context.Context, userID uuid.UUID) ([]domain.APIKey, error) {
+	var keys []domain.APIKey
+	for _, key := range m.keys {
+		if key.UserID == userID && key.RevokedAt == nil {
+			keys = append(keys, *key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *MockAPIKeyRepository) Revoke(ctx context.Context, id, userID uuid.UUID) error {
+	key, exists := m.keys[id]
+	if !exists || key.UserID != userID || key.RevokedAt != nil {
+		return domain.ErrAPIKeyNotFound
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	return nil
+}
+
+func (m *MockAPIKeyRepository) Touch(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	if key, exists := m.keys[id]; exists {
+		key.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+func TestAPIKeyService_Create(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockAPIKeyRepo()
+	svc := service.NewAPIKeyService(repo)
+	userID := uuid.New()
+
+	t.Run("Success", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour)
+		created, err := svc.Create(ctx, userID, " CI bot ", []domain.Scope{domain.ScopeTodosWrite, domain.ScopeTodosRead}, &expiresAt)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.HasPrefix(created.Key, created.Prefix) || !strings.HasPrefix(created.Key, "tk_") {
+			t.Errorf("expected key %q to start with prefix %q", created.Key, created.Prefix)
+		}
+		if created.Name != "CI bot" {
+			t.Errorf("expected trimmed name, got %q", created.Name)
+		}
+
+		stored := repo.keys[created.ID]
+		if stored.KeyHash == "" || strings.Contains(stored.KeyHash, created.Key) {
+			t.Error("expected only a hash of the key to be stored")
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		tests := []struct {
+			name      string
+			keyName   string
+			scopes    []domain.Scope
+			expiresAt *time.Time
+			want      error
+		}{
+			{name: "No Name", keyName: " ", scopes: []domain.Scope{domain.ScopeTodosRead}, want: domain.ErrAPIKeyNameRequired},
+			{name: "No Scopes", keyName: "bot", want: domain.ErrInvalidAPIKeyScope},
+			{name: "Unknown Scope", keyName: "bot", scopes: []domain.Scope{"admin"}, want: domain.ErrInvalidAPIKeyScope},
+			{name: "Expired", keyName: "bot", scopes: []domain.Scope{domain.ScopeTodosRead}, expiresAt: &past, want: domain.ErrAPIKeyExpiryInPast},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if _, err := svc.Create(ctx, userID, tt.keyName, tt.scopes, tt.expiresAt); !errors.Is(err, tt.want) {
+					t.Errorf("expected %v, got %v", tt.want, err)
+				}
+			})
+		}
+	})
+}
+
+func TestAPIKeyService_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockAPIKeyRepo()
+	svc := service.NewAPIKeyService(repo)
+	userID := uuid.New()
+	scopes := []domain.Scope{domain.ScopeTodosRead}
+
+	t.Run("Success", func(t *testing.T) {
+		created, _ := svc.Create(ctx, userID, "bot", scopes, nil)
+		key, err := svc.Authenticate(ctx, created.Key)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if key.UserID != userID || !key.Scopes.Has(domain.ScopeTodosRead) {
+			t.Errorf("expected the key to resolve to its owner and scopes, got %+v", key)
+		}
+		if repo.keys[created.ID].LastUsedAt == nil {
+			t.Error("expected last use to be recorded")
+		}
+	})
+
+	t.Run("Unknown Key", func(t *testing.T) {
+		if _, err := svc.Authenticate(ctx, "tk_unknown"); !errors.Is(err, domain.ErrInvalidAPIKey) {
+			t.Errorf("expected ErrInvalidAPIKey, got %v", err)
+		}
+	})
+
+	t.Run("Revoked", func(t *testing.T) {
+		created, _ := svc.Create(ctx, userID, "bot", scopes, nil)
+		if err := svc.Revoke(ctx, created.ID, userID); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := svc.Authenticate(ctx, created.Key); !errors.Is(err, domain.ErrInvalidAPIKey) {
+			t.Errorf("expected ErrInvalidAPIKey, got %v", err)
+		}
+		keys, _ := svc.List(ctx, userID)
+		for _, key := range keys {
+			if key.ID == created.ID {
+				t.Error("expected revoked keys to be left out of the list")
+			}
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour)
+		created, _ := svc.Create(ctx, userID, "bot", scopes, &expiresAt)
+		past := time.Now().Add(-time.Minute)
+		repo.keys[created.ID].ExpiresAt = &past
+
+		if _, err := svc.Authenticate(ctx, created.Key); !errors.Is(err, domain.ErrInvalidAPIKey) {
+			t.Errorf("expected ErrInvalidAPIKey, got %v", err)
+		}
+	})
+
+	t.Run("Revoke Other User's Key", func(t *testing.T) {
+		created, _ := svc.Create(ctx, userID, "bot", scopes, nil)
+		if err := svc.Revoke(ctx, created.ID, uuid.New()); !errors.Is(err, domain.ErrAPIKeyNotFound) {
+			t.Errorf("expected ErrAPIKeyNotFound, got %v", err)
+		}
+	})
+}
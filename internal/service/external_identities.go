@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// externalIdentities finds the user an identity provider's sign-in is for,
+// for both userService and userOldService, linking the identity to an
+// account the first time it is seen.
+type externalIdentities struct {
+	repo         domain.UserRepository
+	identities   domain.IdentityRepository
+	reauthWindow time.Duration
+	now          func() time.Time
+}
+
+func newExternalIdentities(repo domain.UserRepository, identities domain.IdentityRepository, cfg config.OIDCConfig) *externalIdentities {
+	return &externalIdentities{repo: repo, identities: identities, reauthWindow: cfg.ReauthWindow, now: time.Now}
+}
+
+// user returns the user linked to identity, linking or creating one first
+// for an identity not seen before
+func (e *externalIdentities) user(ctx context.Context, identity domain.ExternalIdentity) (*domain.User, error) {
+	linked, err := e.identities.FindByProviderSubject(ctx, identity.Provider, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if linked != nil {
+		user, err := e.repo.FindByID(ctx, linked.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, domain.ErrOIDCLoginFailed
+		}
+		if err := e.identities.MarkSignedIn(ctx, linked.ID, e.now()); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	// The email is all that ties a new identity to an account, so it has to be the user's for sure.
+	if !identity.EmailVerified {
+		return nil, domain.ErrExternalEmailNotVerified
+	}
+	email, err := parseEmail(identity.Email)
+	if err != nil {
+		return nil, err
+	}
+	signedInAt := e.now()
+	link := &domain.Identity{Provider: identity.Provider, Subject: identity.Subject, LastSignInAt: &signedInAt}
+
+	user, err := e.repo.FindByEmail(ctx, email)
+	if err != nil {
+		now := e.now()
+		user = &domain.User{Email: email, Role: domain.RoleUser, EmailVerifiedAt: &now}
+		if err := e.identities.CreateUser(ctx, user, link); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	if user.EmailVerifiedAt == nil {
+		// Whoever signed up with this email never proved it was theirs, so
+		// their password goes: it must not open the account of the email's owner.
+		if err := e.repo.UpdatePassword(ctx, user.ID, ""); err != nil {
+			return nil, err
+		}
+		now := e.now()
+		if err := e.repo.MarkEmailVerified(ctx, user.ID, now); err != nil {
+			return nil, err
+		}
+		user.Password, user.EmailVerifiedAt = "", &now
+	}
+	link.UserID = user.ID
+	if err := e.identities.Create(ctx, link); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// signedInRecently reports whether userID signed in with an identity provider
+// within the reauthentication window
+func (e *externalIdentities) signedInRecently(ctx context.Context, userID uuid.UUID) (bool, error) {
+	last, err := e.identities.LastSignInAt(ctx, userID)
+	if err != nil || last == nil {
+		return false, err
+	}
+	return e.now().Sub(*last) < e.reauthWindow, nil
+}
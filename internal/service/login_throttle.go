@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// loginThrottle slows down password guessing for both userService and
+// userOldService, per email and per client IP (see config.LoginConfig).
+// Only failed logins are counted, and a request turned away by the throttle
+// never reaches the password check, so waiting is the only way forward.
+type loginThrottle struct {
+	attempts domain.LoginAttemptStore
+	cfg      config.LoginConfig
+	now      func() time.Time
+}
+
+func newLoginThrottle(attempts domain.LoginAttemptStore, cfg config.LoginConfig) *loginThrottle {
+	return &loginThrottle{attempts: attempts, cfg: cfg, now: time.Now}
+}
+
+func emailAttemptKey(email string) string {
+	return "email:" + normalizeEmail(email)
+}
+
+func ipAttemptKey(clientIP string) string {
+	return "ip:" + clientIP
+}
+
+// check returns ErrTooManyLoginAttempts or ErrAccountLocked, wrapped with
+// the time to wait, while email or clientIP may not try again.
+func (t *loginThrottle) check(ctx context.Context, email, clientIP string) error {
+	if clientIP != "" {
+		if err := t.checkKey(ctx, ipAttemptKey(clientIP), t.cfg.IPFreeAttempts, false); err != nil {
+			return err
+		}
+	}
+	return t.checkKey(ctx, emailAttemptKey(email), t.cfg.FreeAttempts, true)
+}
+
+func (t *loginThrottle) checkKey(ctx context.Context, key string, freeAttempts int, lockout bool) error {
+	attempt, err := t.attempts.Get(ctx, key)
+	if err != nil || attempt == nil {
+		return err
+	}
+	now := t.now()
+	if now.Sub(attempt.LastFailedAt) >= t.cfg.LockoutDuration {
+		return nil // the tally has run out
+	}
+
+	// An IP is never locked out: that would lock out everyone behind it.
+	if lockout && attempt.Failures >= t.cfg.LockoutThreshold {
+		until := attempt.LastFailedAt.Add(t.cfg.LockoutDuration)
+		return domain.NewRetryAfterError(domain.ErrAccountLocked, until.Sub(now))
+	}
+	if until := attempt.LastFailedAt.Add(t.backoff(attempt.Failures, freeAttempts)); until.After(now) {
+		return domain.NewRetryAfterError(domain.ErrTooManyLoginAttempts, until.Sub(now))
+	}
+	return nil
+}
+
+// backoff is the wait after the given number of failures: none for the free
+// attempts, then BackoffBase, doubling with every further failure up to
+// LockoutDuration.
+func (t *loginThrottle) backoff(failures, freeAttempts int) time.Duration {
+	if failures < freeAttempts {
+		return 0
+	}
+	wait := t.cfg.BackoffBase
+	for i := freeAttempts; i < failures && wait < t.cfg.LockoutDuration; i++ {
+		wait *= 2
+	}
+	return min(wait, t.cfg.LockoutDuration)
+}
+
+// fail counts a failed login against both the email and the client IP
+func (t *loginThrottle) fail(ctx context.Context, email, clientIP string) error {
+	now := t.now()
+	resetBefore := now.Add(-t.cfg.LockoutDuration)
+	if _, err := t.attempts.RecordFailure(ctx, emailAttemptKey(email), now, resetBefore); err != nil {
+		return err
+	}
+	if clientIP != "" {
+		if _, err := t.attempts.RecordFailure(ctx, ipAttemptKey(clientIP), now, resetBefore); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// succeed forgets the email's failures. The IP's are kept: otherwise signing
+// in to one's own account would reset the count while guessing at others.
+func (t *loginThrottle) succeed(ctx context.Context, email string) error {
+	return t.attempts.Reset(ctx, emailAttemptKey(email))
+}
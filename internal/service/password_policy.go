@@ -0,0 +1,73 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// passwordPolicy checks new passwords for both userService and userOldService
+// (see config.PasswordConfig). Login does not use it, so passwords chosen
+// under an older policy keep working.
+type passwordPolicy struct {
+	cfg      config.PasswordConfig
+	breached domain.BreachedPasswordChecker // nil skips the breach check
+}
+
+func newPasswordPolicy(cfg config.PasswordConfig, breached domain.BreachedPasswordChecker) *passwordPolicy {
+	return &passwordPolicy{cfg: cfg, breached: breached}
+}
+
+// check returns ErrWeakPassword, with every rule password breaks, or nil.
+func (p *passwordPolicy) check(password, email string) error {
+	var violations []string
+	if utf8.RuneCountInString(password) < p.cfg.MinLength {
+		violations = append(violations, domain.PasswordMinLength)
+	}
+	if len(password) > p.cfg.MaxLength {
+		violations = append(violations, domain.PasswordMaxLength)
+	}
+	if charClasses(password) < p.cfg.MinCharClasses {
+		violations = append(violations, domain.PasswordCharClasses)
+	}
+	localPart, _, _ := strings.Cut(email, "@")
+	if strings.EqualFold(password, email) || strings.EqualFold(password, localPart) {
+		violations = append(violations, domain.PasswordIsEmail)
+	}
+	// The list is only worth consulting for a password that could be accepted otherwise.
+	if len(violations) == 0 && p.breached != nil {
+		breached, err := p.breached.IsBreached(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, domain.PasswordBreached)
+		}
+	}
+
+	if len(violations) > 0 {
+		return domain.NewViolationsError(domain.ErrWeakPassword, map[string][]string{"password": violations})
+	}
+	return nil
+}
+
+// charClasses counts which of lowercase, uppercase, digits and symbols (anything else) password uses
+func charClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+)
+
+// passwords hashes and checks passwords for both userService and
+// userOldService, with the configured domain.PasswordHasher.
+type passwords struct {
+	repo   domain.UserRepository
+	hasher domain.PasswordHasher
+	// dummy is checked when the email is unknown, so that a miss takes as
+	// long as a wrong password and can't be timed to find accounts.
+	dummy func() (string, error)
+}
+
+func newPasswords(repo domain.UserRepository, hasher domain.PasswordHasher) *passwords {
+	return &passwords{
+		repo:   repo,
+		hasher: hasher,
+		dummy: sync.OnceValues(func() (string, error) {
+			return hasher.Hash("not anyone's password")
+		}),
+	}
+}
+
+func (p *passwords) hash(password string) (string, error) {
+	return p.hasher.Hash(password)
+}
+
+// check reports whether password is user's. An account made by signing in
+// with an identity provider has no password, which no password matches.
+func (p *passwords) check(user *domain.User, password string) (bool, error) {
+	if user.Password == "" {
+		p.checkNobody(password)
+		return false, nil
+	}
+	return p.hasher.Verify(user.Password, password)
+}
+
+// checkNobody takes as long as check, for an email with no account
+func (p *passwords) checkNobody(password string) {
+	if hash, err := p.dummy(); err == nil {
+		p.hasher.Verify(hash, password)
+	}
+}
+
+// upgrade replaces user's hash when it was made with an outdated algorithm
+// or parameters; it can only be done at login, when the password is at
+// hand. A failed upgrade doesn't fail the login: the old hash still works,
+// and the next login tries again.
+func (p *passwords) upgrade(ctx context.Context, user *domain.User, password string) {
+	if !p.hasher.NeedsRehash(user.Password) {
+		return
+	}
+	hash, err := p.hasher.Hash(password)
+	if err == nil {
+		err = p.repo.UpdatePassword(ctx, user.ID, hash)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to rehash password", "user_id", user.ID, "error", err)
+	}
+}
+
+// reauthenticate checks password before user changes their account, as
+// if they were logging in: a wrong one counts as a failed login, so a stolen
+// session can't be used to guess the password either.
+//
+// An account made by signing in with an identity provider has no password to
+// give; a recent sign-in with the provider stands in for it. Without one the
+// change is refused with ErrReauthenticationRequired, which is not a failed
+// login: there is nothing to guess.
+func (p *passwords) reauthenticate(ctx context.Context, throttle *loginThrottle, external *externalIdentities, user *domain.User, password string) error {
+	if user.Password == "" {
+		recent, err := external.signedInRecently(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if !recent {
+			return domain.ErrReauthenticationRequired
+		}
+		return nil
+	}
+	if err := throttle.check(ctx, user.Email, ""); err != nil {
+		return err
+	}
+	ok, err := p.check(user, password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := throttle.fail(ctx, user.Email, ""); err != nil {
+			return err
+		}
+		return domain.ErrIncorrectPassword
+	}
+	return throttle.succeed(ctx, user.Email)
+}
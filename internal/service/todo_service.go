@@ -1,7 +1,11 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/prachaya-orr/relearn-golang/internal/domain"
@@ -17,9 +21,9 @@ func NewTodoService(repo domain.TodoRepository) domain.TodoService {
 	return &todoService{repo: repo}
 }
 
-func (s *todoService) Create(title, description string, userID uuid.UUID) (*domain.Todo, error) {
+func (s *todoService) Create(ctx context.Context, title, description string, userID uuid.UUID) (*domain.Todo, error) {
 	if title == "" {
-		return nil, errors.New("title is required")
+		return nil, domain.ErrTodoTitleRequired
 	}
 
 	todo := &domain.Todo{
@@ -28,29 +32,47 @@ func (s *todoService) Create(title, description string, userID uuid.UUID) (*doma
 		UserID:      userID,
 	}
 
-	if err := s.repo.Create(todo); err != nil {
+	if err := s.repo.Create(ctx, todo); err != nil {
 		return nil, err
 	}
 
 	return todo, nil
 }
 
-func (s *todoService) FindAll() ([]domain.Todo, error) {
-	return s.repo.FindAll()
+func (s *todoService) FindAll(ctx context.Context, query domain.TodoQuery) (*domain.TodoPage, error) {
+	if query.SortBy == "" {
+		query.SortBy = domain.TodoSortTitle
+	}
+	if !slices.Contains(domain.TodoSortFields, query.SortBy) {
+		return nil, fmt.Errorf("%w: unknown sort field %q", domain.ErrInvalidTodoQuery, query.SortBy)
+	}
+
+	switch {
+	case query.Limit <= 0:
+		query.Limit = domain.DefaultTodoPageSize
+	case query.Limit > domain.MaxTodoPageSize:
+		query.Limit = domain.MaxTodoPageSize
+	}
+
+	if query.Offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", domain.ErrInvalidTodoQuery)
+	}
+	if query.Cursor != nil && query.Offset > 0 {
+		return nil, fmt.Errorf("%w: cursor and offset cannot be combined", domain.ErrInvalidTodoQuery)
+	}
+
+	return s.repo.FindAll(ctx, query)
 }
 
-func (s *todoService) FindByID(id uuid.UUID) (*domain.Todo, error) {
-	return s.repo.FindByID(id)
+func (s *todoService) FindByID(ctx context.Context, id, userID uuid.UUID) (*domain.Todo, error) {
+	return s.repo.FindByID(ctx, id, userID)
 }
 
-func (s *todoService) Update(id uuid.UUID, title, description string, completed bool) (*domain.Todo, error) {
-	todo, err := s.repo.FindByID(id)
+func (s *todoService) Update(ctx context.Context, id, userID uuid.UUID, version int64, title, description string, completed bool) (*domain.Todo, error) {
+	todo, err := s.findForWrite(ctx, id, userID, version)
 	if err != nil {
 		return nil, err
 	}
-	if todo == nil {
-		return nil, errors.New("todo not found")
-	}
 
 	if title != "" {
 		todo.Title = title
@@ -58,17 +80,81 @@ func (s *todoService) Update(id uuid.UUID, title, description string, completed
 	todo.Description = description
 	todo.Completed = completed
 
-	if err := s.repo.Update(todo); err != nil {
+	if err := s.repo.Update(ctx, todo); err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+func (s *todoService) Patch(ctx context.Context, id, userID uuid.UUID, version int64, patch domain.TodoPatch) (*domain.Todo, error) {
+	if patch.Title != nil && *patch.Title == "" {
+		return nil, domain.ErrTodoTitleRequired
+	}
+
+	todo, err := s.findForWrite(ctx, id, userID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	patch.ApplyTo(todo)
+
+	if err := s.repo.Update(ctx, todo); err != nil {
 		return nil, err
 	}
 
 	return todo, nil
 }
 
-func (s *todoService) Delete(id uuid.UUID) error {
-	return s.repo.Delete(id)
+func (s *todoService) Delete(ctx context.Context, id, userID uuid.UUID, version int64) error {
+	if version != 0 {
+		// Look the todo up first so a missing todo is a 404 rather than a version mismatch.
+		if _, err := s.findForWrite(ctx, id, userID, version); err != nil {
+			return err
+		}
+	}
+	return s.repo.Delete(ctx, id, userID, version)
+}
+
+func (s *todoService) Restore(ctx context.Context, id, userID uuid.UUID) (*domain.Todo, error) {
+	err := s.repo.Restore(ctx, id, userID)
+	if err != nil && !errors.Is(err, domain.ErrTodoNotFound) {
+		return nil, err
+	}
+
+	// Restoring a todo that is not deleted is a no-op, so both paths end with a lookup.
+	todo, err := s.repo.FindByID(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, domain.ErrTodoNotFound
+	}
+	return todo, nil
+}
+
+func (s *todoService) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	if retention < 0 {
+		return 0, fmt.Errorf("retention must not be negative, got %s", retention)
+	}
+	return s.repo.Purge(ctx, time.Now().Add(-retention))
+}
+
+// findForWrite loads a todo that is about to be modified and checks the caller's expected version.
+func (s *todoService) findForWrite(ctx context.Context, id, userID uuid.UUID, version int64) (*domain.Todo, error) {
+	todo, err := s.repo.FindByID(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, domain.ErrTodoNotFound
+	}
+	if version != 0 && todo.Version != version {
+		return nil, domain.ErrTodoVersionMismatch
+	}
+	return todo, nil
 }
 
-func (s *todoService) DeleteAll() error {
-	return s.repo.DeleteAll()
+func (s *todoService) DeleteAll(ctx context.Context) error {
+	return s.repo.DeleteAll(ctx)
 }
@@ -1,11 +1,17 @@
 package service_test
 
 import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/prachaya-orr/relearn-golang/internal/domain"
 	"github.com/prachaya-orr/relearn-golang/internal/service"
+	"gorm.io/gorm"
 )
 
 // MockTodoRepository is a manual mock for testing
@@ -19,51 +25,146 @@ func NewMockTodoRepo() *MockTodoRepository {
 	}
 }
 
-func (m *MockTodoRepository) Create(todo *domain.Todo) error {
+func (m *MockTodoRepository) Create(ctx context.Context, todo *domain.Todo) error {
 	todo.ID = uuid.New()
+	todo.Version = 1
+	todo.CreatedAt = time.Now()
+	todo.UpdatedAt = todo.CreatedAt
 	m.todos[todo.ID] = *todo
 	return nil
 }
 
-func (m *MockTodoRepository) FindAll() ([]domain.Todo, error) {
+func (m *MockTodoRepository) FindAll(ctx context.Context, query domain.TodoQuery) (*domain.TodoPage, error) {
 	var list []domain.Todo
 	for _, t := range m.todos {
+		if t.UserID != query.UserID {
+			continue
+		}
+		if t.DeletedAt.Valid && !query.IncludeDeleted {
+			continue
+		}
+		if query.Completed != nil && t.Completed != *query.Completed {
+			continue
+		}
+		if query.Search != "" &&
+			!strings.Contains(strings.ToLower(t.Title), strings.ToLower(query.Search)) &&
+			!strings.Contains(strings.ToLower(t.Description), strings.ToLower(query.Search)) {
+			continue
+		}
 		list = append(list, t)
 	}
-	return list, nil
+
+	// Mirror the repository ordering: sort key first, ID as tie-breaker.
+	compare := func(a, b domain.TodoCursor) int {
+		if c := strings.Compare(a.Value, b.Value); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		c := compare(domain.NewTodoCursor(list[i], query.SortBy), domain.NewTodoCursor(list[j], query.SortBy))
+		if query.SortDesc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	page := &domain.TodoPage{Total: int64(len(list)), Limit: query.Limit}
+	start := 0
+	if query.Cursor != nil {
+		start = len(list)
+		for i, t := range list {
+			c := compare(domain.NewTodoCursor(t, query.SortBy), *query.Cursor)
+			if (!query.SortDesc && c > 0) || (query.SortDesc && c < 0) {
+				start = i
+				break
+			}
+		}
+	} else {
+		start = min(query.Offset, len(list))
+	}
+
+	end := min(start+query.Limit, len(list))
+	page.Items = list[start:end]
+	if end < len(list) {
+		page.NextCursor = domain.NewTodoCursor(page.Items[len(page.Items)-1], query.SortBy).Encode()
+	}
+	return page, nil
 }
 
-func (m *MockTodoRepository) FindByID(id uuid.UUID) (*domain.Todo, error) {
+func (m *MockTodoRepository) FindByID(ctx context.Context, id, userID uuid.UUID) (*domain.Todo, error) {
 	t, ok := m.todos[id]
-	if !ok {
+	if !ok || t.UserID != userID || t.DeletedAt.Valid {
 		return nil, nil // Not found
 	}
 	return &t, nil
 }
 
-func (m *MockTodoRepository) Update(todo *domain.Todo) error {
+func (m *MockTodoRepository) Update(ctx context.Context, todo *domain.Todo) error {
+	stored, ok := m.todos[todo.ID]
+	if !ok || stored.Version != todo.Version {
+		return domain.ErrTodoVersionMismatch
+	}
+	todo.Version++
+	todo.UpdatedAt = time.Now()
 	m.todos[todo.ID] = *todo
 	return nil
 }
 
-func (m *MockTodoRepository) Delete(id uuid.UUID) error {
-	delete(m.todos, id)
+func (m *MockTodoRepository) Delete(ctx context.Context, id, userID uuid.UUID, version int64) error {
+	t, ok := m.todos[id]
+	if !ok || t.UserID != userID || t.DeletedAt.Valid {
+		return domain.ErrTodoNotFound
+	}
+	if version != 0 && t.Version != version {
+		return domain.ErrTodoVersionMismatch
+	}
+	t.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	m.todos[id] = t
 	return nil
 }
 
-func (m *MockTodoRepository) DeleteAll() error {
-	m.todos = make(map[uuid.UUID]domain.Todo)
+func (m *MockTodoRepository) DeleteAll(ctx context.Context) error {
+	for id, t := range m.todos {
+		if !t.DeletedAt.Valid {
+			t.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			m.todos[id] = t
+		}
+	}
 	return nil
 }
 
+func (m *MockTodoRepository) Restore(ctx context.Context, id, userID uuid.UUID) error {
+	t, ok := m.todos[id]
+	if !ok || t.UserID != userID || !t.DeletedAt.Valid {
+		return domain.ErrTodoNotFound
+	}
+	t.DeletedAt = gorm.DeletedAt{}
+	t.Version++
+	m.todos[id] = t
+	return nil
+}
+
+func (m *MockTodoRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	for id, t := range m.todos {
+		if t.DeletedAt.Valid && t.DeletedAt.Time.Before(deletedBefore) {
+			delete(m.todos, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
 func TestCreateTodo(t *testing.T) {
+	ctx := context.Background()
 	repo := NewMockTodoRepo()
 	svc := service.NewTodoService(repo)
 
 	userID := uuid.New()
 
 	t.Run("Success", func(t *testing.T) {
-		todo, err := svc.Create("Test Todo", "Desc", userID)
+		todo, err := svc.Create(ctx, "Test Todo", "Desc", userID)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -76,41 +177,164 @@ func TestCreateTodo(t *testing.T) {
 	})
 
 	t.Run("Empty Title", func(t *testing.T) {
-		_, err := svc.Create("", "Desc", userID)
+		_, err := svc.Create(ctx, "", "Desc", userID)
 		if err == nil {
 			t.Error("expected error for empty title")
 		}
+		if !errors.Is(err, domain.ErrValidation) {
+			t.Errorf("expected a validation error, got %v", err)
+		}
 	})
 }
 
 func TestFindAll(t *testing.T) {
+	ctx := context.Background()
 	repo := NewMockTodoRepo()
 	svc := service.NewTodoService(repo)
 	userID := uuid.New()
 
 	// Seed data
-	svc.Create("Todo 1", "Desc 1", userID)
-	svc.Create("Todo 2", "Desc 2", userID)
+	svc.Create(ctx, "Todo 1", "Desc 1", userID)
+	svc.Create(ctx, "Todo 2", "Desc 2", userID)
 
-	list, err := svc.FindAll()
+	page, err := svc.FindAll(ctx, domain.TodoQuery{UserID: userID})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	if len(list) != 2 {
-		t.Errorf("expected 2 todos, got %d", len(list))
+	if len(page.Items) != 2 {
+		t.Errorf("expected 2 todos, got %d", len(page.Items))
 	}
+	if page.Total != 2 {
+		t.Errorf("expected total 2, got %d", page.Total)
+	}
+}
+
+func TestFindAllQuery(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockTodoRepo()
+	svc := service.NewTodoService(repo)
+	userID := uuid.New()
+
+	// Seed data: titles sort as A..E
+	for _, title := range []string{"C Walk dog", "A Buy milk", "E Pay rent", "B Buy bread", "D Call mom"} {
+		svc.Create(ctx, title, "Desc", userID)
+	}
+	done, _ := svc.Create(ctx, "F Buy eggs", "Done already", userID)
+	svc.Update(ctx, done.ID, userID, 0, done.Title, done.Description, true)
+
+	t.Run("Filter Completed", func(t *testing.T) {
+		completed := true
+		page, err := svc.FindAll(ctx, domain.TodoQuery{UserID: userID, Completed: &completed})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if page.Total != 1 || page.Items[0].ID != done.ID {
+			t.Errorf("expected only the completed todo, got %d todos", page.Total)
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		page, err := svc.FindAll(ctx, domain.TodoQuery{UserID: userID, Search: "buy"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if page.Total != 3 {
+			t.Errorf("expected 3 matches for 'buy', got %d", page.Total)
+		}
+	})
+
+	t.Run("Sort Descending", func(t *testing.T) {
+		page, err := svc.FindAll(ctx, domain.TodoQuery{UserID: userID, SortBy: domain.TodoSortTitle, SortDesc: true})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if page.Items[0].Title != "F Buy eggs" {
+			t.Errorf("expected 'F Buy eggs' first, got %s", page.Items[0].Title)
+		}
+	})
+
+	t.Run("Offset Pagination", func(t *testing.T) {
+		page, err := svc.FindAll(ctx, domain.TodoQuery{UserID: userID, Limit: 2, Offset: 2})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(page.Items) != 2 || page.Items[0].Title != "C Walk dog" {
+			t.Errorf("expected page starting at 'C Walk dog', got %v", page.Items)
+		}
+		if page.Total != 6 {
+			t.Errorf("expected total 6, got %d", page.Total)
+		}
+	})
+
+	t.Run("Cursor Pagination", func(t *testing.T) {
+		var titles []string
+		query := domain.TodoQuery{UserID: userID, Limit: 4}
+		for {
+			page, err := svc.FindAll(ctx, query)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			for _, todo := range page.Items {
+				titles = append(titles, todo.Title)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor, err = domain.DecodeTodoCursor(page.NextCursor)
+			if err != nil {
+				t.Fatalf("expected decodable cursor, got %v", err)
+			}
+		}
+		if len(titles) != 6 || titles[0] != "A Buy milk" || titles[5] != "F Buy eggs" {
+			t.Errorf("expected all 6 todos in order, got %v", titles)
+		}
+	})
+
+	t.Run("Default And Max Limit", func(t *testing.T) {
+		page, _ := svc.FindAll(ctx, domain.TodoQuery{UserID: userID})
+		if page.Limit != domain.DefaultTodoPageSize {
+			t.Errorf("expected default limit %d, got %d", domain.DefaultTodoPageSize, page.Limit)
+		}
+		page, _ = svc.FindAll(ctx, domain.TodoQuery{UserID: userID, Limit: 1000})
+		if page.Limit != domain.MaxTodoPageSize {
+			t.Errorf("expected limit capped at %d, got %d", domain.MaxTodoPageSize, page.Limit)
+		}
+	})
+
+	t.Run("Invalid Sort Field", func(t *testing.T) {
+		_, err := svc.FindAll(ctx, domain.TodoQuery{UserID: userID, SortBy: "password"})
+		if !errors.Is(err, domain.ErrInvalidTodoQuery) {
+			t.Errorf("expected ErrInvalidTodoQuery, got %v", err)
+		}
+	})
+
+	t.Run("Cursor With Offset", func(t *testing.T) {
+		cursor := domain.TodoCursor{Value: "A", ID: uuid.New()}
+		_, err := svc.FindAll(ctx, domain.TodoQuery{UserID: userID, Cursor: &cursor, Offset: 1})
+		if !errors.Is(err, domain.ErrInvalidTodoQuery) {
+			t.Errorf("expected ErrInvalidTodoQuery, got %v", err)
+		}
+	})
+
+	t.Run("Malformed Cursor", func(t *testing.T) {
+		_, err := domain.DecodeTodoCursor("not-a-cursor")
+		if !errors.Is(err, domain.ErrInvalidTodoQuery) {
+			t.Errorf("expected ErrInvalidTodoQuery, got %v", err)
+		}
+	})
 }
 
 func TestFindByID(t *testing.T) {
+	ctx := context.Background()
 	repo := NewMockTodoRepo()
 	svc := service.NewTodoService(repo)
 	userID := uuid.New()
 
-	created, _ := svc.Create("Todo 1", "Desc 1", userID)
+	created, _ := svc.Create(ctx, "Todo 1", "Desc 1", userID)
 
 	t.Run("Found", func(t *testing.T) {
-		found, err := svc.FindByID(created.ID)
+		found, err := svc.FindByID(ctx, created.ID, userID)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -123,7 +347,7 @@ func TestFindByID(t *testing.T) {
 	})
 
 	t.Run("Not Found", func(t *testing.T) {
-		found, err := svc.FindByID(uuid.New())
+		found, err := svc.FindByID(ctx, uuid.New(), userID)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -134,13 +358,14 @@ func TestFindByID(t *testing.T) {
 }
 
 func TestUpdate(t *testing.T) {
+	ctx := context.Background()
 	repo := NewMockTodoRepo()
 	svc := service.NewTodoService(repo)
 	userID := uuid.New()
-	created, _ := svc.Create("Original", "Original Desc", userID)
+	created, _ := svc.Create(ctx, "Original", "Original Desc", userID)
 
 	t.Run("Success", func(t *testing.T) {
-		updated, err := svc.Update(created.ID, "Updated", "Updated Desc", true)
+		updated, err := svc.Update(ctx, created.ID, userID, 0, "Updated", "Updated Desc", true)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -150,48 +375,311 @@ func TestUpdate(t *testing.T) {
 	})
 
 	t.Run("Not Found", func(t *testing.T) {
-		_, err := svc.Update(uuid.New(), "Title", "Desc", true)
+		_, err := svc.Update(ctx, uuid.New(), userID, 0, "Title", "Desc", true)
 		if err == nil {
 			t.Error("expected error for non-existent ID")
 		}
 		if err.Error() != "todo not found" {
 			t.Errorf("expected 'todo not found', got '%v'", err)
 		}
+		if !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("expected a not found error, got %v", err)
+		}
+	})
+}
+
+func TestPatch(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockTodoRepo()
+	svc := service.NewTodoService(repo)
+	userID := uuid.New()
+	created, _ := svc.Create(ctx, "Original", "Original Desc", userID)
+	svc.Update(ctx, created.ID, userID, 0, "Original", "Original Desc", true)
+
+	t.Run("Absent Fields Are Kept", func(t *testing.T) {
+		title := "Renamed"
+		patched, err := svc.Patch(ctx, created.ID, userID, 0, domain.TodoPatch{Title: &title})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if patched.Title != "Renamed" {
+			t.Errorf("expected title 'Renamed', got %s", patched.Title)
+		}
+		if patched.Description != "Original Desc" || !patched.Completed {
+			t.Error("expected description and completed to be untouched")
+		}
+	})
+
+	t.Run("Zero Values Are Applied", func(t *testing.T) {
+		empty, no := "", false
+		patched, err := svc.Patch(ctx, created.ID, userID, 0, domain.TodoPatch{Description: &empty, Completed: &no})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if patched.Description != "" || patched.Completed {
+			t.Error("expected description and completed to be cleared")
+		}
+		if patched.Title != "Renamed" {
+			t.Errorf("expected title to be untouched, got %s", patched.Title)
+		}
+	})
+
+	t.Run("Empty Title", func(t *testing.T) {
+		empty := ""
+		_, err := svc.Patch(ctx, created.ID, userID, 0, domain.TodoPatch{Title: &empty})
+		if !errors.Is(err, domain.ErrTodoTitleRequired) {
+			t.Errorf("expected ErrTodoTitleRequired, got %v", err)
+		}
+	})
+
+	t.Run("Foreign Todo", func(t *testing.T) {
+		done := true
+		_, err := svc.Patch(ctx, created.ID, uuid.New(), 0, domain.TodoPatch{Completed: &done})
+		if !errors.Is(err, domain.ErrTodoNotFound) {
+			t.Errorf("expected ErrTodoNotFound, got %v", err)
+		}
+	})
+}
+
+func TestOptimisticConcurrency(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockTodoRepo()
+	svc := service.NewTodoService(repo)
+	userID := uuid.New()
+	created, _ := svc.Create(ctx, "Shared", "Desc", userID)
+
+	t.Run("Writes Bump The Version", func(t *testing.T) {
+		updated, err := svc.Update(ctx, created.ID, userID, created.Version, "Shared", "Edited", false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if updated.Version != created.Version+1 {
+			t.Errorf("expected version %d, got %d", created.Version+1, updated.Version)
+		}
+	})
+
+	t.Run("Stale Update", func(t *testing.T) {
+		_, err := svc.Update(ctx, created.ID, userID, created.Version, "Shared", "Clobbered", false)
+		if !errors.Is(err, domain.ErrPreconditionFailed) {
+			t.Errorf("expected a precondition failure, got %v", err)
+		}
+	})
+
+	t.Run("Stale Patch", func(t *testing.T) {
+		done := true
+		_, err := svc.Patch(ctx, created.ID, userID, created.Version, domain.TodoPatch{Completed: &done})
+		if !errors.Is(err, domain.ErrTodoVersionMismatch) {
+			t.Errorf("expected ErrTodoVersionMismatch, got %v", err)
+		}
+	})
+
+	t.Run("Concurrent Write Between Read And Save", func(t *testing.T) {
+		// Simulate another client saving after this one read the todo.
+		current, _ := repo.FindByID(ctx, created.ID, userID)
+		stale := *current
+		repo.Update(ctx, current)
+
+		err := repo.Update(ctx, &stale)
+		if !errors.Is(err, domain.ErrTodoVersionMismatch) {
+			t.Errorf("expected ErrTodoVersionMismatch, got %v", err)
+		}
+	})
+
+	t.Run("Stale Delete", func(t *testing.T) {
+		err := svc.Delete(ctx, created.ID, userID, created.Version)
+		if !errors.Is(err, domain.ErrTodoVersionMismatch) {
+			t.Errorf("expected ErrTodoVersionMismatch, got %v", err)
+		}
+	})
+
+	t.Run("Delete With Current Version", func(t *testing.T) {
+		current, _ := svc.FindByID(ctx, created.ID, userID)
+		if err := svc.Delete(ctx, created.ID, userID, current.Version); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("Missing Todo Is Not A Version Mismatch", func(t *testing.T) {
+		err := svc.Delete(ctx, uuid.New(), userID, 1)
+		if !errors.Is(err, domain.ErrTodoNotFound) {
+			t.Errorf("expected ErrTodoNotFound, got %v", err)
+		}
 	})
 }
 
 func TestDelete(t *testing.T) {
+	ctx := context.Background()
 	repo := NewMockTodoRepo()
 	svc := service.NewTodoService(repo)
 	userID := uuid.New()
-	created, _ := svc.Create("To Delete", "Desc", userID)
+	created, _ := svc.Create(ctx, "To Delete", "Desc", userID)
 
-	err := svc.Delete(created.ID)
+	err := svc.Delete(ctx, created.ID, userID, 0)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
 	// Verify it's gone
-	found, _ := svc.FindByID(created.ID)
+	found, _ := svc.FindByID(ctx, created.ID, userID)
 	if found != nil {
 		t.Error("expected todo to be deleted")
 	}
 }
 
 func TestDeleteAll(t *testing.T) {
+	ctx := context.Background()
 	repo := NewMockTodoRepo()
 	svc := service.NewTodoService(repo)
 	userID := uuid.New()
-	svc.Create("Todo 1", "Desc", userID)
-	svc.Create("Todo 2", "Desc", userID)
+	svc.Create(ctx, "Todo 1", "Desc", userID)
+	svc.Create(ctx, "Todo 2", "Desc", userID)
 
-	err := svc.DeleteAll()
+	err := svc.DeleteAll(ctx)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	list, _ := svc.FindAll()
-	if len(list) != 0 {
-		t.Errorf("expected 0 todos after delete all, got %d", len(list))
+	page, _ := svc.FindAll(ctx, domain.TodoQuery{UserID: userID})
+	if len(page.Items) != 0 {
+		t.Errorf("expected 0 todos after delete all, got %d", len(page.Items))
+	}
+}
+
+func TestOwnershipIsolation(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockTodoRepo()
+	svc := service.NewTodoService(repo)
+	alice := uuid.New()
+	bob := uuid.New()
+
+	aliceTodo, _ := svc.Create(ctx, "Alice's Todo", "Private", alice)
+	svc.Create(ctx, "Bob's Todo", "Private", bob)
+
+	t.Run("FindAll Only Returns Own Todos", func(t *testing.T) {
+		page, err := svc.FindAll(ctx, domain.TodoQuery{UserID: bob})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(page.Items) != 1 {
+			t.Fatalf("expected 1 todo, got %d", len(page.Items))
+		}
+		if page.Items[0].UserID != bob {
+			t.Errorf("expected todo owned by %s, got %s", bob, page.Items[0].UserID)
+		}
+	})
+
+	t.Run("FindByID Hides Foreign Todo", func(t *testing.T) {
+		found, err := svc.FindByID(ctx, aliceTodo.ID, bob)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found != nil {
+			t.Error("expected foreign todo to be reported as not found")
+		}
+	})
+
+	t.Run("Update Foreign Todo", func(t *testing.T) {
+		_, err := svc.Update(ctx, aliceTodo.ID, bob, 0, "Hijacked", "", true)
+		if !errors.Is(err, domain.ErrTodoNotFound) {
+			t.Errorf("expected ErrTodoNotFound, got %v", err)
+		}
+
+		unchanged, _ := svc.FindByID(ctx, aliceTodo.ID, alice)
+		if unchanged.Title != "Alice's Todo" {
+			t.Errorf("expected title to be unchanged, got %s", unchanged.Title)
+		}
+	})
+
+	t.Run("Delete Foreign Todo", func(t *testing.T) {
+		err := svc.Delete(ctx, aliceTodo.ID, bob, 0)
+		if !errors.Is(err, domain.ErrTodoNotFound) {
+			t.Errorf("expected ErrTodoNotFound, got %v", err)
+		}
+
+		found, _ := svc.FindByID(ctx, aliceTodo.ID, alice)
+		if found == nil {
+			t.Error("expected todo to survive a foreign delete")
+		}
+	})
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockTodoRepo()
+	svc := service.NewTodoService(repo)
+	userID := uuid.New()
+	kept, _ := svc.Create(ctx, "Kept", "Desc", userID)
+	deleted, _ := svc.Create(ctx, "Deleted", "Desc", userID)
+
+	if err := svc.Delete(ctx, deleted.ID, userID, 0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("Hidden From Listing", func(t *testing.T) {
+		page, _ := svc.FindAll(ctx, domain.TodoQuery{UserID: userID})
+		if page.Total != 1 || page.Items[0].ID != kept.ID {
+			t.Errorf("expected only the kept todo, got %d todos", page.Total)
+		}
+	})
+
+	t.Run("Include Deleted", func(t *testing.T) {
+		page, _ := svc.FindAll(ctx, domain.TodoQuery{UserID: userID, IncludeDeleted: true})
+		if page.Total != 2 {
+			t.Errorf("expected 2 todos, got %d", page.Total)
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		restored, err := svc.Restore(ctx, deleted.ID, userID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if restored.DeletedAt.Valid {
+			t.Error("expected deleted_at to be cleared")
+		}
+
+		// Restoring again is a no-op
+		if _, err := svc.Restore(ctx, deleted.ID, userID); err != nil {
+			t.Errorf("expected no error restoring a live todo, got %v", err)
+		}
+	})
+
+	t.Run("Restore Foreign Todo", func(t *testing.T) {
+		svc.Delete(ctx, deleted.ID, userID, 0)
+		_, err := svc.Restore(ctx, deleted.ID, uuid.New())
+		if !errors.Is(err, domain.ErrTodoNotFound) {
+			t.Errorf("expected ErrTodoNotFound, got %v", err)
+		}
+	})
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockTodoRepo()
+	svc := service.NewTodoService(repo)
+	userID := uuid.New()
+	old, _ := svc.Create(ctx, "Old", "Desc", userID)
+	recent, _ := svc.Create(ctx, "Recent", "Desc", userID)
+	svc.Create(ctx, "Alive", "Desc", userID)
+
+	svc.Delete(ctx, old.ID, userID, 0)
+	svc.Delete(ctx, recent.ID, userID, 0)
+
+	// Backdate one deletion past the retention period
+	stale := repo.todos[old.ID]
+	stale.DeletedAt.Time = time.Now().Add(-48 * time.Hour)
+	repo.todos[old.ID] = stale
+
+	purged, err := svc.PurgeDeleted(ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("expected 1 todo purged, got %d", purged)
+	}
+
+	page, _ := svc.FindAll(ctx, domain.TodoQuery{UserID: userID, IncludeDeleted: true})
+	if page.Total != 2 {
+		t.Errorf("expected recently deleted and live todos to remain, got %d", page.Total)
 	}
 }
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
+)
+
+// tokenSessions issues, rotates and revokes token pairs for both userService
+// and userOldService. Refresh tokens are persisted, single-use, and rotate
+// within a family that starts at login. Revoking a family also revokes the
+// access tokens issued with it that may still be live.
+//
+// Access tokens carry the user's role. It is read again from the user on
+// every rotation, so a role change reaches clients within one access TTL.
+type tokenSessions struct {
+	users       domain.UserRepository
+	tokens      domain.RefreshTokenRepository
+	revocations domain.TokenRevocationStore
+	keys        *token.KeySet
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+}
+
+func newTokenSessions(users domain.UserRepository, tokens domain.RefreshTokenRepository, revocations domain.TokenRevocationStore, keys *token.KeySet, cfg config.AuthConfig) *tokenSessions {
+	return &tokenSessions{
+		users:       users,
+		tokens:      tokens,
+		revocations: revocations,
+		keys:        keys,
+		accessTTL:   cfg.AccessTokenTTL,
+		refreshTTL:  cfg.RefreshTokenTTL,
+	}
+}
+
+// hashToken is what the store keeps instead of the token itself
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// accessClaims are the claims of an access token for user.
+// jti lets the token be revoked before it expires.
+func (s *tokenSessions) accessClaims(user *domain.User, accessTokenID uuid.UUID) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":  s.keys.Issuer(),
+		"aud":  token.AudienceAccess,
+		"sub":  user.ID.String(),
+		"jti":  accessTokenID.String(),
+		"type": "access",
+		"role": string(user.Role),
+		"exp":  time.Now().Add(s.accessTTL).Unix(),
+	}
+}
+
+// issue signs a new token pair in the family and records the refresh token
+func (s *tokenSessions) issue(ctx context.Context, user *domain.User, familyID uuid.UUID) (*domain.TokenPair, error) {
+	userID := user.ID
+
+	// Access Token
+	accessTokenID := uuid.New()
+	accessTokenString, err := s.keys.Sign(s.accessClaims(user, accessTokenID))
+	if err != nil {
+		return nil, err
+	}
+
+	// Refresh Token
+	jti := uuid.New()
+	expiresAt := time.Now().Add(s.refreshTTL)
+	refreshTokenString, err := s.keys.Sign(jwt.MapClaims{
+		"iss":  s.keys.Issuer(),
+		"aud":  token.AudienceRefresh,
+		"sub":  userID.String(),
+		"jti":  jti.String(),
+		"type": "refresh",
+		"exp":  expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tokens.Create(ctx, &domain.RefreshToken{
+		ID:            jti,
+		UserID:        userID,
+		FamilyID:      familyID,
+		AccessTokenID: accessTokenID,
+		TokenHash:     hashToken(refreshTokenString),
+		ExpiresAt:     expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.TokenPair{
+		AccessToken:  accessTokenString,
+		RefreshToken: refreshTokenString,
+	}, nil
+}
+
+// find verifies a refresh token and returns its stored record
+func (s *tokenSessions) find(ctx context.Context, refreshTokenString string) (*domain.RefreshToken, error) {
+	claims := jwt.MapClaims{}
+	parsed, err := s.keys.Parse(refreshTokenString, token.AudienceRefresh, claims)
+	if errors.Is(err, jwt.ErrTokenInvalidAudience) {
+		return nil, domain.ErrInvalidTokenType
+	}
+	if err != nil || !parsed.Valid {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	// Verify it's a refresh token
+	if claims["type"] != "refresh" {
+		return nil, domain.ErrInvalidTokenType
+	}
+
+	sub, _ := claims["sub"].(string)
+	userID, err := uuid.Parse(sub)
+	if err != nil {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	// Tokens issued before the store existed carry no jti and are no longer accepted.
+	jti, _ := claims["jti"].(string)
+	id, err := uuid.Parse(jti)
+	if err != nil {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	record, err := s.tokens.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil || record.UserID != userID ||
+		subtle.ConstantTimeCompare([]byte(record.TokenHash), []byte(hashToken(refreshTokenString))) != 1 {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+	return record, nil
+}
+
+// redeem spends a refresh token so it can be rotated. Presenting a token that
+// was already spent means it leaked: the legitimate client or the attacker
+// holds a newer one, and we can't tell which, so the whole family is revoked.
+func (s *tokenSessions) redeem(ctx context.Context, refreshTokenString string) (*domain.RefreshToken, error) {
+	record, err := s.find(ctx, refreshTokenString)
+	if err != nil {
+		return nil, err
+	}
+	if record.RevokedAt != nil {
+		return nil, domain.ErrRefreshTokenRevoked
+	}
+
+	if record.UsedAt == nil {
+		err = s.tokens.MarkUsed(ctx, record.ID)
+	} else {
+		err = domain.ErrRefreshTokenReused
+	}
+	if errors.Is(err, domain.ErrRefreshTokenReused) {
+		if revokeErr := s.revokeFamily(ctx, record); revokeErr != nil {
+			return nil, revokeErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// rotate exchanges a refresh token for a new pair in the same family
+func (s *tokenSessions) rotate(ctx context.Context, refreshTokenString string) (*domain.TokenPair, error) {
+	record, err := s.redeem(ctx, refreshTokenString)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.FindByID(ctx, record.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+	return s.issue(ctx, user, record.FamilyID)
+}
+
+// impersonate signs an access token for user on behalf of actorID, who is
+// named in the "act" claim (RFC 8693). There is no refresh token, so the
+// session ends when the access token expires. The access token is still
+// recorded, in its own family and already revoked, so that signing the user
+// out everywhere reaches it too.
+func (s *tokenSessions) impersonate(ctx context.Context, actorID uuid.UUID, user *domain.User) (*domain.TokenPair, error) {
+	accessTokenID := uuid.New()
+	claims := s.accessClaims(user, accessTokenID)
+	claims["act"] = map[string]string{"sub": actorID.String()}
+	accessTokenString, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// No refresh token hashes to an empty TokenHash, so the record can never be redeemed.
+	now := time.Now()
+	err = s.tokens.Create(ctx, &domain.RefreshToken{
+		ID:            uuid.New(),
+		UserID:        user.ID,
+		FamilyID:      uuid.New(),
+		AccessTokenID: accessTokenID,
+		ExpiresAt:     now.Add(s.accessTTL),
+		RevokedAt:     &now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &domain.TokenPair{AccessToken: accessTokenString}, nil
+}
+
+// revoke revokes the family of a refresh token. Logging out twice is not an error.
+func (s *tokenSessions) revoke(ctx context.Context, refreshTokenString string) error {
+	record, err := s.find(ctx, refreshTokenString)
+	if err != nil {
+		return err
+	}
+	return s.revokeFamily(ctx, record)
+}
+
+// revokeFamily revokes every token descending from the same login as record
+func (s *tokenSessions) revokeFamily(ctx context.Context, record *domain.RefreshToken) error {
+	if err := s.tokens.RevokeFamily(ctx, record.FamilyID); err != nil {
+		return err
+	}
+	return s.revokeAccessTokens(ctx, record.UserID, record.FamilyID)
+}
+
+// revokeAll signs the user out everywhere
+func (s *tokenSessions) revokeAll(ctx context.Context, userID uuid.UUID) error {
+	if err := s.tokens.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.revokeAccessTokens(ctx, userID, uuid.Nil)
+}
+
+// revokeAccessTokens puts the user's access tokens that may not have expired
+// yet on the deny list, limited to one family unless familyID is uuid.Nil.
+// Every access token has a refresh token record, impersonation ones included,
+// so the records of the last accessTTL cover all of them.
+func (s *tokenSessions) revokeAccessTokens(ctx context.Context, userID, familyID uuid.UUID) error {
+	issued, err := s.tokens.FindIssuedSince(ctx, userID, time.Now().Add(-s.accessTTL))
+	if err != nil {
+		return err
+	}
+	for _, record := range issued {
+		if record.AccessTokenID == uuid.Nil || (familyID != uuid.Nil && record.FamilyID != familyID) {
+			continue
+		}
+		// The record is created right after the access token is signed, so this is never early.
+		if err := s.revocations.Revoke(ctx, record.AccessTokenID, record.CreatedAt.Add(s.accessTTL)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
+	"github.com/prachaya-orr/relearn-golang/internal/totp"
+)
+
+// recoveryCodeCount is how many recovery codes come with enrollment
+const recoveryCodeCount = 10
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// twoFactor runs TOTP two-factor authentication for both userService and
+// userOldService: enrollment, the MFA tokens Login returns in place of a
+// token pair, and checking the codes they are exchanged with.
+//
+// An MFA token is a JWT of type "mfa" for the user who gave the right
+// password. It is spent, by putting its jti on the deny list, once exchanged.
+type twoFactor struct {
+	repo        domain.MFARepository
+	revocations domain.TokenRevocationStore
+	keys        *token.KeySet
+	issuer      string
+	tokenTTL    time.Duration
+	now         func() time.Time
+}
+
+func newTwoFactor(repo domain.MFARepository, revocations domain.TokenRevocationStore, keys *token.KeySet, cfg config.AuthConfig) *twoFactor {
+	return &twoFactor{
+		repo:        repo,
+		revocations: revocations,
+		keys:        keys,
+		issuer:      cfg.MFA.Issuer,
+		tokenTTL:    cfg.MFA.TokenTTL,
+		now:         time.Now,
+	}
+}
+
+// enabled reports whether userID has to give a code to log in
+func (f *twoFactor) enabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	credential, err := f.repo.FindTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return credential != nil && credential.ConfirmedAt != nil, nil
+}
+
+// enroll gives user a new secret, replacing an enrollment that was never confirmed
+func (f *twoFactor) enroll(ctx context.Context, user *domain.User) (*domain.TOTPEnrollment, error) {
+	on, err := f.enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if on {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.repo.SaveTOTP(ctx, &domain.TOTPCredential{UserID: user.ID, Secret: secret}); err != nil {
+		return nil, err
+	}
+	return &domain.TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.URI(f.issuer, user.Email, secret),
+	}, nil
+}
+
+// confirm turns two-factor authentication on once code shows the app is set
+// up, and returns fresh recovery codes.
+func (f *twoFactor) confirm(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	credential, err := f.repo.FindTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil {
+		return nil, domain.ErrMFANotEnrolled
+	}
+	if credential.ConfirmedAt != nil {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+	step, ok, err := totp.Validate(credential.Secret, code, f.now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrInvalidMFACode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		secret := make([]byte, 5)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(secret))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+	// The confirming code counts as used
+	if err := f.repo.ConfirmTOTP(ctx, userID, f.now(), step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode forgives case, spaces and dashes in a recovery code
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+}
+
+// verify checks code, from the app or else one of the recovery codes, and
+// uses it up. It returns ErrInvalidMFACode for a wrong or used code.
+func (f *twoFactor) verify(ctx context.Context, userID uuid.UUID, code string) error {
+	credential, err := f.repo.FindTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	// Turned off since the password was checked; logging in again skips the code.
+	if credential == nil || credential.ConfirmedAt == nil {
+		return domain.ErrInvalidMFAToken
+	}
+
+	step, ok, err := totp.Validate(credential.Secret, code, f.now())
+	if err != nil {
+		return err
+	}
+	if ok {
+		return f.repo.UseTOTPStep(ctx, userID, step)
+	}
+	return f.repo.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)), f.now())
+}
+
+// issueToken signs the MFA token Login returns for user instead of a token pair
+func (f *twoFactor) issueToken(user *domain.User) (*domain.TokenPair, error) {
+	mfaToken, err := f.keys.Sign(jwt.MapClaims{
+		"iss":  f.keys.Issuer(),
+		"aud":  token.AudienceMFA,
+		"sub":  user.ID.String(),
+		"jti":  uuid.NewString(),
+		"type": "mfa",
+		"exp":  f.now().Add(f.tokenTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &domain.TokenPair{MFAToken: mfaToken}, nil
+}
+
+// mfaToken is a verified, unspent MFA token
+type mfaToken struct {
+	userID    uuid.UUID
+	id        uuid.UUID
+	expiresAt time.Time
+}
+
+// parseToken verifies an MFA token from issueToken that has not been spent
+func (f *twoFactor) parseToken(ctx context.Context, tokenString string) (*mfaToken, error) {
+	claims := jwt.MapClaims{}
+	parsed, err := f.keys.Parse(tokenString, token.AudienceMFA, claims)
+	if err != nil || !parsed.Valid || claims["type"] != "mfa" {
+		return nil, domain.ErrInvalidMFAToken
+	}
+	sub, _ := claims["sub"].(string)
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, domain.ErrInvalidMFAToken
+	}
+	parsedToken := &mfaToken{expiresAt: exp.Time}
+	if parsedToken.userID, err = uuid.Parse(sub); err != nil {
+		return nil, domain.ErrInvalidMFAToken
+	}
+	if parsedToken.id, err = uuid.Parse(jti); err != nil {
+		return nil, domain.ErrInvalidMFAToken
+	}
+
+	spent, err := f.revocations.IsRevoked(ctx, parsedToken.id)
+	if err != nil {
+		return nil, err
+	}
+	if spent {
+		return nil, domain.ErrInvalidMFAToken
+	}
+	return parsedToken, nil
+}
+
+// spend makes t unusable, once it has been exchanged for a token pair
+func (f *twoFactor) spend(ctx context.Context, t *mfaToken) error {
+	return f.revocations.Revoke(ctx, t.id, t.expiresAt)
+}
+
+// disable turns two-factor authentication off for userID
+func (f *twoFactor) disable(ctx context.Context, userID uuid.UUID) error {
+	return f.repo.Delete(ctx, userID)
+}
@@ -1,132 +1,409 @@
 package service
 
 import (
+	"context"
 	"errors"
-	"os"
+	"fmt"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
 	"github.com/prachaya-orr/relearn-golang/internal/domain"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type userOldService struct {
-	repo domain.UserRepository
+	repo      domain.UserRepository
+	sessions  *tokenSessions
+	throttle  *loginThrottle
+	emails    *accountEmails
+	policy    *passwordPolicy
+	passwords *passwords
+	twoFactor *twoFactor
+	external  *externalIdentities
 }
 
 // NewUserOldService creates a new instance of UserService using standard struct implementation
-func NewUserOldService(repo domain.UserRepository) domain.UserService {
+func NewUserOldService(deps UserDeps, cfg config.AuthConfig) domain.UserService {
 	return &userOldService{
-		repo: repo,
+		repo:      deps.Users,
+		sessions:  newTokenSessions(deps.Users, deps.RefreshTokens, deps.Revocations, deps.Keys, cfg),
+		throttle:  newLoginThrottle(deps.LoginAttempts, cfg.Login),
+		emails:    newAccountEmails(deps.OneTimeTokens, deps.Mailer, cfg),
+		policy:    newPasswordPolicy(cfg.Password, deps.Breached),
+		passwords: newPasswords(deps.Users, deps.Hasher),
+		twoFactor: newTwoFactor(deps.MFA, deps.Revocations, deps.Keys, cfg),
+		external:  newExternalIdentities(deps.Users, deps.Identities, cfg.OIDC),
 	}
 }
 
-func (s *userOldService) SignUp(email, password string) (*domain.User, error) {
+func (s *userOldService) SignUp(ctx context.Context, email, password string) (*domain.User, error) {
+	email, err := parseEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.check(password, email); err != nil {
+		return nil, err
+	}
+
 	// Check if user already exists
-	if _, err := s.repo.FindByEmail(email); err == nil {
-		return nil, errors.New("email already registered")
+	if _, err := s.repo.FindByEmail(ctx, email); err == nil {
+		return nil, domain.ErrEmailTaken
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.passwords.hash(password)
 	if err != nil {
 		return nil, err
 	}
 
 	user := &domain.User{
 		Email:    email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
+		Role:     domain.RoleUser,
 	}
 
-	if err := s.repo.Create(user); err != nil {
+	if err := s.repo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// Should the email not go out, the account still exists; /password/forgot sends a link that verifies it too.
+	if err := s.emails.sendVerification(ctx, user); err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
 
-func (s *userOldService) Login(email, password string) (*domain.TokenPair, error) {
-	user, err := s.repo.FindByEmail(email)
+func (s *userOldService) Login(ctx context.Context, email, password, clientIP string) (*domain.TokenPair, error) {
+	email = normalizeEmail(email)
+	if err := s.throttle.check(ctx, email, clientIP); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.FindByEmail(ctx, email)
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		// Unknown emails cost a password check too
+		s.passwords.checkNobody(password)
+		return nil, s.loginFailed(ctx, email, clientIP)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, errors.New("invalid credentials")
+	ok, err := s.passwords.check(user, password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, s.loginFailed(ctx, email, clientIP)
+	}
+	// With two-factor authentication on, the failures are only forgiven
+	// once the code is right too: LoginMFA counts wrong codes against the
+	// same email, which the password alone must not wipe.
+	on, err := s.twoFactor.enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !on {
+		if err := s.throttle.succeed(ctx, email); err != nil {
+			return nil, err
+		}
+	}
+	s.passwords.upgrade(ctx, user, password)
+	// Only checked now, so it doesn't tell anyone without the password whether the account exists.
+	if user.EmailVerifiedAt == nil {
+		return nil, domain.ErrEmailNotVerified
+	}
+	if on {
+		return s.twoFactor.issueToken(user)
+	}
+
+	// Every login starts a new token family
+	return s.generateTokens(ctx, user, uuid.New())
+}
+
+func (s *userOldService) LoginExternal(ctx context.Context, identity domain.ExternalIdentity) (*domain.TokenPair, error) {
+	user, err := s.external.user(ctx, identity)
+	if err != nil {
+		return nil, err
 	}
 
-	return s.generateTokens(user.ID)
+	on, err := s.twoFactor.enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if on {
+		return s.twoFactor.issueToken(user)
+	}
+	return s.generateTokens(ctx, user, uuid.New())
 }
 
-func (s *userOldService) RefreshToken(refreshTokenString string) (*domain.TokenPair, error) {
-	token, err := jwt.Parse(refreshTokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
+func (s *userOldService) LoginMFA(ctx context.Context, mfaToken, code, clientIP string) (*domain.TokenPair, error) {
+	pending, err := s.twoFactor.parseToken(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.repo.FindByID(ctx, pending.userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrInvalidMFAToken
+	}
+	if err := s.throttle.check(ctx, user.Email, clientIP); err != nil {
+		return nil, err
+	}
+
+	if err := s.twoFactor.verify(ctx, user.ID, code); err != nil {
+		if errors.Is(err, domain.ErrInvalidMFACode) {
+			if err := s.throttle.fail(ctx, user.Email, clientIP); err != nil {
+				return nil, err
+			}
 		}
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			secret = "secret"
+		return nil, err
+	}
+	if err := s.throttle.succeed(ctx, user.Email); err != nil {
+		return nil, err
+	}
+	if err := s.twoFactor.spend(ctx, pending); err != nil {
+		return nil, err
+	}
+	return s.generateTokens(ctx, user, uuid.New())
+}
+
+// loginFailed counts the failure and returns the error Login reports
+func (s *userOldService) loginFailed(ctx context.Context, email, clientIP string) error {
+	if err := s.throttle.fail(ctx, email, clientIP); err != nil {
+		return err
+	}
+	return domain.ErrInvalidCredentials
+}
+
+func (s *userOldService) RefreshToken(ctx context.Context, refreshTokenString string) (*domain.TokenPair, error) {
+	return s.sessions.rotate(ctx, refreshTokenString)
+}
+
+func (s *userOldService) Logout(ctx context.Context, refreshTokenString string) error {
+	return s.sessions.revoke(ctx, refreshTokenString)
+}
+
+func (s *userOldService) LogoutAll(ctx context.Context, userID uuid.UUID) error {
+	return s.sessions.revokeAll(ctx, userID)
+}
+
+func (s *userOldService) ListUsers(ctx context.Context, limit, offset int) (*domain.UserPage, error) {
+	switch {
+	case limit <= 0:
+		limit = domain.DefaultUserPageSize
+	case limit > domain.MaxUserPageSize:
+		limit = domain.MaxUserPageSize
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", domain.ErrInvalidUserQuery)
+	}
+	return s.repo.FindAll(ctx, limit, offset)
+}
+
+func (s *userOldService) Impersonate(ctx context.Context, adminID, userID uuid.UUID) (*domain.TokenPair, error) {
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	// Impersonation is for seeing what a user sees, not for acting under another admin's name.
+	if user.Role == domain.RoleAdmin {
+		return nil, domain.ErrCannotImpersonateAdmin
+	}
+	return s.sessions.impersonate(ctx, adminID, user)
+}
+
+func (s *userOldService) VerifyEmail(ctx context.Context, token string) error {
+	record, err := s.emails.lookup(ctx, token, domain.TokenPurposeVerifyEmail, domain.TokenPurposeChangeEmail)
+	if err != nil {
+		return err
+	}
+	if record.Purpose == domain.TokenPurposeVerifyEmail {
+		if err := s.emails.use(ctx, record); err != nil {
+			return err
 		}
-		return []byte(secret), nil
-	})
+		return s.repo.MarkEmailVerified(ctx, record.UserID, time.Now())
+	}
 
-	if err != nil || !token.Valid {
-		return nil, errors.New("invalid refresh token")
+	// Only the latest change_email token works, so it was mailed to the pending email.
+	user, err := s.repo.FindByID(ctx, record.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.PendingEmail == nil {
+		return domain.ErrInvalidOneTimeToken
 	}
+	if err := s.emails.use(ctx, record); err != nil {
+		return err
+	}
+	return s.repo.ConfirmEmail(ctx, user.ID, *user.PendingEmail, time.Now())
+}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, errors.New("invalid token claims")
+func (s *userOldService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.repo.FindByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil // see domain.UserService.ForgotPassword
+	}
+	if err != nil {
+		return err
 	}
+	s.emails.sendPasswordResetLater(ctx, user)
+	return nil
+}
 
-	// Verify it's a refresh token
-	if claims["type"] != "refresh" {
-		return nil, errors.New("invalid token type")
+func (s *userOldService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	record, err := s.emails.lookup(ctx, token, domain.TokenPurposeResetPassword)
+	if err != nil {
+		return err
+	}
+	userID := record.UserID
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return domain.ErrInvalidOneTimeToken
+	}
+	// Checked before the token is used up, so a refused password doesn't cost the link.
+	if err := s.policy.check(newPassword, user.Email); err != nil {
+		return err
+	}
+	if err := s.emails.use(ctx, record); err != nil {
+		return err
 	}
 
-	sub, ok := claims["sub"].(string)
-	if !ok {
-		return nil, errors.New("invalid token subject")
+	hashedPassword, err := s.passwords.hash(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		return err
+	}
+	// The link was read in the user's inbox, which is all verification proves.
+	if err := s.repo.MarkEmailVerified(ctx, userID, time.Now()); err != nil {
+		return err
+	}
+	if err := s.throttle.succeed(ctx, user.Email); err != nil {
+		return err
+	}
+	// Whoever knew the old password is signed out
+	return s.sessions.revokeAll(ctx, userID)
+}
+
+func (s *userOldService) GetUser(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *userOldService) ChangeEmail(ctx context.Context, userID uuid.UUID, newEmail, currentPassword string) (*domain.User, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.passwords.reauthenticate(ctx, s.throttle, s.external, user, currentPassword); err != nil {
+		return nil, err
+	}
+	newEmail, err = parseEmail(newEmail)
+	if err != nil {
+		return nil, err
+	}
+	// Checked again when the link is followed, in case someone signs up with it meanwhile.
+	if _, err := s.repo.FindByEmail(ctx, newEmail); err == nil {
+		return nil, domain.ErrEmailTaken
+	}
+
+	if err := s.repo.SetPendingEmail(ctx, user.ID, newEmail); err != nil {
+		return nil, err
 	}
+	if err := s.emails.sendEmailChange(ctx, user, newEmail); err != nil {
+		return nil, err
+	}
+	user.PendingEmail = &newEmail
+	return user, nil
+}
 
-	userID, err := uuid.Parse(sub)
+func (s *userOldService) ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) (*domain.TokenPair, error) {
+	user, err := s.GetUser(ctx, userID)
 	if err != nil {
-		return nil, errors.New("invalid user id in token")
+		return nil, err
+	}
+	if err := s.passwords.reauthenticate(ctx, s.throttle, s.external, user, currentPassword); err != nil {
+		return nil, err
+	}
+	if err := s.policy.check(newPassword, user.Email); err != nil {
+		return nil, err
 	}
 
-	return s.generateTokens(userID)
+	hashedPassword, err := s.passwords.hash(newPassword)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		return nil, err
+	}
+	// Every other session is signed out; the caller carries on with a new login.
+	if err := s.sessions.revokeAll(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return s.generateTokens(ctx, user, uuid.New())
 }
 
-func (s *userOldService) generateTokens(userID uuid.UUID) (*domain.TokenPair, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "secret"
+func (s *userOldService) DeleteAccount(ctx context.Context, userID uuid.UUID, currentPassword string) error {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.passwords.reauthenticate(ctx, s.throttle, s.external, user, currentPassword); err != nil {
+		return err
 	}
+	// Access tokens outlive the refresh tokens deleted with the user, so they are revoked first.
+	if err := s.sessions.revokeAll(ctx, user.ID); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, user.ID)
+}
 
-	// Access Token
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":  userID.String(),
-		"type": "access",
-		"exp":  time.Now().Add(time.Minute * 15).Unix(), // 15 minutes
-	})
-	accessTokenString, err := accessToken.SignedString([]byte(secret))
+func (s *userOldService) EnrollTOTP(ctx context.Context, userID uuid.UUID, currentPassword string) (*domain.TOTPEnrollment, error) {
+	user, err := s.GetUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.passwords.reauthenticate(ctx, s.throttle, s.external, user, currentPassword); err != nil {
+		return nil, err
+	}
+	return s.twoFactor.enroll(ctx, user)
+}
 
-	// Refresh Token
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":  userID.String(),
-		"type": "refresh",
-		"exp":  time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
-	})
-	refreshTokenString, err := refreshToken.SignedString([]byte(secret))
+func (s *userOldService) ConfirmTOTP(ctx context.Context, userID uuid.UUID, currentPassword, code string) ([]string, error) {
+	user, err := s.GetUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.passwords.reauthenticate(ctx, s.throttle, s.external, user, currentPassword); err != nil {
+		return nil, err
+	}
+	return s.twoFactor.confirm(ctx, user.ID, code)
+}
+
+func (s *userOldService) DisableMFA(ctx context.Context, userID uuid.UUID, currentPassword string) error {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.passwords.reauthenticate(ctx, s.throttle, s.external, user, currentPassword); err != nil {
+		return err
+	}
+	return s.twoFactor.disable(ctx, user.ID)
+}
 
-	return &domain.TokenPair{
-		AccessToken:  accessTokenString,
-		RefreshToken: refreshTokenString,
-	}, nil
+func (s *userOldService) generateTokens(ctx context.Context, user *domain.User, familyID uuid.UUID) (*domain.TokenPair, error) {
+	return s.sessions.issue(ctx, user, familyID)
 }
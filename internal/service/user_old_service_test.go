@@ -1,13 +1,18 @@
 package service_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
 	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/mailer"
 	"github.com/prachaya-orr/relearn-golang/internal/service"
+	"github.com/prachaya-orr/relearn-golang/internal/totp"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,14 +23,15 @@ import (
 // I can just reuse it!
 
 func TestUserOldService_SignUp(t *testing.T) {
+	ctx := context.Background()
 	repo := NewMockUserRepo()
-	svc := service.NewUserOldService(repo)
+	svc := service.NewUserOldService(newUserDeps(repo), config.Default().Auth)
 
 	t.Run("Success", func(t *testing.T) {
 		email := "test_old@example.com"
 		password := "password123"
 
-		user, err := svc.SignUp(email, password)
+		user, err := svc.SignUp(ctx, email, password)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -43,9 +49,9 @@ func TestUserOldService_SignUp(t *testing.T) {
 
 	t.Run("Duplicate Email", func(t *testing.T) {
 		email := "dup_old@example.com"
-		svc.SignUp(email, "pass")
+		svc.SignUp(ctx, email, "password123")
 
-		_, err := svc.SignUp(email, "pass2")
+		_, err := svc.SignUp(ctx, email, "password456")
 		if err == nil {
 			t.Error("expected error for duplicate email")
 		}
@@ -56,21 +62,23 @@ func TestUserOldService_SignUp(t *testing.T) {
 }
 
 func TestUserOldService_Login(t *testing.T) {
+	ctx := context.Background()
 	repo := NewMockUserRepo()
-	svc := service.NewUserOldService(repo)
+	svc := service.NewUserOldService(newUserDeps(repo), config.Default().Auth)
 
 	// Setup user
 	email := "login_old@example.com"
 	rawPassword := "secret"
 	hashed, _ := bcrypt.GenerateFromPassword([]byte(rawPassword), bcrypt.DefaultCost)
 
-	repo.Create(&domain.User{
-		Email:    email,
-		Password: string(hashed),
+	repo.Create(ctx, &domain.User{
+		Email:           email,
+		Password:        string(hashed),
+		EmailVerifiedAt: &verifiedAt,
 	})
 
 	t.Run("Success", func(t *testing.T) {
-		tokens, err := svc.Login(email, rawPassword)
+		tokens, err := svc.Login(ctx, email, rawPassword, "")
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -80,7 +88,7 @@ func TestUserOldService_Login(t *testing.T) {
 	})
 
 	t.Run("Invalid Password", func(t *testing.T) {
-		_, err := svc.Login(email, "wrongpass")
+		_, err := svc.Login(ctx, email, "wrongpass", "")
 		if err == nil {
 			t.Error("expected error for invalid password")
 		}
@@ -90,7 +98,7 @@ func TestUserOldService_Login(t *testing.T) {
 	})
 
 	t.Run("User Not Found", func(t *testing.T) {
-		_, err := svc.Login("nobody_old@example.com", "pass")
+		_, err := svc.Login(ctx, "nobody_old@example.com", "pass", "")
 		if err == nil {
 			t.Error("expected error for non-existent user")
 		}
@@ -98,39 +106,49 @@ func TestUserOldService_Login(t *testing.T) {
 }
 
 func TestUserOldService_RefreshToken(t *testing.T) {
+	ctx := context.Background()
 	repo := NewMockUserRepo()
-	svc := service.NewUserOldService(repo)
+	svc := service.NewUserOldService(newUserDeps(repo), config.Default().Auth)
 
 	email := "refresh_old@example.com"
-	user := &domain.User{Email: email, Password: "hash"}
-	repo.Create(user)
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := &domain.User{Email: email, Password: string(hashed), EmailVerifiedAt: &verifiedAt}
+	repo.Create(ctx, user)
 
-	// Helper to manually create valid token signed with "secret"
-	secret := "secret"
+	// Helper to manually create valid token signed with the service's keys
 	createToken := func(userID string, tokenType string, exp time.Duration) string {
 		claims := jwt.MapClaims{
+			"iss":  testKeys.Issuer(),
+			"aud":  tokenType,
 			"sub":  userID,
 			"type": tokenType,
 			"exp":  time.Now().Add(exp).Unix(),
 		}
-		t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		s, _ := t.SignedString([]byte(secret))
+		s, _ := testKeys.Sign(claims)
 		return s
 	}
 
 	t.Run("Success", func(t *testing.T) {
-		validRefresh := createToken(user.ID.String(), "refresh", time.Hour)
-		pair, err := svc.RefreshToken(validRefresh)
+		tokens, err := svc.Login(ctx, email, "secret", "")
+		if err != nil {
+			t.Fatalf("login failed: %v", err)
+		}
+		pair, err := svc.RefreshToken(ctx, tokens.RefreshToken)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
 		if pair.AccessToken == "" {
 			t.Error("expected new access token")
 		}
+
+		// The old token is single-use
+		if _, err := svc.RefreshToken(ctx, tokens.RefreshToken); !errors.Is(err, domain.ErrRefreshTokenReused) {
+			t.Errorf("expected ErrRefreshTokenReused, got %v", err)
+		}
 	})
 
 	t.Run("Invalid Token", func(t *testing.T) {
-		_, err := svc.RefreshToken("invalid.token.string")
+		_, err := svc.RefreshToken(ctx, "invalid.token.string")
 		if err == nil {
 			t.Error("expected error for invalid token")
 		}
@@ -138,7 +156,7 @@ func TestUserOldService_RefreshToken(t *testing.T) {
 
 	t.Run("Wrong Type (Access Token as Refresh)", func(t *testing.T) {
 		accessToken := createToken(user.ID.String(), "access", time.Minute)
-		_, err := svc.RefreshToken(accessToken)
+		_, err := svc.RefreshToken(ctx, accessToken)
 		if err == nil {
 			t.Error("expected error when using access token as refresh token")
 		}
@@ -147,3 +165,161 @@ func TestUserOldService_RefreshToken(t *testing.T) {
 		}
 	})
 }
+
+func TestUserOldService_Impersonate(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	svc := service.NewUserOldService(newUserDeps(repo), config.Default().Auth)
+
+	admin := &domain.User{Email: "admin_old@example.com", Role: domain.RoleAdmin}
+	user := &domain.User{Email: "user_old@example.com", Role: domain.RoleUser}
+	repo.Create(ctx, admin)
+	repo.Create(ctx, user)
+
+	tokens, err := svc.Impersonate(ctx, admin.ID, user.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if sub := accessClaims(t, tokens.AccessToken)["sub"]; sub != user.ID.String() {
+		t.Errorf("expected a token for the user, got sub %v", sub)
+	}
+
+	if _, err := svc.Impersonate(ctx, user.ID, admin.ID); !errors.Is(err, domain.ErrCannotImpersonateAdmin) {
+		t.Errorf("expected ErrCannotImpersonateAdmin, got %v", err)
+	}
+}
+
+func TestUserOldService_PasswordReset(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	outbox := mailer.NewOutbox("", "")
+	deps := newUserDeps(repo)
+	deps.Mailer = outbox
+	svc := service.NewUserOldService(deps, config.Default().Auth)
+
+	if _, err := svc.SignUp(ctx, "reset_old@example.com", "old-secret"); err != nil {
+		t.Fatalf("sign up failed: %v", err)
+	}
+	if err := svc.VerifyEmail(ctx, mailedToken(t, outbox)); err != nil {
+		t.Fatalf("verification failed: %v", err)
+	}
+	tokens, err := svc.Login(ctx, "reset_old@example.com", "old-secret", "")
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	forgotPassword(t, svc, outbox, "reset_old@example.com")
+	if err := svc.ResetPassword(ctx, mailedToken(t, outbox), "new-secret"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := svc.RefreshToken(ctx, tokens.RefreshToken); err == nil {
+		t.Error("expected sessions from before the reset to be signed out")
+	}
+	if _, err := svc.Login(ctx, "reset_old@example.com", "new-secret", ""); err != nil {
+		t.Errorf("expected the new password to work, got %v", err)
+	}
+}
+
+func TestUserOldService_Account(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	outbox := mailer.NewOutbox("", "")
+	deps := newUserDeps(repo)
+	deps.Mailer = outbox
+	svc := service.NewUserOldService(deps, config.Default().Auth)
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := &domain.User{Email: "me_old@example.com", Password: string(hashed), EmailVerifiedAt: &verifiedAt}
+	repo.Create(ctx, user)
+
+	if _, err := svc.ChangePassword(ctx, user.ID, "wrong", "new-secret-1"); !errors.Is(err, domain.ErrIncorrectPassword) {
+		t.Errorf("expected ErrIncorrectPassword, got %v", err)
+	}
+	if _, err := svc.ChangePassword(ctx, user.ID, "secret", "new-secret-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := svc.ChangeEmail(ctx, user.ID, "new_old@example.com", "new-secret-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := svc.VerifyEmail(ctx, mailedToken(t, outbox)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := svc.Login(ctx, "new_old@example.com", "new-secret-1", ""); err != nil {
+		t.Errorf("expected the new email to work, got %v", err)
+	}
+
+	if err := svc.DeleteAccount(ctx, user.ID, "new-secret-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := svc.GetUser(ctx, user.ID); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("expected the user to be gone, got %v", err)
+	}
+}
+
+func TestUserOldService_TwoFactor(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	svc := service.NewUserOldService(newUserDeps(repo), config.Default().Auth)
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := &domain.User{Email: "mfa_old@example.com", Password: string(hashed), EmailVerifiedAt: &verifiedAt}
+	repo.Create(ctx, user)
+
+	enrollment, err := svc.EnrollTOTP(ctx, user.ID, "secret")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	recoveryCodes, err := svc.ConfirmTOTP(ctx, user.ID, "secret", code)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tokens, err := svc.Login(ctx, "mfa_old@example.com", "secret", "")
+	if err != nil || tokens.MFAToken == "" || tokens.AccessToken != "" {
+		t.Fatalf("expected only an MFA token, got %+v, %v", tokens, err)
+	}
+	if _, err := svc.LoginMFA(ctx, tokens.MFAToken, code, ""); !errors.Is(err, domain.ErrInvalidMFACode) {
+		t.Errorf("expected a used code to be refused, got %v", err)
+	}
+	if _, err := svc.LoginMFA(ctx, tokens.MFAToken, recoveryCodes[0], ""); err != nil {
+		t.Errorf("expected the recovery code to work, got %v", err)
+	}
+
+	if err := svc.DisableMFA(ctx, user.ID, "secret"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if tokens, err := svc.Login(ctx, "mfa_old@example.com", "secret", ""); err != nil || tokens.AccessToken == "" {
+		t.Errorf("expected a plain login again, got %+v, %v", tokens, err)
+	}
+}
+
+func TestUserOldService_LoginExternal(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	svc := service.NewUserOldService(newUserDeps(repo), config.Default().Auth)
+	identity := domain.ExternalIdentity{Provider: "fake", Subject: "old", Email: "external_old@example.com", EmailVerified: true}
+
+	first, err := svc.LoginExternal(ctx, identity)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	user := repo.users["external_old@example.com"]
+	if user == nil || user.Password != "" {
+		t.Fatalf("expected an account without a password, got %+v", user)
+	}
+
+	again, err := svc.LoginExternal(ctx, identity)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if accessClaims(t, first.AccessToken)["sub"] != accessClaims(t, again.AccessToken)["sub"] {
+		t.Error("expected the same account both times")
+	}
+
+	identity.Subject, identity.EmailVerified = "other", false
+	if _, err := svc.LoginExternal(ctx, identity); !errors.Is(err, domain.ErrExternalEmailNotVerified) {
+		t.Errorf("expected ErrExternalEmailNotVerified, got %v", err)
+	}
+}
@@ -1,109 +1,214 @@
 package service
 
 import (
+	"context"
 	"errors"
-	"os"
+	"fmt"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
 	"github.com/prachaya-orr/relearn-golang/internal/domain"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
 )
 
 type userService struct {
-	signUp       func(email, password string) (*domain.User, error)
-	login        func(email, password string) (*domain.TokenPair, error)
-	refreshToken func(refreshToken string) (*domain.TokenPair, error)
+	signUp         func(ctx context.Context, email, password string) (*domain.User, error)
+	login          func(ctx context.Context, email, password, clientIP string) (*domain.TokenPair, error)
+	loginExternal  func(ctx context.Context, identity domain.ExternalIdentity) (*domain.TokenPair, error)
+	loginMFA       func(ctx context.Context, mfaToken, code, clientIP string) (*domain.TokenPair, error)
+	refreshToken   func(ctx context.Context, refreshToken string) (*domain.TokenPair, error)
+	logout         func(ctx context.Context, refreshToken string) error
+	logoutAll      func(ctx context.Context, userID uuid.UUID) error
+	listUsers      func(ctx context.Context, limit, offset int) (*domain.UserPage, error)
+	impersonate    func(ctx context.Context, adminID, userID uuid.UUID) (*domain.TokenPair, error)
+	verifyEmail    func(ctx context.Context, token string) error
+	forgotPassword func(ctx context.Context, email string) error
+	resetPassword  func(ctx context.Context, token, newPassword string) error
+	getUser        func(ctx context.Context, userID uuid.UUID) (*domain.User, error)
+	changeEmail    func(ctx context.Context, userID uuid.UUID, newEmail, currentPassword string) (*domain.User, error)
+	changePassword func(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) (*domain.TokenPair, error)
+	deleteAccount  func(ctx context.Context, userID uuid.UUID, currentPassword string) error
+	enrollTOTP     func(ctx context.Context, userID uuid.UUID, currentPassword string) (*domain.TOTPEnrollment, error)
+	confirmTOTP    func(ctx context.Context, userID uuid.UUID, currentPassword, code string) ([]string, error)
+	disableMFA     func(ctx context.Context, userID uuid.UUID, currentPassword string) error
 }
 
-func NewUserService(repo domain.UserRepository) domain.UserService {
+// UserDeps are the stores and services a UserService is built on, for
+// NewUserService and NewUserOldService alike.
+type UserDeps struct {
+	Users         domain.UserRepository
+	RefreshTokens domain.RefreshTokenRepository
+	Revocations   domain.TokenRevocationStore
+	LoginAttempts domain.LoginAttemptStore
+	OneTimeTokens domain.OneTimeTokenRepository
+	MFA           domain.MFARepository
+	Identities    domain.IdentityRepository
+	Mailer        domain.Mailer
+	// Breached is optional: without it, new passwords are only checked against the policy.
+	Breached domain.BreachedPasswordChecker
+	Hasher   domain.PasswordHasher
+	Keys     *token.KeySet
+}
+
+func NewUserService(deps UserDeps, cfg config.AuthConfig) domain.UserService {
+	repo := deps.Users
+	sessions := newTokenSessions(repo, deps.RefreshTokens, deps.Revocations, deps.Keys, cfg)
+	throttle := newLoginThrottle(deps.LoginAttempts, cfg.Login)
+	emails := newAccountEmails(deps.OneTimeTokens, deps.Mailer, cfg)
+	policy := newPasswordPolicy(cfg.Password, deps.Breached)
+	passwords := newPasswords(repo, deps.Hasher)
+	twoFactor := newTwoFactor(deps.MFA, deps.Revocations, deps.Keys, cfg)
+	external := newExternalIdentities(repo, deps.Identities, cfg.OIDC)
 	// Private helper for token generation, closed over by other functions if needed,
 	// or kept as a private utility within the closure scope.
 	// In this design, we can inject it or keep it internal.
 	// Let's keep it as a shared private function for the factories.
-	genToken := newTokenGenerator()
+	genToken := newTokenGenerator(sessions)
 
 	return &userService{
-		signUp:       newSignUpFunc(repo),
-		login:        newLoginFunc(repo, genToken),
-		refreshToken: newRefreshTokenFunc(repo, genToken),
+		signUp:         newSignUpFunc(repo, policy, passwords, emails),
+		login:          newLoginFunc(repo, throttle, passwords, twoFactor, genToken),
+		loginExternal:  newLoginExternalFunc(external, twoFactor, genToken),
+		loginMFA:       newLoginMFAFunc(repo, throttle, twoFactor, genToken),
+		refreshToken:   newRefreshTokenFunc(sessions),
+		logout:         newLogoutFunc(sessions),
+		logoutAll:      newLogoutAllFunc(sessions),
+		listUsers:      newListUsersFunc(repo),
+		impersonate:    newImpersonateFunc(repo, sessions),
+		verifyEmail:    newVerifyEmailFunc(repo, emails),
+		forgotPassword: newForgotPasswordFunc(repo, emails),
+		resetPassword:  newResetPasswordFunc(repo, policy, passwords, emails, sessions, throttle),
+		getUser:        newGetUserFunc(repo),
+		changeEmail:    newChangeEmailFunc(repo, throttle, passwords, external, emails),
+		changePassword: newChangePasswordFunc(repo, policy, throttle, passwords, external, sessions),
+		deleteAccount:  newDeleteAccountFunc(repo, throttle, passwords, external, sessions),
+		enrollTOTP:     newEnrollTOTPFunc(repo, throttle, passwords, external, twoFactor),
+		confirmTOTP:    newConfirmTOTPFunc(repo, throttle, passwords, external, twoFactor),
+		disableMFA:     newDisableMFAFunc(repo, throttle, passwords, external, twoFactor),
 	}
 }
 
-func (s *userService) SignUp(email, password string) (*domain.User, error) {
-	return s.signUp(email, password)
+func (s *userService) SignUp(ctx context.Context, email, password string) (*domain.User, error) {
+	return s.signUp(ctx, email, password)
+}
+
+func (s *userService) Login(ctx context.Context, email, password, clientIP string) (*domain.TokenPair, error) {
+	return s.login(ctx, email, password, clientIP)
+}
+
+func (s *userService) LoginExternal(ctx context.Context, identity domain.ExternalIdentity) (*domain.TokenPair, error) {
+	return s.loginExternal(ctx, identity)
+}
+
+func (s *userService) LoginMFA(ctx context.Context, mfaToken, code, clientIP string) (*domain.TokenPair, error) {
+	return s.loginMFA(ctx, mfaToken, code, clientIP)
+}
+
+func (s *userService) RefreshToken(ctx context.Context, refreshToken string) (*domain.TokenPair, error) {
+	return s.refreshToken(ctx, refreshToken)
+}
+
+func (s *userService) Logout(ctx context.Context, refreshToken string) error {
+	return s.logout(ctx, refreshToken)
+}
+
+func (s *userService) LogoutAll(ctx context.Context, userID uuid.UUID) error {
+	return s.logoutAll(ctx, userID)
+}
+
+func (s *userService) ListUsers(ctx context.Context, limit, offset int) (*domain.UserPage, error) {
+	return s.listUsers(ctx, limit, offset)
+}
+
+func (s *userService) Impersonate(ctx context.Context, adminID, userID uuid.UUID) (*domain.TokenPair, error) {
+	return s.impersonate(ctx, adminID, userID)
+}
+
+func (s *userService) VerifyEmail(ctx context.Context, token string) error {
+	return s.verifyEmail(ctx, token)
+}
+
+func (s *userService) ForgotPassword(ctx context.Context, email string) error {
+	return s.forgotPassword(ctx, email)
+}
+
+func (s *userService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	return s.resetPassword(ctx, token, newPassword)
+}
+
+func (s *userService) GetUser(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	return s.getUser(ctx, userID)
 }
 
-func (s *userService) Login(email, password string) (*domain.TokenPair, error) {
-	return s.login(email, password)
+func (s *userService) ChangeEmail(ctx context.Context, userID uuid.UUID, newEmail, currentPassword string) (*domain.User, error) {
+	return s.changeEmail(ctx, userID, newEmail, currentPassword)
 }
 
-func (s *userService) RefreshToken(refreshToken string) (*domain.TokenPair, error) {
-	return s.refreshToken(refreshToken)
+func (s *userService) ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) (*domain.TokenPair, error) {
+	return s.changePassword(ctx, userID, currentPassword, newPassword)
+}
+
+func (s *userService) DeleteAccount(ctx context.Context, userID uuid.UUID, currentPassword string) error {
+	return s.deleteAccount(ctx, userID, currentPassword)
+}
+
+func (s *userService) EnrollTOTP(ctx context.Context, userID uuid.UUID, currentPassword string) (*domain.TOTPEnrollment, error) {
+	return s.enrollTOTP(ctx, userID, currentPassword)
+}
+
+func (s *userService) ConfirmTOTP(ctx context.Context, userID uuid.UUID, currentPassword, code string) ([]string, error) {
+	return s.confirmTOTP(ctx, userID, currentPassword, code)
+}
+
+func (s *userService) DisableMFA(ctx context.Context, userID uuid.UUID, currentPassword string) error {
+	return s.disableMFA(ctx, userID, currentPassword)
 }
 
 // -------------------------------------------------------------------------
 // Functional Implementations
 // -------------------------------------------------------------------------
 
-// TokenGeneratorFunc is a type for the token generation logic
-type TokenGeneratorFunc func(userID uuid.UUID) (*domain.TokenPair, error)
+// TokenGeneratorFunc is a type for the token generation logic.
+// familyID ties the refresh token to the login it descends from.
+type TokenGeneratorFunc func(ctx context.Context, user *domain.User, familyID uuid.UUID) (*domain.TokenPair, error)
 
-func newTokenGenerator() TokenGeneratorFunc {
-	return func(userID uuid.UUID) (*domain.TokenPair, error) {
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			secret = "secret"
-		}
+func newTokenGenerator(sessions *tokenSessions) TokenGeneratorFunc {
+	return sessions.issue
+}
 
-		// Access Token
-		accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"sub":  userID.String(),
-			"type": "access",
-			"exp":  time.Now().Add(time.Minute * 15).Unix(), // 15 minutes
-		})
-		accessTokenString, err := accessToken.SignedString([]byte(secret))
+func newSignUpFunc(repo domain.UserRepository, policy *passwordPolicy, passwords *passwords, emails *accountEmails) func(ctx context.Context, email, password string) (*domain.User, error) {
+	return func(ctx context.Context, email, password string) (*domain.User, error) {
+		email, err := parseEmail(email)
 		if err != nil {
 			return nil, err
 		}
-
-		// Refresh Token
-		refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"sub":  userID.String(),
-			"type": "refresh",
-			"exp":  time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
-		})
-		refreshTokenString, err := refreshToken.SignedString([]byte(secret))
-		if err != nil {
+		if err := policy.check(password, email); err != nil {
 			return nil, err
 		}
 
-		return &domain.TokenPair{
-			AccessToken:  accessTokenString,
-			RefreshToken: refreshTokenString,
-		}, nil
-	}
-}
-
-func newSignUpFunc(repo domain.UserRepository) func(email, password string) (*domain.User, error) {
-	return func(email, password string) (*domain.User, error) {
 		// Check if user already exists
-		if _, err := repo.FindByEmail(email); err == nil {
-			return nil, errors.New("email already registered")
+		if _, err := repo.FindByEmail(ctx, email); err == nil {
+			return nil, domain.ErrEmailTaken
 		}
 
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		hashedPassword, err := passwords.hash(password)
 		if err != nil {
 			return nil, err
 		}
 
 		user := &domain.User{
 			Email:    email,
-			Password: string(hashedPassword),
+			Password: hashedPassword,
+			Role:     domain.RoleUser,
 		}
 
-		if err := repo.Create(user); err != nil {
+		if err := repo.Create(ctx, user); err != nil {
+			return nil, err
+		}
+
+		// Should the email not go out, the account still exists; /password/forgot sends a link that verifies it too.
+		if err := emails.sendVerification(ctx, user); err != nil {
 			return nil, err
 		}
 
@@ -111,58 +216,378 @@ func newSignUpFunc(repo domain.UserRepository) func(email, password string) (*do
 	}
 }
 
-func newLoginFunc(repo domain.UserRepository, genToken TokenGeneratorFunc) func(email, password string) (*domain.TokenPair, error) {
-	return func(email, password string) (*domain.TokenPair, error) {
-		user, err := repo.FindByEmail(email)
+func newLoginFunc(repo domain.UserRepository, throttle *loginThrottle, passwords *passwords, twoFactor *twoFactor, genToken TokenGeneratorFunc) func(ctx context.Context, email, password, clientIP string) (*domain.TokenPair, error) {
+	return func(ctx context.Context, email, password, clientIP string) (*domain.TokenPair, error) {
+		email = normalizeEmail(email)
+		if err := throttle.check(ctx, email, clientIP); err != nil {
+			return nil, err
+		}
+
+		user, err := repo.FindByEmail(ctx, email)
 		if err != nil {
-			return nil, errors.New("invalid credentials")
+			// Unknown emails cost a password check too
+			passwords.checkNobody(password)
+			if err := throttle.fail(ctx, email, clientIP); err != nil {
+				return nil, err
+			}
+			return nil, domain.ErrInvalidCredentials
 		}
 
-		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-			return nil, errors.New("invalid credentials")
+		ok, err := passwords.check(user, password)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if err := throttle.fail(ctx, email, clientIP); err != nil {
+				return nil, err
+			}
+			return nil, domain.ErrInvalidCredentials
+		}
+		// With two-factor authentication on, the failures are only forgiven
+		// once the code is right too: LoginMFA counts wrong codes against the
+		// same email, which the password alone must not wipe.
+		on, err := twoFactor.enabled(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !on {
+			if err := throttle.succeed(ctx, email); err != nil {
+				return nil, err
+			}
+		}
+		passwords.upgrade(ctx, user, password)
+		// Only checked now, so it doesn't tell anyone without the password whether the account exists.
+		if user.EmailVerifiedAt == nil {
+			return nil, domain.ErrEmailNotVerified
+		}
+		if on {
+			return twoFactor.issueToken(user)
+		}
+
+		// Every login starts a new token family
+		return genToken(ctx, user, uuid.New())
+	}
+}
+
+func newLoginExternalFunc(external *externalIdentities, twoFactor *twoFactor, genToken TokenGeneratorFunc) func(ctx context.Context, identity domain.ExternalIdentity) (*domain.TokenPair, error) {
+	return func(ctx context.Context, identity domain.ExternalIdentity) (*domain.TokenPair, error) {
+		user, err := external.user(ctx, identity)
+		if err != nil {
+			return nil, err
 		}
 
-		return genToken(user.ID)
+		on, err := twoFactor.enabled(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if on {
+			return twoFactor.issueToken(user)
+		}
+		return genToken(ctx, user, uuid.New())
 	}
 }
 
-func newRefreshTokenFunc(repo domain.UserRepository, genToken TokenGeneratorFunc) func(refreshToken string) (*domain.TokenPair, error) {
-	return func(refreshTokenString string) (*domain.TokenPair, error) {
-		token, err := jwt.Parse(refreshTokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
+func newLoginMFAFunc(repo domain.UserRepository, throttle *loginThrottle, twoFactor *twoFactor, genToken TokenGeneratorFunc) func(ctx context.Context, mfaToken, code, clientIP string) (*domain.TokenPair, error) {
+	return func(ctx context.Context, mfaToken, code, clientIP string) (*domain.TokenPair, error) {
+		pending, err := twoFactor.parseToken(ctx, mfaToken)
+		if err != nil {
+			return nil, err
+		}
+		user, err := repo.FindByID(ctx, pending.userID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, domain.ErrInvalidMFAToken
+		}
+		if err := throttle.check(ctx, user.Email, clientIP); err != nil {
+			return nil, err
+		}
+
+		if err := twoFactor.verify(ctx, user.ID, code); err != nil {
+			if errors.Is(err, domain.ErrInvalidMFACode) {
+				if err := throttle.fail(ctx, user.Email, clientIP); err != nil {
+					return nil, err
+				}
 			}
-			secret := os.Getenv("JWT_SECRET")
-			if secret == "" {
-				secret = "secret"
+			return nil, err
+		}
+		if err := throttle.succeed(ctx, user.Email); err != nil {
+			return nil, err
+		}
+		if err := twoFactor.spend(ctx, pending); err != nil {
+			return nil, err
+		}
+		return genToken(ctx, user, uuid.New())
+	}
+}
+
+func newRefreshTokenFunc(sessions *tokenSessions) func(ctx context.Context, refreshToken string) (*domain.TokenPair, error) {
+	return func(ctx context.Context, refreshTokenString string) (*domain.TokenPair, error) {
+		return sessions.rotate(ctx, refreshTokenString)
+	}
+}
+
+func newLogoutFunc(sessions *tokenSessions) func(ctx context.Context, refreshToken string) error {
+	return func(ctx context.Context, refreshTokenString string) error {
+		return sessions.revoke(ctx, refreshTokenString)
+	}
+}
+
+func newLogoutAllFunc(sessions *tokenSessions) func(ctx context.Context, userID uuid.UUID) error {
+	return func(ctx context.Context, userID uuid.UUID) error {
+		return sessions.revokeAll(ctx, userID)
+	}
+}
+
+func newListUsersFunc(repo domain.UserRepository) func(ctx context.Context, limit, offset int) (*domain.UserPage, error) {
+	return func(ctx context.Context, limit, offset int) (*domain.UserPage, error) {
+		switch {
+		case limit <= 0:
+			limit = domain.DefaultUserPageSize
+		case limit > domain.MaxUserPageSize:
+			limit = domain.MaxUserPageSize
+		}
+		if offset < 0 {
+			return nil, fmt.Errorf("%w: offset must not be negative", domain.ErrInvalidUserQuery)
+		}
+		return repo.FindAll(ctx, limit, offset)
+	}
+}
+
+func newImpersonateFunc(repo domain.UserRepository, sessions *tokenSessions) func(ctx context.Context, adminID, userID uuid.UUID) (*domain.TokenPair, error) {
+	return func(ctx context.Context, adminID, userID uuid.UUID) (*domain.TokenPair, error) {
+		user, err := repo.FindByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, domain.ErrUserNotFound
+		}
+		// Impersonation is for seeing what a user sees, not for acting under another admin's name.
+		if user.Role == domain.RoleAdmin {
+			return nil, domain.ErrCannotImpersonateAdmin
+		}
+		return sessions.impersonate(ctx, adminID, user)
+	}
+}
+
+func newVerifyEmailFunc(repo domain.UserRepository, emails *accountEmails) func(ctx context.Context, token string) error {
+	return func(ctx context.Context, token string) error {
+		record, err := emails.lookup(ctx, token, domain.TokenPurposeVerifyEmail, domain.TokenPurposeChangeEmail)
+		if err != nil {
+			return err
+		}
+		if record.Purpose == domain.TokenPurposeVerifyEmail {
+			if err := emails.use(ctx, record); err != nil {
+				return err
 			}
-			return []byte(secret), nil
-		})
+			return repo.MarkEmailVerified(ctx, record.UserID, time.Now())
+		}
 
-		if err != nil || !token.Valid {
-			return nil, errors.New("invalid refresh token")
+		// Only the latest change_email token works, so it was mailed to the pending email.
+		user, err := repo.FindByID(ctx, record.UserID)
+		if err != nil {
+			return err
 		}
+		if user == nil || user.PendingEmail == nil {
+			return domain.ErrInvalidOneTimeToken
+		}
+		if err := emails.use(ctx, record); err != nil {
+			return err
+		}
+		return repo.ConfirmEmail(ctx, user.ID, *user.PendingEmail, time.Now())
+	}
+}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return nil, errors.New("invalid token claims")
+func newForgotPasswordFunc(repo domain.UserRepository, emails *accountEmails) func(ctx context.Context, email string) error {
+	return func(ctx context.Context, email string) error {
+		user, err := repo.FindByEmail(ctx, normalizeEmail(email))
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil // see domain.UserService.ForgotPassword
+		}
+		if err != nil {
+			return err
 		}
+		emails.sendPasswordResetLater(ctx, user)
+		return nil
+	}
+}
 
-		// Verify it's a refresh token
-		if claims["type"] != "refresh" {
-			return nil, errors.New("invalid token type")
+func newResetPasswordFunc(repo domain.UserRepository, policy *passwordPolicy, passwords *passwords, emails *accountEmails, sessions *tokenSessions, throttle *loginThrottle) func(ctx context.Context, token, newPassword string) error {
+	return func(ctx context.Context, token, newPassword string) error {
+		record, err := emails.lookup(ctx, token, domain.TokenPurposeResetPassword)
+		if err != nil {
+			return err
+		}
+		userID := record.UserID
+		user, err := repo.FindByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return domain.ErrInvalidOneTimeToken
+		}
+		// Checked before the token is used up, so a refused password doesn't cost the link.
+		if err := policy.check(newPassword, user.Email); err != nil {
+			return err
+		}
+		if err := emails.use(ctx, record); err != nil {
+			return err
 		}
 
-		sub, ok := claims["sub"].(string)
-		if !ok {
-			return nil, errors.New("invalid token subject")
+		hashedPassword, err := passwords.hash(newPassword)
+		if err != nil {
+			return err
+		}
+		if err := repo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+			return err
+		}
+		// The link was read in the user's inbox, which is all verification proves.
+		if err := repo.MarkEmailVerified(ctx, userID, time.Now()); err != nil {
+			return err
+		}
+		if err := throttle.succeed(ctx, user.Email); err != nil {
+			return err
+		}
+		// Two-factor authentication stays on: it is there for when the inbox
+		// falls into the wrong hands, which is all this link proves control of.
+		// Whoever knew the old password is signed out
+		return sessions.revokeAll(ctx, userID)
+	}
+}
+
+func newGetUserFunc(repo domain.UserRepository) func(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	return func(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+		user, err := repo.FindByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, domain.ErrUserNotFound
+		}
+		return user, nil
+	}
+}
+
+func newChangeEmailFunc(repo domain.UserRepository, throttle *loginThrottle, passwords *passwords, external *externalIdentities, emails *accountEmails) func(ctx context.Context, userID uuid.UUID, newEmail, currentPassword string) (*domain.User, error) {
+	getUser := newGetUserFunc(repo)
+	return func(ctx context.Context, userID uuid.UUID, newEmail, currentPassword string) (*domain.User, error) {
+		user, err := getUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := passwords.reauthenticate(ctx, throttle, external, user, currentPassword); err != nil {
+			return nil, err
+		}
+		newEmail, err = parseEmail(newEmail)
+		if err != nil {
+			return nil, err
+		}
+		// Checked again when the link is followed, in case someone signs up with it meanwhile.
+		if _, err := repo.FindByEmail(ctx, newEmail); err == nil {
+			return nil, domain.ErrEmailTaken
+		}
+
+		if err := repo.SetPendingEmail(ctx, user.ID, newEmail); err != nil {
+			return nil, err
+		}
+		if err := emails.sendEmailChange(ctx, user, newEmail); err != nil {
+			return nil, err
+		}
+		user.PendingEmail = &newEmail
+		return user, nil
+	}
+}
+
+func newChangePasswordFunc(repo domain.UserRepository, policy *passwordPolicy, throttle *loginThrottle, passwords *passwords, external *externalIdentities, sessions *tokenSessions) func(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) (*domain.TokenPair, error) {
+	getUser := newGetUserFunc(repo)
+	return func(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) (*domain.TokenPair, error) {
+		user, err := getUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := passwords.reauthenticate(ctx, throttle, external, user, currentPassword); err != nil {
+			return nil, err
+		}
+		if err := policy.check(newPassword, user.Email); err != nil {
+			return nil, err
 		}
 
-		userID, err := uuid.Parse(sub)
+		hashedPassword, err := passwords.hash(newPassword)
 		if err != nil {
-			return nil, errors.New("invalid user id in token")
+			return nil, err
 		}
+		if err := repo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+			return nil, err
+		}
+		// Every other session is signed out; the caller carries on with a new login.
+		if err := sessions.revokeAll(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		return sessions.issue(ctx, user, uuid.New())
+	}
+}
 
-		return genToken(userID)
+func newDeleteAccountFunc(repo domain.UserRepository, throttle *loginThrottle, passwords *passwords, external *externalIdentities, sessions *tokenSessions) func(ctx context.Context, userID uuid.UUID, currentPassword string) error {
+	getUser := newGetUserFunc(repo)
+	return func(ctx context.Context, userID uuid.UUID, currentPassword string) error {
+		user, err := getUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := passwords.reauthenticate(ctx, throttle, external, user, currentPassword); err != nil {
+			return err
+		}
+		// Access tokens outlive the refresh tokens deleted with the user, so they are revoked first.
+		if err := sessions.revokeAll(ctx, user.ID); err != nil {
+			return err
+		}
+		return repo.Delete(ctx, user.ID)
+	}
+}
+
+// Turning two-factor authentication on asks for the password at both steps:
+// with only a stolen access token, an attacker could otherwise lock the owner
+// out behind an authenticator app and recovery codes of their own.
+func newEnrollTOTPFunc(repo domain.UserRepository, throttle *loginThrottle, passwords *passwords, external *externalIdentities, twoFactor *twoFactor) func(ctx context.Context, userID uuid.UUID, currentPassword string) (*domain.TOTPEnrollment, error) {
+	getUser := newGetUserFunc(repo)
+	return func(ctx context.Context, userID uuid.UUID, currentPassword string) (*domain.TOTPEnrollment, error) {
+		user, err := getUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := passwords.reauthenticate(ctx, throttle, external, user, currentPassword); err != nil {
+			return nil, err
+		}
+		return twoFactor.enroll(ctx, user)
+	}
+}
+
+func newConfirmTOTPFunc(repo domain.UserRepository, throttle *loginThrottle, passwords *passwords, external *externalIdentities, twoFactor *twoFactor) func(ctx context.Context, userID uuid.UUID, currentPassword, code string) ([]string, error) {
+	getUser := newGetUserFunc(repo)
+	return func(ctx context.Context, userID uuid.UUID, currentPassword, code string) ([]string, error) {
+		user, err := getUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := passwords.reauthenticate(ctx, throttle, external, user, currentPassword); err != nil {
+			return nil, err
+		}
+		return twoFactor.confirm(ctx, user.ID, code)
+	}
+}
+
+func newDisableMFAFunc(repo domain.UserRepository, throttle *loginThrottle, passwords *passwords, external *externalIdentities, twoFactor *twoFactor) func(ctx context.Context, userID uuid.UUID, currentPassword string) error {
+	getUser := newGetUserFunc(repo)
+	return func(ctx context.Context, userID uuid.UUID, currentPassword string) error {
+		user, err := getUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := passwords.reauthenticate(ctx, throttle, external, user, currentPassword); err != nil {
+			return err
+		}
+		return twoFactor.disable(ctx, user.ID)
 	}
 }
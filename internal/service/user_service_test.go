@@ -1,17 +1,56 @@
 package service_test
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/config"
 	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/mailer"
+	"github.com/prachaya-orr/relearn-golang/internal/password"
 	"github.com/prachaya-orr/relearn-golang/internal/service"
+	"github.com/prachaya-orr/relearn-golang/internal/token"
+	"github.com/prachaya-orr/relearn-golang/internal/totp"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// testKeys signs and verifies tokens in the user service tests
+var testKeys = func() *token.KeySet {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	key, err := token.NewSigningKey(private)
+	if err != nil {
+		panic(err)
+	}
+	keys, err := token.NewKeySet("https://api.example.com", key)
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}()
+
+// testHasher hashes with Argon2id parameters cheap enough for tests. Fixture
+// users are given bcrypt hashes, which it still verifies.
+var testHasher = password.NewHasher(config.PasswordHashConfig{
+	Algorithm:         config.HashArgon2id,
+	BcryptCost:        bcrypt.MinCost,
+	Argon2Memory:      64,
+	Argon2Iterations:  1,
+	Argon2Parallelism: 1,
+})
+
 // MockUserRepository is a manual mock for testing UserService
 type MockUserRepository struct {
 	users map[string]*domain.User // Email -> User
@@ -23,7 +62,7 @@ func NewMockUserRepo() *MockUserRepository {
 	}
 }
 
-func (m *MockUserRepository) Create(user *domain.User) error {
+func (m *MockUserRepository) Create(ctx context.Context, user *domain.User) error {
 	if _, exists := m.users[user.Email]; exists {
 		return errors.New("email already registered")
 	}
@@ -32,25 +71,514 @@ func (m *MockUserRepository) Create(user *domain.User) error {
 	return nil
 }
 
-func (m *MockUserRepository) FindByEmail(email string) (*domain.User, error) {
-	user, exists := m.users[email]
+func (m *MockUserRepository) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	user, exists := m.users[strings.ToLower(email)]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, domain.ErrUserNotFound
 	}
 	// Return a copy to simulate retrieval
 	u := *user
 	return &u, nil
 }
 
+func (m *MockUserRepository) FindByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	for _, user := range m.users {
+		if user.ID == id {
+			u := *user
+			return &u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockUserRepository) FindAll(ctx context.Context, limit, offset int) (*domain.UserPage, error) {
+	var all []domain.User
+	for _, user := range m.users {
+		all = append(all, *user)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Email < all[j].Email })
+
+	page := &domain.UserPage{Total: int64(len(all)), Limit: limit}
+	if offset < len(all) {
+		page.Items = all[offset:min(offset+limit, len(all))]
+	}
+	return page, nil
+}
+
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id uuid.UUID, role domain.Role) error {
+	for _, user := range m.users {
+		if user.ID == id {
+			user.Role = role
+			return nil
+		}
+	}
+	return domain.ErrUserNotFound
+}
+
+func (m *MockUserRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID, at time.Time) error {
+	for _, user := range m.users {
+		if user.ID == id && user.EmailVerifiedAt == nil {
+			user.EmailVerifiedAt = &at
+		}
+	}
+	return nil
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	for _, user := range m.users {
+		if user.ID == id {
+			user.Password = passwordHash
+			return nil
+		}
+	}
+	return domain.ErrUserNotFound
+}
+
+func (m *MockUserRepository) SetPendingEmail(ctx context.Context, id uuid.UUID, email string) error {
+	for _, user := range m.users {
+		if user.ID == id {
+			user.PendingEmail = &email
+			return nil
+		}
+	}
+	return domain.ErrUserNotFound
+}
+
+func (m *MockUserRepository) ConfirmEmail(ctx context.Context, id uuid.UUID, email string, at time.Time) error {
+	if _, exists := m.users[email]; exists {
+		return domain.ErrEmailTaken
+	}
+	for oldEmail, user := range m.users {
+		if user.ID == id {
+			delete(m.users, oldEmail)
+			user.Email = email
+			user.PendingEmail = nil
+			user.EmailVerifiedAt = &at
+			m.users[email] = user
+			return nil
+		}
+	}
+	return domain.ErrUserNotFound
+}
+
+func (m *MockUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	for email, user := range m.users {
+		if user.ID == id {
+			delete(m.users, email)
+			return nil
+		}
+	}
+	return domain.ErrUserNotFound
+}
+
+// verifiedAt marks fixture users as having verified their email, so they can log in
+var verifiedAt = time.Now()
+
+// MockRefreshTokenRepository is an in-memory refresh token store
+type MockRefreshTokenRepository struct {
+	tokens map[uuid.UUID]*domain.RefreshToken
+}
+
+func NewMockRefreshTokenRepo() *MockRefreshTokenRepository {
+	return &MockRefreshTokenRepository{
+		tokens: make(map[uuid.UUID]*domain.RefreshToken),
+	}
+}
+
+func (m *MockRefreshTokenRepository) Create(ctx context.Context, token *domain.RefreshToken) error {
+	token.CreatedAt = time.Now()
+	t := *token
+	m.tokens[token.ID] = &t
+	return nil
+}
+
+func (m *MockRefreshTokenRepository) FindByID(ctx context.Context, id uuid.UUID) (*domain.RefreshToken, error) {
+	token, exists := m.tokens[id]
+	if !exists {
+		return nil, nil
+	}
+	t := *token
+	return &t, nil
+}
+
+func (m *MockRefreshTokenRepository) MarkUsed(ctx context.Context, id uuid.UUID) error {
+	token, exists := m.tokens[id]
+	if !exists || token.UsedAt != nil || token.RevokedAt != nil {
+		return domain.ErrRefreshTokenReused
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	return nil
+}
+
+func (m *MockRefreshTokenRepository) FindIssuedSince(ctx context.Context, userID uuid.UUID, since time.Time) ([]domain.RefreshToken, error) {
+	var issued []domain.RefreshToken
+	for _, token := range m.tokens {
+		if token.UserID == userID && token.CreatedAt.After(since) {
+			issued = append(issued, *token)
+		}
+	}
+	return issued, nil
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *MockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *MockRefreshTokenRepository) PurgeExpired(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	var purged int64
+	for id, token := range m.tokens {
+		if token.ExpiresAt.Before(expiredBefore) {
+			delete(m.tokens, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// MockTokenRevocationStore records revoked access tokens
+type MockTokenRevocationStore struct {
+	revoked map[uuid.UUID]time.Time
+}
+
+func NewMockRevocationStore() *MockTokenRevocationStore {
+	return &MockTokenRevocationStore{
+		revoked: make(map[uuid.UUID]time.Time),
+	}
+}
+
+func (m *MockTokenRevocationStore) Revoke(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error {
+	m.revoked[jti] = expiresAt
+	return nil
+}
+
+func (m *MockTokenRevocationStore) IsRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	_, revoked := m.revoked[jti]
+	return revoked, nil
+}
+
+func (m *MockTokenRevocationStore) PurgeExpired(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	var purged int64
+	for jti, expiresAt := range m.revoked {
+		if expiresAt.Before(expiredBefore) {
+			delete(m.revoked, jti)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// MockLoginAttemptStore counts failed logins in memory
+type MockLoginAttemptStore struct {
+	attempts map[string]*domain.LoginAttempt
+}
+
+func NewMockLoginAttemptStore() *MockLoginAttemptStore {
+	return &MockLoginAttemptStore{attempts: make(map[string]*domain.LoginAttempt)}
+}
+
+func (m *MockLoginAttemptStore) Get(ctx context.Context, key string) (*domain.LoginAttempt, error) {
+	attempt, exists := m.attempts[key]
+	if !exists {
+		return nil, nil
+	}
+	a := *attempt
+	return &a, nil
+}
+
+func (m *MockLoginAttemptStore) RecordFailure(ctx context.Context, key string, at, resetBefore time.Time) (*domain.LoginAttempt, error) {
+	attempt, exists := m.attempts[key]
+	if !exists || attempt.LastFailedAt.Before(resetBefore) {
+		attempt = &domain.LoginAttempt{Key: key}
+		m.attempts[key] = attempt
+	}
+	attempt.Failures++
+	attempt.LastFailedAt = at
+	a := *attempt
+	return &a, nil
+}
+
+func (m *MockLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	delete(m.attempts, key)
+	return nil
+}
+
+// MockOneTimeTokenRepository is an in-memory store of mailed tokens
+type MockOneTimeTokenRepository struct {
+	tokens map[uuid.UUID]*domain.OneTimeToken
+}
+
+func NewMockOneTimeTokenRepo() *MockOneTimeTokenRepository {
+	return &MockOneTimeTokenRepository{tokens: make(map[uuid.UUID]*domain.OneTimeToken)}
+}
+
+func (m *MockOneTimeTokenRepository) Create(ctx context.Context, token *domain.OneTimeToken) error {
+	token.ID = uuid.New()
+	token.CreatedAt = time.Now()
+	t := *token
+	m.tokens[token.ID] = &t
+	return nil
+}
+
+func (m *MockOneTimeTokenRepository) FindByHash(ctx context.Context, tokenHash string) (*domain.OneTimeToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == tokenHash {
+			t := *token
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockOneTimeTokenRepository) MarkUsed(ctx context.Context, id uuid.UUID) error {
+	token, exists := m.tokens[id]
+	if !exists || token.UsedAt != nil {
+		return domain.ErrInvalidOneTimeToken
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	return nil
+}
+
+func (m *MockOneTimeTokenRepository) InvalidateForUser(ctx context.Context, userID uuid.UUID, purpose domain.TokenPurpose) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.UserID == userID && token.Purpose == purpose && token.UsedAt == nil {
+			token.UsedAt = &now
+		}
+	}
+	return nil
+}
+
+// MockMFARepository is an in-memory store of TOTP credentials and recovery codes
+type MockMFARepository struct {
+	credentials   map[uuid.UUID]*domain.TOTPCredential
+	recoveryCodes map[uuid.UUID][]*domain.RecoveryCode
+}
+
+func NewMockMFARepo() *MockMFARepository {
+	return &MockMFARepository{
+		credentials:   make(map[uuid.UUID]*domain.TOTPCredential),
+		recoveryCodes: make(map[uuid.UUID][]*domain.RecoveryCode),
+	}
+}
+
+func (m *MockMFARepository) FindTOTP(ctx context.Context, userID uuid.UUID) (*domain.TOTPCredential, error) {
+	credential, exists := m.credentials[userID]
+	if !exists {
+		return nil, nil
+	}
+	c := *credential
+	return &c, nil
+}
+
+func (m *MockMFARepository) SaveTOTP(ctx context.Context, credential *domain.TOTPCredential) error {
+	if existing, exists := m.credentials[credential.UserID]; exists && existing.ConfirmedAt != nil {
+		return domain.ErrMFAAlreadyEnabled
+	}
+	c := *credential
+	m.credentials[credential.UserID] = &c
+	return nil
+}
+
+func (m *MockMFARepository) ConfirmTOTP(ctx context.Context, userID uuid.UUID, at time.Time, step int64, codeHashes []string) error {
+	credential, exists := m.credentials[userID]
+	if !exists || credential.ConfirmedAt != nil {
+		return domain.ErrMFANotEnrolled
+	}
+	credential.ConfirmedAt = &at
+	credential.LastUsedStep = step
+	m.recoveryCodes[userID] = nil
+	for _, hash := range codeHashes {
+		m.recoveryCodes[userID] = append(m.recoveryCodes[userID], &domain.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	return nil
+}
+
+func (m *MockMFARepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	credential, exists := m.credentials[userID]
+	if !exists || credential.ConfirmedAt == nil || credential.LastUsedStep >= step {
+		return domain.ErrInvalidMFACode
+	}
+	credential.LastUsedStep = step
+	return nil
+}
+
+func (m *MockMFARepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, at time.Time) error {
+	for _, code := range m.recoveryCodes[userID] {
+		if code.CodeHash == codeHash && code.UsedAt == nil {
+			code.UsedAt = &at
+			return nil
+		}
+	}
+	return domain.ErrInvalidMFACode
+}
+
+func (m *MockMFARepository) Delete(ctx context.Context, userID uuid.UUID) error {
+	if _, exists := m.credentials[userID]; !exists {
+		return domain.ErrMFANotEnrolled
+	}
+	delete(m.credentials, userID)
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+// MockIdentityRepository is an in-memory store of linked identities. It
+// creates users in the user repository it was made for.
+type MockIdentityRepository struct {
+	users      *MockUserRepository
+	identities []*domain.Identity
+}
+
+func NewMockIdentityRepo(users *MockUserRepository) *MockIdentityRepository {
+	return &MockIdentityRepository{users: users}
+}
+
+func (m *MockIdentityRepository) FindByProviderSubject(ctx context.Context, provider, subject string) (*domain.Identity, error) {
+	for _, identity := range m.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			i := *identity
+			return &i, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockIdentityRepository) Create(ctx context.Context, identity *domain.Identity) error {
+	if existing, _ := m.FindByProviderSubject(ctx, identity.Provider, identity.Subject); existing != nil {
+		return errors.New("identity already linked")
+	}
+	identity.ID = uuid.New()
+	i := *identity
+	m.identities = append(m.identities, &i)
+	return nil
+}
+
+func (m *MockIdentityRepository) CreateUser(ctx context.Context, user *domain.User, identity *domain.Identity) error {
+	if _, exists := m.users.users[user.Email]; exists {
+		return domain.ErrEmailTaken
+	}
+	if err := m.users.Create(ctx, user); err != nil {
+		return err
+	}
+	identity.UserID = user.ID
+	return m.Create(ctx, identity)
+}
+
+func (m *MockIdentityRepository) MarkSignedIn(ctx context.Context, id uuid.UUID, at time.Time) error {
+	for _, identity := range m.identities {
+		if identity.ID == id {
+			identity.LastSignInAt = &at
+			return nil
+		}
+	}
+	return errors.New("identity not found")
+}
+
+func (m *MockIdentityRepository) LastSignInAt(ctx context.Context, userID uuid.UUID) (*time.Time, error) {
+	var last *time.Time
+	for _, identity := range m.identities {
+		if identity.UserID == userID && identity.LastSignInAt != nil && (last == nil || identity.LastSignInAt.After(*last)) {
+			at := *identity.LastSignInAt
+			last = &at
+		}
+	}
+	return last, nil
+}
+
+// newUserDeps builds a user service's dependencies on repo, with fresh mocks for the rest
+func newUserDeps(repo *MockUserRepository) service.UserDeps {
+	return service.UserDeps{
+		Users:         repo,
+		RefreshTokens: NewMockRefreshTokenRepo(),
+		Revocations:   NewMockRevocationStore(),
+		LoginAttempts: NewMockLoginAttemptStore(),
+		OneTimeTokens: NewMockOneTimeTokenRepo(),
+		MFA:           NewMockMFARepo(),
+		Identities:    NewMockIdentityRepo(repo),
+		Mailer:        mailer.NewOutbox("", ""),
+		Hasher:        testHasher,
+		Keys:          testKeys,
+	}
+}
+
+// forgotPassword asks for a password reset link and waits for it, as it is
+// mailed in the background
+func forgotPassword(t *testing.T, svc domain.UserService, outbox *mailer.Outbox, email string) {
+	t.Helper()
+	sent := len(outbox.Messages())
+	if err := svc.ForgotPassword(context.Background(), email); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for deadline := time.Now().Add(time.Second); len(outbox.Messages()) == sent; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a password reset email")
+		}
+	}
+}
+
+// mailedToken pulls the token out of the link in the last email of outbox
+func mailedToken(t *testing.T, outbox *mailer.Outbox) string {
+	t.Helper()
+	messages := outbox.Messages()
+	if len(messages) == 0 {
+		t.Fatal("expected an email to have been sent")
+	}
+	_, after, found := strings.Cut(messages[len(messages)-1].Body, "?token=")
+	if !found {
+		t.Fatalf("expected a link with a token, got %q", messages[len(messages)-1].Body)
+	}
+	token, _, _ := strings.Cut(after, "\n")
+	return token
+}
+
+// accessClaims reads the claims of a token without verifying it
+func accessClaims(t *testing.T, accessToken string) jwt.MapClaims {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(accessToken, claims); err != nil {
+		t.Fatalf("failed to parse access token: %v", err)
+	}
+	return claims
+}
+
+// accessTokenID reads the jti claim without verifying the token
+func accessTokenID(t *testing.T, accessToken string) uuid.UUID {
+	t.Helper()
+	jti, _ := accessClaims(t, accessToken)["jti"].(string)
+	id, err := uuid.Parse(jti)
+	if err != nil {
+		t.Fatalf("expected access token to carry a jti, got %q", jti)
+	}
+	return id
+}
+
 func TestUserService_SignUp(t *testing.T) {
+	ctx := context.Background()
 	repo := NewMockUserRepo()
-	svc := service.NewUserService(repo)
+	svc := service.NewUserService(newUserDeps(repo), config.Default().Auth)
 
 	t.Run("Success", func(t *testing.T) {
 		email := "test@example.com"
 		password := "password123"
 
-		user, err := svc.SignUp(email, password)
+		user, err := svc.SignUp(ctx, email, password)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -76,132 +604,1263 @@ func TestUserService_SignUp(t *testing.T) {
 		// reusing 'repo' from outer scope.
 
 		email := "dup@example.com"
-		svc.SignUp(email, "pass")
+		svc.SignUp(ctx, email, "password123")
 
-		_, err := svc.SignUp(email, "pass2")
+		_, err := svc.SignUp(ctx, email, "password456")
 		if err == nil {
 			t.Error("expected error for duplicate email")
 		}
 		if err.Error() != "email already registered" {
 			t.Errorf("expected 'email already registered', got '%v'", err)
 		}
+		if !errors.Is(err, domain.ErrConflict) {
+			t.Errorf("expected a conflict error, got %v", err)
+		}
+	})
+
+	t.Run("Email Case", func(t *testing.T) {
+		user, err := svc.SignUp(ctx, "Mixed@Example.COM", "password123")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if user.Email != "mixed@example.com" {
+			t.Errorf("expected the email to be stored lowercased, got %s", user.Email)
+		}
+		if _, err := svc.SignUp(ctx, "mixed@example.com", "password456"); !errors.Is(err, domain.ErrConflict) {
+			t.Errorf("expected a case variant to be taken, got %v", err)
+		}
+
+		repo.users[user.Email].EmailVerifiedAt = &verifiedAt
+		if _, err := svc.Login(ctx, " MIXED@example.com ", "password123", ""); err != nil {
+			t.Errorf("expected login to ignore case, got %v", err)
+		}
 	})
 }
 
-func TestUserService_Login(t *testing.T) {
+func TestUserService_EmailVerification(t *testing.T) {
+	ctx := context.Background()
 	repo := NewMockUserRepo()
-	svc := service.NewUserService(repo)
+	outbox := mailer.NewOutbox("", "")
+	deps := newUserDeps(repo)
+	deps.Mailer = outbox
+	svc := service.NewUserService(deps, config.Default().Auth)
 
-	// Setup user
-	email := "login@example.com"
-	rawPassword := "secret"
-	hashed, _ := bcrypt.GenerateFromPassword([]byte(rawPassword), bcrypt.DefaultCost)
+	t.Run("Invalid Email", func(t *testing.T) {
+		for _, email := range []string{"not-an-email", "Jane <jane@example.com>", "jane@"} {
+			if _, err := svc.SignUp(ctx, email, "correct-horse"); !errors.Is(err, domain.ErrInvalidEmail) {
+				t.Errorf("%q: expected ErrInvalidEmail, got %v", email, err)
+			}
+		}
+	})
 
-	repo.Create(&domain.User{
-		Email:    email,
-		Password: string(hashed),
+	if _, err := svc.SignUp(ctx, " verify@example.com ", "correct-horse"); err != nil {
+		t.Fatalf("sign up failed: %v", err)
+	}
+	if to := outbox.Messages()[0].To; to != "verify@example.com" {
+		t.Errorf("expected the link to be mailed to the trimmed address, got %q", to)
+	}
+	token := mailedToken(t, outbox)
+
+	t.Run("Login Before Verifying", func(t *testing.T) {
+		if _, err := svc.Login(ctx, "verify@example.com", "correct-horse", ""); !errors.Is(err, domain.ErrEmailNotVerified) {
+			t.Errorf("expected ErrEmailNotVerified, got %v", err)
+		}
+		// Without the password nothing gives away that the account exists
+		if _, err := svc.Login(ctx, "verify@example.com", "wrong", ""); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Errorf("expected ErrInvalidCredentials, got %v", err)
+		}
 	})
 
-	t.Run("Success", func(t *testing.T) {
-		tokens, err := svc.Login(email, rawPassword)
-		if err != nil {
+	t.Run("Verify", func(t *testing.T) {
+		if err := svc.VerifyEmail(ctx, token); err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
-		if tokens.AccessToken == "" || tokens.RefreshToken == "" {
-			t.Error("expected both access and refresh tokens")
+		if _, err := svc.Login(ctx, "verify@example.com", "correct-horse", ""); err != nil {
+			t.Errorf("expected login to work once verified, got %v", err)
 		}
 	})
 
-	t.Run("Invalid Password", func(t *testing.T) {
-		_, err := svc.Login(email, "wrongpass")
-		if err == nil {
-			t.Error("expected error for invalid password")
-		}
-		if err.Error() != "invalid credentials" {
-			t.Errorf("expected 'invalid credentials', got '%v'", err)
+	t.Run("Single Use", func(t *testing.T) {
+		if err := svc.VerifyEmail(ctx, token); !errors.Is(err, domain.ErrInvalidOneTimeToken) {
+			t.Errorf("expected ErrInvalidOneTimeToken, got %v", err)
 		}
 	})
 
-	t.Run("User Not Found", func(t *testing.T) {
-		_, err := svc.Login("nobody@example.com", "pass")
-		if err == nil {
-			t.Error("expected error for non-existent user")
+	t.Run("Unknown Token", func(t *testing.T) {
+		if err := svc.VerifyEmail(ctx, "made-up"); !errors.Is(err, domain.ErrInvalidOneTimeToken) {
+			t.Errorf("expected ErrInvalidOneTimeToken, got %v", err)
 		}
 	})
 }
 
-func TestUserService_RefreshToken(t *testing.T) {
+func TestUserService_PasswordReset(t *testing.T) {
+	ctx := context.Background()
 	repo := NewMockUserRepo()
-	svc := service.NewUserService(repo)
+	tokens := NewMockOneTimeTokenRepo()
+	revocations := NewMockRevocationStore()
+	outbox := mailer.NewOutbox("", "")
+	deps := newUserDeps(repo)
+	deps.Revocations = revocations
+	deps.OneTimeTokens = tokens
+	deps.Mailer = outbox
+	svc := service.NewUserService(deps, config.Default().Auth)
 
-	// We need a valid refresh token first. Login gives us one.
-	email := "refresh@example.com"
-	repo.Create(&domain.User{
-		Email:    email,
-		Password: "hashedpassword", // Doesn't matter for refresh if we bypass login, but login helper uses it.
-		// Actually, let's just manually create a token or use Login helper from service if possible.
-		// But repo needs to contain the user because token claims have sub=UserID,
-		// and RefreshToken logic parses token -> gets ID -> genToken(ID).
-		// Wait, newRefreshTokenFunc checks parsing.
-		// It does NOT seem to check if user still exists in repo in the implementation I read?
-		// Let's check user_service.go again.
-		// ...
-		// func newRefreshTokenFunc(...) {
-		//    ... parse ... verify claims ...
-		//    userID, err := uuid.Parse(sub)
-		//    return genToken(userID)
-		// }
-		// It does NOT check DB for user existence! Just generates new token for that ID.
-	})
-	// But we need the ID to match what's in the token.
-	// Let's create a user properly via repo to get an ID?
-	// Or just manually construct the user.
-	user := &domain.User{Email: email, Password: "hash"}
-	repo.Create(user) // assigns ID
-
-	// We can't easily generate a valid signed token without the secret used by the service.
-	// The service uses os.Getenv("JWT_SECRET") or "secret".
-	// So we can replicate that generation here.
-
-	secret := "secret" // default in service
+	email := "forgot@example.com"
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("old-secret"), bcrypt.MinCost)
+	repo.Create(ctx, &domain.User{Email: email, Password: string(hashed)}) // never verified
 
-	createToken := func(userID string, tokenType string, exp time.Duration) string {
-		claims := jwt.MapClaims{
-			"sub":  userID,
-			"type": tokenType,
-			"exp":  time.Now().Add(exp).Unix(),
+	t.Run("Unknown Email", func(t *testing.T) {
+		if err := svc.ForgotPassword(ctx, "nobody@example.com"); err != nil {
+			t.Errorf("expected unknown emails to look like known ones, got %v", err)
 		}
-		t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		s, _ := t.SignedString([]byte(secret))
-		return s
-	}
-
-	t.Run("Success", func(t *testing.T) {
-		validRefresh := createToken(user.ID.String(), "refresh", time.Hour)
-		pair, err := svc.RefreshToken(validRefresh)
-		if err != nil {
-			t.Fatalf("expected no error, got %v", err)
+		if len(outbox.Messages()) != 0 {
+			t.Error("expected no email for an unknown address")
 		}
-		if pair.AccessToken == "" {
-			t.Error("expected new access token")
+	})
+
+	t.Run("Only Latest Link Works", func(t *testing.T) {
+		forgotPassword(t, svc, outbox, email)
+		first := mailedToken(t, outbox)
+		forgotPassword(t, svc, outbox, email)
+
+		if err := svc.ResetPassword(ctx, first, "new-secret"); !errors.Is(err, domain.ErrInvalidOneTimeToken) {
+			t.Errorf("expected ErrInvalidOneTimeToken, got %v", err)
 		}
 	})
 
-	t.Run("Invalid Token", func(t *testing.T) {
-		_, err := svc.RefreshToken("invalid.token.string")
-		if err == nil {
-			t.Error("expected error for invalid token")
+	t.Run("Expired", func(t *testing.T) {
+		forgotPassword(t, svc, outbox, email)
+		token := mailedToken(t, outbox)
+		for _, record := range tokens.tokens {
+			record.ExpiresAt = time.Now().Add(-time.Second)
+		}
+		if err := svc.ResetPassword(ctx, token, "new-secret"); !errors.Is(err, domain.ErrInvalidOneTimeToken) {
+			t.Errorf("expected ErrInvalidOneTimeToken, got %v", err)
 		}
 	})
 
-	t.Run("Wrong Type (Access Token as Refresh)", func(t *testing.T) {
-		accessToken := createToken(user.ID.String(), "access", time.Minute)
-		_, err := svc.RefreshToken(accessToken)
-		if err == nil {
-			t.Error("expected error when using access token as refresh token")
+	t.Run("Reset", func(t *testing.T) {
+		forgotPassword(t, svc, outbox, email)
+		if err := svc.VerifyEmail(ctx, mailedToken(t, outbox)); !errors.Is(err, domain.ErrInvalidOneTimeToken) {
+			t.Errorf("expected a reset token not to verify an email, got %v", err)
+		}
+
+		forgotPassword(t, svc, outbox, email)
+		if err := svc.ResetPassword(ctx, mailedToken(t, outbox), "new-secret"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := svc.Login(ctx, email, "old-secret", ""); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Errorf("expected the old password to stop working, got %v", err)
+		}
+		// Following the link proved the inbox, so the email counts as verified
+		if _, err := svc.Login(ctx, email, "new-secret", ""); err != nil {
+			t.Errorf("expected the new password to work, got %v", err)
+		}
+	})
+
+	t.Run("Answers Before Mailing", func(t *testing.T) {
+		slow := blockingMailer{release: make(chan struct{})}
+		defer close(slow.release)
+		deps := newUserDeps(repo)
+		deps.Mailer = slow
+		svc := service.NewUserService(deps, config.Default().Auth)
+
+		done := make(chan error, 1)
+		go func() { done <- svc.ForgotPassword(ctx, email) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("expected the answer not to wait for the email")
+		}
+	})
+
+	t.Run("Database Failure", func(t *testing.T) {
+		deps := newUserDeps(repo)
+		deps.Users = unreachableUserRepo{repo}
+		svc := service.NewUserService(deps, config.Default().Auth)
+		if err := svc.ForgotPassword(ctx, email); err == nil || errors.Is(err, domain.ErrUserNotFound) {
+			t.Errorf("expected the database error, got %v", err)
+		}
+	})
+}
+
+// blockingMailer holds every email until release is closed, like a slow mail server
+type blockingMailer struct {
+	release chan struct{}
+}
+
+func (m blockingMailer) Send(domain.MailMessage) error {
+	<-m.release
+	return nil
+}
+
+// unreachableUserRepo fails to look users up by email
+type unreachableUserRepo struct {
+	*MockUserRepository
+}
+
+func (unreachableUserRepo) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return nil, errors.New("connection refused")
+}
+
+// breachedPasswords is a BreachedPasswordChecker over a fixed set
+type breachedPasswords map[string]bool
+
+func (b breachedPasswords) IsBreached(password string) (bool, error) {
+	return b[password], nil
+}
+
+func TestUserService_PasswordPolicy(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	outbox := mailer.NewOutbox("", "")
+	breached := breachedPasswords{"password123": true}
+	deps := newUserDeps(repo)
+	deps.Mailer = outbox
+	deps.Breached = breached
+	svc := service.NewUserService(deps, config.Default().Auth)
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		want     []string
+	}{
+		{name: "Too Short", password: "abc123", want: []string{domain.PasswordMinLength}},
+		{name: "Too Long", password: strings.Repeat("ab1", 25), want: []string{domain.PasswordMaxLength}},
+		{name: "Multibyte Counts Characters", password: "ééééééé1", want: []string{domain.PasswordMinLength}},
+		{name: "One Character Class", password: "abcdefghijkl", want: []string{domain.PasswordCharClasses}},
+		{name: "Several Rules", password: "aaaa", want: []string{domain.PasswordMinLength, domain.PasswordCharClasses}},
+		{name: "Email", email: "jane.doe.42@example.com", password: "Jane.Doe.42@example.com", want: []string{domain.PasswordIsEmail}},
+		{name: "Email Local Part", email: "jane.doe.42@example.com", password: "jane.doe.42", want: []string{domain.PasswordIsEmail}},
+		{name: "Breached", password: "password123", want: []string{domain.PasswordBreached}},
+		{name: "Accepted", password: "correct horse battery"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := tt.email
+			if email == "" {
+				email = fmt.Sprintf("policy%d@example.com", i)
+			}
+			_, err := svc.SignUp(ctx, email, tt.password)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var violationsErr *domain.ViolationsError
+			if !errors.Is(err, domain.ErrWeakPassword) || !errors.As(err, &violationsErr) {
+				t.Fatalf("expected ErrWeakPassword with violations, got %v", err)
+			}
+			if got := violationsErr.Violations["password"]; !slices.Equal(got, tt.want) {
+				t.Errorf("expected violations %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Reset Keeps Link On Refused Password", func(t *testing.T) {
+		svc.SignUp(ctx, "policy-reset@example.com", "correct horse battery")
+		forgotPassword(t, svc, outbox, "policy-reset@example.com")
+		token := mailedToken(t, outbox)
+
+		if err := svc.ResetPassword(ctx, token, "short"); !errors.Is(err, domain.ErrWeakPassword) {
+			t.Fatalf("expected ErrWeakPassword, got %v", err)
+		}
+		if err := svc.ResetPassword(ctx, token, "policy-reset"); !errors.Is(err, domain.ErrWeakPassword) {
+			t.Fatalf("expected the email's local part to be refused, got %v", err)
+		}
+		if err := svc.ResetPassword(ctx, token, "staple battery horse"); err != nil {
+			t.Errorf("expected the link to still work, got %v", err)
+		}
+	})
+}
+
+func TestUserService_Login(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	svc := service.NewUserService(newUserDeps(repo), config.Default().Auth)
+
+	// Setup user
+	email := "login@example.com"
+	rawPassword := "secret"
+	hashed, _ := bcrypt.GenerateFromPassword([]byte(rawPassword), bcrypt.DefaultCost)
+
+	repo.Create(ctx, &domain.User{
+		Email:           email,
+		Password:        string(hashed),
+		EmailVerifiedAt: &verifiedAt,
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		tokens, err := svc.Login(ctx, email, rawPassword, "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+			t.Error("expected both access and refresh tokens")
+		}
+	})
+
+	t.Run("Invalid Password", func(t *testing.T) {
+		_, err := svc.Login(ctx, email, "wrongpass", "")
+		if err == nil {
+			t.Error("expected error for invalid password")
+		}
+		if err.Error() != "invalid credentials" {
+			t.Errorf("expected 'invalid credentials', got '%v'", err)
+		}
+		if !errors.Is(err, domain.ErrUnauthorized) {
+			t.Errorf("expected an unauthorized error, got %v", err)
+		}
+	})
+
+	t.Run("User Not Found", func(t *testing.T) {
+		_, err := svc.Login(ctx, "nobody@example.com", "pass", "")
+		if err == nil {
+			t.Error("expected error for non-existent user")
+		}
+		if !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Errorf("expected unknown email to look like a wrong password, got %v", err)
+		}
+	})
+}
+
+func TestUserService_RefreshToken(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	svc := service.NewUserService(newUserDeps(repo), config.Default().Auth)
+
+	// Refresh tokens have to exist in the store, so Login is the only way to get one.
+	email := "refresh@example.com"
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := &domain.User{Email: email, Password: string(hashed), EmailVerifiedAt: &verifiedAt}
+	repo.Create(ctx, user) // assigns ID
+
+	login := func(t *testing.T) *domain.TokenPair {
+		t.Helper()
+		tokens, err := svc.Login(ctx, email, "secret", "")
+		if err != nil {
+			t.Fatalf("login failed: %v", err)
+		}
+		return tokens
+	}
+
+	// Sign with the service's own keys to forge tokens it never issued.
+	createToken := func(userID string, tokenType string, exp time.Duration) string {
+		claims := jwt.MapClaims{
+			"iss":  testKeys.Issuer(),
+			"aud":  tokenType,
+			"sub":  userID,
+			"jti":  uuid.NewString(),
+			"type": tokenType,
+			"exp":  time.Now().Add(exp).Unix(),
+		}
+		s, _ := testKeys.Sign(claims)
+		return s
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		tokens := login(t)
+		pair, err := svc.RefreshToken(ctx, tokens.RefreshToken)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if pair.AccessToken == "" {
+			t.Error("expected new access token")
+		}
+		if pair.RefreshToken == tokens.RefreshToken {
+			t.Error("expected the refresh token to be rotated")
+		}
+
+		// The rotated token works in turn
+		if _, err := svc.RefreshToken(ctx, pair.RefreshToken); err != nil {
+			t.Errorf("expected rotated token to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("Reuse Revokes Family", func(t *testing.T) {
+		stolen := login(t)
+		rotated, err := svc.RefreshToken(ctx, stolen.RefreshToken)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		_, err = svc.RefreshToken(ctx, stolen.RefreshToken)
+		if !errors.Is(err, domain.ErrRefreshTokenReused) {
+			t.Errorf("expected ErrRefreshTokenReused, got %v", err)
+		}
+
+		_, err = svc.RefreshToken(ctx, rotated.RefreshToken)
+		if !errors.Is(err, domain.ErrRefreshTokenRevoked) {
+			t.Errorf("expected the rest of the family to be revoked, got %v", err)
+		}
+	})
+
+	t.Run("Reuse Leaves Other Sessions", func(t *testing.T) {
+		other := login(t)
+		stolen := login(t)
+		svc.RefreshToken(ctx, stolen.RefreshToken)
+		svc.RefreshToken(ctx, stolen.RefreshToken)
+
+		if _, err := svc.RefreshToken(ctx, other.RefreshToken); err != nil {
+			t.Errorf("expected another login's token to survive, got %v", err)
+		}
+	})
+
+	t.Run("Unknown Token", func(t *testing.T) {
+		// Validly signed, but never issued by the service
+		_, err := svc.RefreshToken(ctx, createToken(user.ID.String(), "refresh", time.Hour))
+		if !errors.Is(err, domain.ErrInvalidRefreshToken) {
+			t.Errorf("expected ErrInvalidRefreshToken, got %v", err)
+		}
+	})
+
+	t.Run("Invalid Token", func(t *testing.T) {
+		_, err := svc.RefreshToken(ctx, "invalid.token.string")
+		if err == nil {
+			t.Error("expected error for invalid token")
+		}
+	})
+
+	t.Run("HS256 Token", func(t *testing.T) {
+		// What the service used to issue; a shared secret no longer verifies anything
+		legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":  user.ID.String(),
+			"type": "refresh",
+			"exp":  time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte("secret"))
+		if _, err := svc.RefreshToken(ctx, legacy); !errors.Is(err, domain.ErrInvalidRefreshToken) {
+			t.Errorf("expected ErrInvalidRefreshToken, got %v", err)
+		}
+	})
+
+	t.Run("Wrong Type (Access Token as Refresh)", func(t *testing.T) {
+		accessToken := createToken(user.ID.String(), "access", time.Minute)
+		_, err := svc.RefreshToken(ctx, accessToken)
+		if err == nil {
+			t.Error("expected error when using access token as refresh token")
 		}
 		if err.Error() != "invalid token type" {
 			t.Errorf("expected 'invalid token type', got '%v'", err)
 		}
 	})
 }
+
+func TestUserService_Logout(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	revocations := NewMockRevocationStore()
+	deps := newUserDeps(repo)
+	deps.Revocations = revocations
+	svc := service.NewUserService(deps, config.Default().Auth)
+
+	email := "logout@example.com"
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := &domain.User{Email: email, Password: string(hashed), EmailVerifiedAt: &verifiedAt}
+	repo.Create(ctx, user)
+
+	t.Run("Logout", func(t *testing.T) {
+		tokens, _ := svc.Login(ctx, email, "secret", "")
+		other, _ := svc.Login(ctx, email, "secret", "")
+
+		if err := svc.Logout(ctx, tokens.RefreshToken); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := svc.RefreshToken(ctx, tokens.RefreshToken); !errors.Is(err, domain.ErrRefreshTokenRevoked) {
+			t.Errorf("expected ErrRefreshTokenRevoked, got %v", err)
+		}
+		if _, err := svc.RefreshToken(ctx, other.RefreshToken); err != nil {
+			t.Errorf("expected other sessions to stay signed in, got %v", err)
+		}
+		if revoked, _ := revocations.IsRevoked(ctx, accessTokenID(t, tokens.AccessToken)); !revoked {
+			t.Error("expected the access token to be revoked")
+		}
+		if revoked, _ := revocations.IsRevoked(ctx, accessTokenID(t, other.AccessToken)); revoked {
+			t.Error("expected other sessions' access tokens to stay valid")
+		}
+
+		// Logging out again is harmless
+		if err := svc.Logout(ctx, tokens.RefreshToken); err != nil {
+			t.Errorf("expected repeated logout to succeed, got %v", err)
+		}
+	})
+
+	t.Run("Logout All", func(t *testing.T) {
+		first, _ := svc.Login(ctx, email, "secret", "")
+		second, _ := svc.Login(ctx, email, "secret", "")
+
+		if err := svc.LogoutAll(ctx, user.ID); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, tokens := range []*domain.TokenPair{first, second} {
+			if _, err := svc.RefreshToken(ctx, tokens.RefreshToken); !errors.Is(err, domain.ErrRefreshTokenRevoked) {
+				t.Errorf("expected ErrRefreshTokenRevoked, got %v", err)
+			}
+			if revoked, _ := revocations.IsRevoked(ctx, accessTokenID(t, tokens.AccessToken)); !revoked {
+				t.Error("expected every access token to be revoked")
+			}
+		}
+	})
+
+	t.Run("Invalid Token", func(t *testing.T) {
+		if err := svc.Logout(ctx, "invalid.token.string"); !errors.Is(err, domain.ErrInvalidRefreshToken) {
+			t.Errorf("expected ErrInvalidRefreshToken, got %v", err)
+		}
+	})
+}
+
+func TestUserService_Roles(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	outbox := mailer.NewOutbox("", "")
+	deps := newUserDeps(repo)
+	deps.Mailer = outbox
+	svc := service.NewUserService(deps, config.Default().Auth)
+
+	user, err := svc.SignUp(ctx, "role@example.com", "correct-horse")
+	if err != nil {
+		t.Fatalf("sign up failed: %v", err)
+	}
+	if user.Role != domain.RoleUser {
+		t.Errorf("expected new users to get role %q, got %q", domain.RoleUser, user.Role)
+	}
+	if err := svc.VerifyEmail(ctx, mailedToken(t, outbox)); err != nil {
+		t.Fatalf("verification failed: %v", err)
+	}
+
+	tokens, _ := svc.Login(ctx, "role@example.com", "correct-horse", "")
+	if role := accessClaims(t, tokens.AccessToken)["role"]; role != "user" {
+		t.Errorf("expected role claim %q, got %v", "user", role)
+	}
+
+	// A promotion shows up in the next rotated access token
+	repo.UpdateRole(ctx, user.ID, domain.RoleAdmin)
+	rotated, err := svc.RefreshToken(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if role := accessClaims(t, rotated.AccessToken)["role"]; role != "admin" {
+		t.Errorf("expected role claim %q after promotion, got %v", "admin", role)
+	}
+}
+
+func TestUserService_ListUsers(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	svc := service.NewUserService(newUserDeps(repo), config.Default().Auth)
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		repo.Create(ctx, &domain.User{Email: email})
+	}
+
+	t.Run("Page", func(t *testing.T) {
+		page, err := svc.ListUsers(ctx, 2, 1)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if page.Total != 3 || len(page.Items) != 2 || page.Items[0].Email != "b@example.com" {
+			t.Errorf("expected users 2-3 of 3, got %d of %d", len(page.Items), page.Total)
+		}
+	})
+
+	t.Run("Default Limit", func(t *testing.T) {
+		page, _ := svc.ListUsers(ctx, 0, 0)
+		if page.Limit != domain.DefaultUserPageSize {
+			t.Errorf("expected limit %d, got %d", domain.DefaultUserPageSize, page.Limit)
+		}
+	})
+
+	t.Run("Negative Offset", func(t *testing.T) {
+		if _, err := svc.ListUsers(ctx, 10, -1); !errors.Is(err, domain.ErrInvalidUserQuery) {
+			t.Errorf("expected ErrInvalidUserQuery, got %v", err)
+		}
+	})
+}
+
+func TestUserService_Impersonate(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	revocations := NewMockRevocationStore()
+	deps := newUserDeps(repo)
+	deps.Revocations = revocations
+	svc := service.NewUserService(deps, config.Default().Auth)
+
+	admin := &domain.User{Email: "admin@example.com", Role: domain.RoleAdmin}
+	otherAdmin := &domain.User{Email: "other-admin@example.com", Role: domain.RoleAdmin}
+	user := &domain.User{Email: "user@example.com", Role: domain.RoleUser}
+	repo.Create(ctx, admin)
+	repo.Create(ctx, otherAdmin)
+	repo.Create(ctx, user)
+
+	t.Run("Success", func(t *testing.T) {
+		tokens, err := svc.Impersonate(ctx, admin.ID, user.ID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if tokens.RefreshToken != "" {
+			t.Error("expected no refresh token for impersonation")
+		}
+
+		claims := jwt.MapClaims{}
+		if _, err := testKeys.Parse(tokens.AccessToken, token.AudienceAccess, claims); err != nil {
+			t.Fatalf("expected a valid access token, got %v", err)
+		}
+		if claims["sub"] != user.ID.String() || claims["role"] != "user" || claims["type"] != "access" {
+			t.Errorf("expected an access token for the user, got %v", claims)
+		}
+		act, _ := claims["act"].(map[string]interface{})
+		if act["sub"] != admin.ID.String() {
+			t.Errorf("expected the admin in the act claim, got %v", claims["act"])
+		}
+	})
+
+	t.Run("Logout All", func(t *testing.T) {
+		tokens, err := svc.Impersonate(ctx, admin.ID, user.ID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := svc.LogoutAll(ctx, user.ID); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if revoked, _ := revocations.IsRevoked(ctx, accessTokenID(t, tokens.AccessToken)); !revoked {
+			t.Error("expected the impersonation access token to be revoked")
+		}
+	})
+
+	t.Run("Admin", func(t *testing.T) {
+		if _, err := svc.Impersonate(ctx, admin.ID, otherAdmin.ID); !errors.Is(err, domain.ErrCannotImpersonateAdmin) {
+			t.Errorf("expected ErrCannotImpersonateAdmin, got %v", err)
+		}
+	})
+
+	t.Run("Unknown User", func(t *testing.T) {
+		if _, err := svc.Impersonate(ctx, admin.ID, uuid.New()); !errors.Is(err, domain.ErrUserNotFound) {
+			t.Errorf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+}
+
+func TestUserService_LoginThrottle(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	for _, email := range []string{"throttle@example.com", "lockout@example.com", "reset@example.com"} {
+		repo.Create(ctx, &domain.User{Email: email, Password: string(hashed), EmailVerifiedAt: &verifiedAt})
+	}
+
+	newService := func(backoffBase time.Duration) domain.UserService {
+		cfg := config.Default().Auth
+		cfg.Login = config.LoginConfig{
+			FreeAttempts:     2,
+			IPFreeAttempts:   3,
+			BackoffBase:      backoffBase,
+			LockoutThreshold: 4,
+			LockoutDuration:  time.Hour,
+		}
+		return service.NewUserService(newUserDeps(repo), cfg)
+	}
+
+	t.Run("Backoff", func(t *testing.T) {
+		svc := newService(time.Minute)
+		svc.Login(ctx, "throttle@example.com", "wrong", "")
+		svc.Login(ctx, "throttle@example.com", "wrong", "")
+
+		// Even the right password has to wait now
+		_, err := svc.Login(ctx, "throttle@example.com", "secret", "")
+		if !errors.Is(err, domain.ErrTooManyLoginAttempts) {
+			t.Fatalf("expected ErrTooManyLoginAttempts, got %v", err)
+		}
+		var retry *domain.RetryAfterError
+		if !errors.As(err, &retry) || retry.After <= 0 || retry.After > time.Minute {
+			t.Errorf("expected to be told to retry within a minute, got %v", err)
+		}
+	})
+
+	t.Run("Unknown Email", func(t *testing.T) {
+		svc := newService(time.Minute)
+		svc.Login(ctx, "nobody@example.com", "wrong", "")
+		svc.Login(ctx, "nobody@example.com", "wrong", "")
+
+		// Throttled exactly like an existing account
+		if _, err := svc.Login(ctx, "nobody@example.com", "wrong", ""); !errors.Is(err, domain.ErrTooManyLoginAttempts) {
+			t.Errorf("expected ErrTooManyLoginAttempts, got %v", err)
+		}
+	})
+
+	t.Run("Per IP", func(t *testing.T) {
+		svc := newService(time.Minute)
+		for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+			svc.Login(ctx, email, "wrong", "192.0.2.1")
+		}
+
+		if _, err := svc.Login(ctx, "throttle@example.com", "secret", "192.0.2.1"); !errors.Is(err, domain.ErrTooManyLoginAttempts) {
+			t.Errorf("expected the IP to be throttled, got %v", err)
+		}
+		if _, err := svc.Login(ctx, "throttle@example.com", "secret", "192.0.2.2"); err != nil {
+			t.Errorf("expected other IPs to be unaffected, got %v", err)
+		}
+	})
+
+	t.Run("Lockout", func(t *testing.T) {
+		svc := newService(time.Millisecond)
+		for i := 0; i < 4; i++ {
+			time.Sleep(20 * time.Millisecond) // outlast the backoff
+			if _, err := svc.Login(ctx, "lockout@example.com", "wrong", ""); !errors.Is(err, domain.ErrInvalidCredentials) {
+				t.Fatalf("attempt %d: expected ErrInvalidCredentials, got %v", i+1, err)
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		_, err := svc.Login(ctx, "lockout@example.com", "secret", "")
+		if !errors.Is(err, domain.ErrAccountLocked) {
+			t.Fatalf("expected ErrAccountLocked, got %v", err)
+		}
+		var retry *domain.RetryAfterError
+		if !errors.As(err, &retry) || retry.After <= 59*time.Minute {
+			t.Errorf("expected to be told to retry after the lockout, got %v", err)
+		}
+	})
+
+	t.Run("Success Resets", func(t *testing.T) {
+		svc := newService(time.Minute)
+		svc.Login(ctx, "reset@example.com", "wrong", "")
+		if _, err := svc.Login(ctx, "reset@example.com", "secret", ""); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		svc.Login(ctx, "reset@example.com", "wrong", "")
+		if _, err := svc.Login(ctx, "reset@example.com", "secret", ""); err != nil {
+			t.Errorf("expected the earlier failure to be forgotten, got %v", err)
+		}
+	})
+}
+
+func TestUserService_Account(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	outbox := mailer.NewOutbox("", "")
+	deps := newUserDeps(repo)
+	deps.Mailer = outbox
+	svc := service.NewUserService(deps, config.Default().Auth)
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := &domain.User{Email: "me@example.com", Password: string(hashed), EmailVerifiedAt: &verifiedAt}
+	repo.Create(ctx, user)
+	repo.Create(ctx, &domain.User{Email: "taken@example.com", Password: string(hashed), EmailVerifiedAt: &verifiedAt})
+
+	t.Run("Get", func(t *testing.T) {
+		got, err := svc.GetUser(ctx, user.ID)
+		if err != nil || got.Email != "me@example.com" {
+			t.Errorf("expected the user, got %v, %v", got, err)
+		}
+		if _, err := svc.GetUser(ctx, uuid.New()); !errors.Is(err, domain.ErrUserNotFound) {
+			t.Errorf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Change Password", func(t *testing.T) {
+		before, _ := svc.Login(ctx, "me@example.com", "secret", "")
+
+		if _, err := svc.ChangePassword(ctx, user.ID, "wrong", "new-secret-1"); !errors.Is(err, domain.ErrIncorrectPassword) {
+			t.Errorf("expected ErrIncorrectPassword, got %v", err)
+		}
+		if _, err := svc.ChangePassword(ctx, user.ID, "secret", "short"); !errors.Is(err, domain.ErrWeakPassword) {
+			t.Errorf("expected ErrWeakPassword, got %v", err)
+		}
+
+		after, err := svc.ChangePassword(ctx, user.ID, "secret", "new-secret-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := svc.RefreshToken(ctx, before.RefreshToken); err == nil {
+			t.Error("expected other sessions to be signed out")
+		}
+		if _, err := svc.RefreshToken(ctx, after.RefreshToken); err != nil {
+			t.Errorf("expected the new session to work, got %v", err)
+		}
+		if _, err := svc.Login(ctx, "me@example.com", "new-secret-1", ""); err != nil {
+			t.Errorf("expected the new password to work, got %v", err)
+		}
+	})
+
+	t.Run("Change Email", func(t *testing.T) {
+		if _, err := svc.ChangeEmail(ctx, user.ID, "new@example.com", "wrong"); !errors.Is(err, domain.ErrIncorrectPassword) {
+			t.Errorf("expected ErrIncorrectPassword, got %v", err)
+		}
+		if _, err := svc.ChangeEmail(ctx, user.ID, "Taken@Example.com", "new-secret-1"); !errors.Is(err, domain.ErrEmailTaken) {
+			t.Errorf("expected ErrEmailTaken, got %v", err)
+		}
+
+		got, err := svc.ChangeEmail(ctx, user.ID, " New@Example.com ", "new-secret-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got.Email != "me@example.com" || got.PendingEmail == nil || *got.PendingEmail != "new@example.com" {
+			t.Errorf("expected the change to be pending, got %+v", got)
+		}
+		messages := outbox.Messages()
+		if notice := messages[len(messages)-2]; notice.To != "me@example.com" {
+			t.Errorf("expected the current address to be told, got a mail to %q", notice.To)
+		}
+		if link := messages[len(messages)-1]; link.To != "new@example.com" {
+			t.Errorf("expected the link to go to the new address, got %q", link.To)
+		}
+		if _, err := svc.Login(ctx, "me@example.com", "new-secret-1", ""); err != nil {
+			t.Errorf("expected the current email to keep working until the link is followed, got %v", err)
+		}
+
+		if err := svc.VerifyEmail(ctx, mailedToken(t, outbox)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := svc.Login(ctx, "new@example.com", "new-secret-1", ""); err != nil {
+			t.Errorf("expected the new email to work, got %v", err)
+		}
+		if _, err := svc.Login(ctx, "me@example.com", "new-secret-1", ""); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Errorf("expected the old email to stop working, got %v", err)
+		}
+	})
+
+	t.Run("Delete Account", func(t *testing.T) {
+		tokens, _ := svc.Login(ctx, "new@example.com", "new-secret-1", "")
+
+		if err := svc.DeleteAccount(ctx, user.ID, "wrong"); !errors.Is(err, domain.ErrIncorrectPassword) {
+			t.Errorf("expected ErrIncorrectPassword, got %v", err)
+		}
+		if err := svc.DeleteAccount(ctx, user.ID, "new-secret-1"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := svc.GetUser(ctx, user.ID); !errors.Is(err, domain.ErrUserNotFound) {
+			t.Errorf("expected the user to be gone, got %v", err)
+		}
+		if _, err := svc.RefreshToken(ctx, tokens.RefreshToken); err == nil {
+			t.Error("expected the user's sessions to be signed out")
+		}
+	})
+}
+
+func TestUserService_Rehash(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	svc := service.NewUserService(newUserDeps(repo), config.Default().Auth)
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	repo.Create(ctx, &domain.User{Email: "legacy@example.com", Password: string(hashed), EmailVerifiedAt: &verifiedAt})
+
+	if _, err := svc.Login(ctx, "legacy@example.com", "wrong", ""); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if repo.users["legacy@example.com"].Password != string(hashed) {
+		t.Error("expected a failed login to leave the hash alone")
+	}
+
+	if _, err := svc.Login(ctx, "legacy@example.com", "secret", ""); err != nil {
+		t.Fatalf("expected the bcrypt hash to still work, got %v", err)
+	}
+	upgraded := repo.users["legacy@example.com"].Password
+	if !strings.HasPrefix(upgraded, "$argon2id$") || testHasher.NeedsRehash(upgraded) {
+		t.Errorf("expected the hash to be upgraded to the current Argon2id parameters, got %q", upgraded)
+	}
+
+	if _, err := svc.Login(ctx, "legacy@example.com", "secret", ""); err != nil {
+		t.Fatalf("expected the upgraded hash to work, got %v", err)
+	}
+	if repo.users["legacy@example.com"].Password != upgraded {
+		t.Error("expected an up to date hash not to be replaced")
+	}
+}
+
+func TestUserService_TwoFactor(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	mfa := NewMockMFARepo()
+	deps := newUserDeps(repo)
+	deps.MFA = mfa
+	svc := service.NewUserService(deps, config.Default().Auth)
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := &domain.User{Email: "mfa@example.com", Password: string(hashed), EmailVerifiedAt: &verifiedAt}
+	repo.Create(ctx, user)
+
+	// codeAt is the app's code a number of steps from now
+	var secret string
+	codeAt := func(steps int64) string {
+		code, err := totp.Code(secret, totp.Step(time.Now())+steps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	var recoveryCodes []string
+	t.Run("Enroll", func(t *testing.T) {
+		enrollment, err := svc.EnrollTOTP(ctx, user.ID, "secret")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		secret = enrollment.Secret
+		if !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/") || !strings.Contains(enrollment.ProvisioningURI, "secret="+secret) {
+			t.Errorf("expected a provisioning URI with the secret, got %q", enrollment.ProvisioningURI)
+		}
+
+		// Not on until confirmed
+		tokens, err := svc.Login(ctx, "mfa@example.com", "secret", "")
+		if err != nil || tokens.AccessToken == "" {
+			t.Errorf("expected a plain login before confirming, got %+v, %v", tokens, err)
+		}
+
+		if _, err := svc.ConfirmTOTP(ctx, user.ID, "secret", "abcdef"); !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Errorf("expected ErrInvalidMFACode, got %v", err)
+		}
+		recoveryCodes, err = svc.ConfirmTOTP(ctx, user.ID, "secret", codeAt(0))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(recoveryCodes) != 10 {
+			t.Errorf("expected 10 recovery codes, got %d", len(recoveryCodes))
+		}
+		if _, err := svc.EnrollTOTP(ctx, user.ID, "secret"); !errors.Is(err, domain.ErrMFAAlreadyEnabled) {
+			t.Errorf("expected ErrMFAAlreadyEnabled, got %v", err)
+		}
+	})
+
+	login := func(t *testing.T) string {
+		t.Helper()
+		tokens, err := svc.Login(ctx, "mfa@example.com", "secret", "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if tokens.MFAToken == "" || tokens.AccessToken != "" || tokens.RefreshToken != "" {
+			t.Fatalf("expected only an MFA token, got %+v", tokens)
+		}
+		return tokens.MFAToken
+	}
+
+	t.Run("Login With Code", func(t *testing.T) {
+		mfaToken := login(t)
+		if _, err := svc.LoginMFA(ctx, mfaToken, codeAt(0), ""); !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Errorf("expected the code used to confirm not to work again, got %v", err)
+		}
+
+		tokens, err := svc.LoginMFA(ctx, mfaToken, codeAt(1), "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := svc.RefreshToken(ctx, tokens.RefreshToken); err != nil {
+			t.Errorf("expected a working session, got %v", err)
+		}
+		if _, err := svc.LoginMFA(ctx, mfaToken, codeAt(-1), ""); !errors.Is(err, domain.ErrInvalidMFAToken) {
+			t.Errorf("expected the MFA token to be spent, got %v", err)
+		}
+	})
+
+	t.Run("Login With Recovery Code", func(t *testing.T) {
+		mfaToken := login(t)
+		if _, err := svc.LoginMFA(ctx, mfaToken, strings.ToUpper(recoveryCodes[0]), ""); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := svc.LoginMFA(ctx, login(t), recoveryCodes[0], ""); !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Errorf("expected a recovery code to work once, got %v", err)
+		}
+	})
+
+	t.Run("Not An MFA Token", func(t *testing.T) {
+		accessToken, _ := testKeys.Sign(jwt.MapClaims{
+			"iss":  testKeys.Issuer(),
+			"aud":  token.AudienceAccess,
+			"sub":  user.ID.String(),
+			"jti":  uuid.NewString(),
+			"type": "access",
+			"exp":  time.Now().Add(time.Minute).Unix(),
+		})
+		if _, err := svc.LoginMFA(ctx, accessToken, codeAt(1), ""); !errors.Is(err, domain.ErrInvalidMFAToken) {
+			t.Errorf("expected ErrInvalidMFAToken, got %v", err)
+		}
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		if err := svc.DisableMFA(ctx, user.ID, "wrong"); !errors.Is(err, domain.ErrIncorrectPassword) {
+			t.Errorf("expected ErrIncorrectPassword, got %v", err)
+		}
+		if err := svc.DisableMFA(ctx, user.ID, "secret"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		tokens, err := svc.Login(ctx, "mfa@example.com", "secret", "")
+		if err != nil || tokens.AccessToken == "" {
+			t.Errorf("expected a plain login again, got %+v, %v", tokens, err)
+		}
+	})
+}
+
+func TestUserService_TwoFactorThrottle(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	mfa := NewMockMFARepo()
+	cfg := config.Default().Auth
+	cfg.Login.FreeAttempts = 1
+	cfg.Login.BackoffBase = time.Minute
+	deps := newUserDeps(repo)
+	deps.MFA = mfa
+	svc := service.NewUserService(deps, cfg)
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := &domain.User{Email: "guess@example.com", Password: string(hashed), EmailVerifiedAt: &verifiedAt}
+	repo.Create(ctx, user)
+	enrollment, _ := svc.EnrollTOTP(ctx, user.ID, "secret")
+	code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	if _, err := svc.ConfirmTOTP(ctx, user.ID, "secret", code); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tokens, _ := svc.Login(ctx, "guess@example.com", "secret", "")
+	if _, err := svc.LoginMFA(ctx, tokens.MFAToken, "not-a-code", ""); !errors.Is(err, domain.ErrInvalidMFACode) {
+		t.Fatalf("expected ErrInvalidMFACode, got %v", err)
+	}
+	// A wrong code counts like a wrong password
+	next, _ := totp.Code(enrollment.Secret, totp.Step(time.Now())+1)
+	if _, err := svc.LoginMFA(ctx, tokens.MFAToken, next, ""); !errors.Is(err, domain.ErrTooManyLoginAttempts) {
+		t.Errorf("expected ErrTooManyLoginAttempts, got %v", err)
+	}
+}
+
+func TestUserService_TwoFactorLockout(t *testing.T) {
+	constructors := map[string]func(service.UserDeps, config.AuthConfig) domain.UserService{
+		"UserService":    service.NewUserService,
+		"UserOldService": service.NewUserOldService,
+	}
+	for name, newService := range constructors {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewMockUserRepo()
+			cfg := config.Default().Auth
+			// Next to no backoff, so that only the lockout can stop the guessing
+			cfg.Login.BackoffBase = time.Nanosecond
+			svc := newService(newUserDeps(repo), cfg)
+
+			hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+			user := &domain.User{Email: "stolen@example.com", Password: string(hashed), EmailVerifiedAt: &verifiedAt}
+			repo.Create(ctx, user)
+			enrollment, _ := svc.EnrollTOTP(ctx, user.ID, "secret")
+			code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+			if _, err := svc.ConfirmTOTP(ctx, user.ID, "secret", code); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			// Someone with the password logs in again between guesses at the code
+			var err error
+			for range 4 * cfg.Login.LockoutThreshold {
+				var tokens *domain.TokenPair
+				if tokens, err = svc.Login(ctx, "stolen@example.com", "secret", ""); err != nil {
+					break
+				}
+				if _, err = svc.LoginMFA(ctx, tokens.MFAToken, "not-a-code", ""); !errors.Is(err, domain.ErrInvalidMFACode) {
+					break
+				}
+			}
+			if !errors.Is(err, domain.ErrAccountLocked) {
+				t.Errorf("expected ErrAccountLocked, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUserService_TwoFactorNeedsPassword(t *testing.T) {
+	constructors := map[string]func(service.UserDeps, config.AuthConfig) domain.UserService{
+		"UserService":    service.NewUserService,
+		"UserOldService": service.NewUserOldService,
+	}
+	for name, newService := range constructors {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewMockUserRepo()
+			svc := newService(newUserDeps(repo), config.Default().Auth)
+
+			hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+			user := &domain.User{Email: "token-thief@example.com", Password: string(hashed), EmailVerifiedAt: &verifiedAt}
+			repo.Create(ctx, user)
+
+			// An access token alone can't start the setup...
+			for _, password := range []string{"", "wrong"} {
+				if _, err := svc.EnrollTOTP(ctx, user.ID, password); !errors.Is(err, domain.ErrIncorrectPassword) {
+					t.Errorf("expected ErrIncorrectPassword enrolling with %q, got %v", password, err)
+				}
+			}
+
+			// ...nor finish it
+			enrollment, err := svc.EnrollTOTP(ctx, user.ID, "secret")
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+			for _, password := range []string{"", "wrong"} {
+				if _, err := svc.ConfirmTOTP(ctx, user.ID, password, code); !errors.Is(err, domain.ErrIncorrectPassword) {
+					t.Errorf("expected ErrIncorrectPassword confirming with %q, got %v", password, err)
+				}
+			}
+
+			tokens, err := svc.Login(ctx, "token-thief@example.com", "secret", "")
+			if err != nil || tokens.AccessToken == "" {
+				t.Errorf("expected two-factor authentication to stay off, got %+v, %v", tokens, err)
+			}
+		})
+	}
+}
+
+func TestUserService_PasswordlessAccount(t *testing.T) {
+	constructors := map[string]func(service.UserDeps, config.AuthConfig) domain.UserService{
+		"UserService":    service.NewUserService,
+		"UserOldService": service.NewUserOldService,
+	}
+	for name, newService := range constructors {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewMockUserRepo()
+			deps := newUserDeps(repo)
+			identities := NewMockIdentityRepo(repo)
+			deps.Identities = identities
+			svc := newService(deps, config.Default().Auth)
+
+			signIn := func() {
+				t.Helper()
+				if _, err := svc.LoginExternal(ctx, domain.ExternalIdentity{Provider: "fake", Subject: "nopass", Email: "nopass@example.com", EmailVerified: true}); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			}
+			signIn()
+			user := repo.users["nopass@example.com"]
+
+			// Just signed in with the provider, which stands in for the password
+			if _, err := svc.ChangeEmail(ctx, user.ID, "moved@example.com", ""); err != nil {
+				t.Errorf("expected a recent sign-in to do, got %v", err)
+			}
+
+			longAgo := time.Now().Add(-time.Hour)
+			for _, identity := range identities.identities {
+				identity.LastSignInAt = &longAgo
+			}
+			// Not a failed login: repeating it never ends in a lockout
+			for _, password := range []string{"", "guess", "guess", "guess", "guess", "guess", "guess", "guess", "guess", "guess", "guess", ""} {
+				if err := svc.DeleteAccount(ctx, user.ID, password); !errors.Is(err, domain.ErrReauthenticationRequired) {
+					t.Fatalf("expected ErrReauthenticationRequired, got %v", err)
+				}
+			}
+			if err := svc.DisableMFA(ctx, user.ID, ""); !errors.Is(err, domain.ErrReauthenticationRequired) {
+				t.Errorf("expected ErrReauthenticationRequired, got %v", err)
+			}
+
+			signIn()
+			if _, err := svc.ChangePassword(ctx, user.ID, "", "correct-horse-battery"); err != nil {
+				t.Fatalf("expected a fresh sign-in to allow setting a password, got %v", err)
+			}
+			if _, err := svc.Login(ctx, "nopass@example.com", "correct-horse-battery", ""); err != nil {
+				t.Errorf("expected the new password to work, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUserService_LoginExternal(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockUserRepo()
+	svc := service.NewUserService(newUserDeps(repo), config.Default().Auth)
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	// subject is who the tokens were issued to
+	subject := func(t *testing.T, tokens *domain.TokenPair) string {
+		t.Helper()
+		if tokens == nil || tokens.AccessToken == "" {
+			t.Fatalf("expected a token pair, got %+v", tokens)
+		}
+		sub, _ := accessClaims(t, tokens.AccessToken)["sub"].(string)
+		return sub
+	}
+
+	t.Run("New Account", func(t *testing.T) {
+		tokens, err := svc.LoginExternal(ctx, domain.ExternalIdentity{Provider: "fake", Subject: "new", Email: "new@example.com", EmailVerified: true})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		user := repo.users["new@example.com"]
+		if user == nil || subject(t, tokens) != user.ID.String() {
+			t.Fatal("expected an account to be created for the email")
+		}
+		if user.Password != "" || user.EmailVerifiedAt == nil {
+			t.Errorf("expected a verified account without a password, got %+v", user)
+		}
+		if _, err := svc.Login(ctx, "new@example.com", "", ""); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Errorf("expected no password to open the account, got %v", err)
+		}
+	})
+
+	t.Run("Known Identity", func(t *testing.T) {
+		// The email at the provider changed; the subject is what counts
+		tokens, err := svc.LoginExternal(ctx, domain.ExternalIdentity{Provider: "fake", Subject: "new", Email: "renamed@example.com"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if subject(t, tokens) != repo.users["new@example.com"].ID.String() {
+			t.Error("expected the linked account to be signed in")
+		}
+		if _, exists := repo.users["renamed@example.com"]; exists {
+			t.Error("expected no second account")
+		}
+	})
+
+	t.Run("Links Existing Account", func(t *testing.T) {
+		user := &domain.User{Email: "existing@example.com", Password: string(hashed), EmailVerifiedAt: &verifiedAt}
+		repo.Create(ctx, user)
+
+		tokens, err := svc.LoginExternal(ctx, domain.ExternalIdentity{Provider: "fake", Subject: "existing", Email: "existing@example.com", EmailVerified: true})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if subject(t, tokens) != user.ID.String() {
+			t.Error("expected the account with the email to be signed in")
+		}
+		if _, err := svc.Login(ctx, "existing@example.com", "secret", ""); err != nil {
+			t.Errorf("expected the password to keep working, got %v", err)
+		}
+	})
+
+	t.Run("Takes Over Unverified Account", func(t *testing.T) {
+		squatter := &domain.User{Email: "squatted@example.com", Password: string(hashed)}
+		repo.Create(ctx, squatter)
+
+		if _, err := svc.LoginExternal(ctx, domain.ExternalIdentity{Provider: "fake", Subject: "owner", Email: "squatted@example.com", EmailVerified: true}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if repo.users["squatted@example.com"].EmailVerifiedAt == nil {
+			t.Error("expected the email to be verified")
+		}
+		if _, err := svc.Login(ctx, "squatted@example.com", "secret", ""); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Errorf("expected the unproven password to be dropped, got %v", err)
+		}
+	})
+
+	t.Run("Unverified Email", func(t *testing.T) {
+		_, err := svc.LoginExternal(ctx, domain.ExternalIdentity{Provider: "fake", Subject: "unverified", Email: "existing@example.com"})
+		if !errors.Is(err, domain.ErrExternalEmailNotVerified) {
+			t.Errorf("expected ErrExternalEmailNotVerified, got %v", err)
+		}
+	})
+
+	t.Run("Two-Factor", func(t *testing.T) {
+		user := repo.users["existing@example.com"]
+		enrollment, _ := svc.EnrollTOTP(ctx, user.ID, "secret")
+		code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+		if _, err := svc.ConfirmTOTP(ctx, user.ID, "secret", code); err != nil {
+			t.Fatal(err)
+		}
+
+		tokens, err := svc.LoginExternal(ctx, domain.ExternalIdentity{Provider: "fake", Subject: "existing"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if tokens.MFAToken == "" || tokens.AccessToken != "" {
+			t.Errorf("expected only an MFA token, got %+v", tokens)
+		}
+	})
+}
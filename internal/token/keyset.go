@@ -0,0 +1,280 @@
+// Package token signs and verifies the API's JWTs with asymmetric keys.
+//
+// Tokens are signed with a single signing key and carry its key ID in the
+// "kid" header. Verification accepts any key in the set, so a new key can be
+// rolled out while tokens signed with the previous one are still in use.
+// The public half of every key is published as a JWK Set for other services.
+//
+// Every token names the API in its "iss" claim and what it is for in its
+// "aud" claim, and is only accepted for that audience: a refresh token can't
+// pass for an access token even though both are signed with the same key.
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a signing or verification key together with its key ID.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	public crypto.PublicKey
+	signer crypto.Signer // nil for verification-only keys
+}
+
+// NewSigningKey wraps an RSA or Ed25519 private key. RSA keys sign with
+// RS256 and Ed25519 keys with EdDSA.
+func NewSigningKey(private crypto.Signer) (*Key, error) {
+	key, err := NewVerificationKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.signer = private
+	return key, nil
+}
+
+// NewVerificationKey wraps an RSA or Ed25519 public key. The key ID is its
+// RFC 7638 thumbprint, so it is the same wherever the key is loaded.
+func NewVerificationKey(public crypto.PublicKey) (*Key, error) {
+	var method jwt.SigningMethod
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key is %d bits, at least 2048 are required", k.N.BitLen())
+		}
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T: use RSA or Ed25519", public)
+	}
+
+	key := &Key{Method: method, public: public}
+	thumbprint, err := json.Marshal(key.jwk(false))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(thumbprint)
+	key.ID = base64.RawURLEncoding.EncodeToString(sum[:])
+	return key, nil
+}
+
+// JWK is the public part of a key as published in the JWK Set.
+type JWK struct {
+	Crv string `json:"crv,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kty string `json:"kty"`
+	N   string `json:"n,omitempty"`
+	X   string `json:"x,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set (RFC 7517).
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwk renders the key. Without metadata only the required members remain, in
+// the lexicographic order RFC 7638 thumbprints are computed over.
+func (k *Key) jwk(metadata bool) JWK {
+	var jwk JWK
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	if metadata {
+		jwk.Alg = k.Method.Alg()
+		jwk.Kid = k.ID
+		jwk.Use = "sig"
+	}
+	return jwk
+}
+
+// PublicKey decodes an RSA or Ed25519 JWK, such as one published by another service.
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case j.Kty == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("JWK %q: bad modulus: %w", j.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, fmt.Errorf("JWK %q: bad exponent: %w", j.Kid, err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("JWK %q: unsupported exponent", j.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case j.Kty == "OKP" && j.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("JWK %q: bad Ed25519 key", j.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("JWK %q: unsupported key type %s %s", j.Kid, j.Kty, j.Crv)
+	}
+}
+
+// The audiences of the tokens the API issues, one for each kind of token.
+const (
+	AudienceAccess    = "access"
+	AudienceRefresh   = "refresh"
+	AudienceMFA       = "mfa"
+	AudienceOIDCState = "oidc_state"
+)
+
+// KeySet holds the key new tokens are signed with and every key tokens are accepted from.
+type KeySet struct {
+	issuer  string
+	signing *Key
+	keys    map[string]*Key
+	order   []*Key
+}
+
+// NewKeySet creates a key set for the tokens of issuer that signs with signing
+// and also accepts tokens signed by the verification keys, typically the keys
+// being rotated out.
+func NewKeySet(issuer string, signing *Key, verification ...*Key) (*KeySet, error) {
+	if issuer == "" {
+		return nil, errors.New("an issuer is required")
+	}
+	if signing == nil || signing.signer == nil {
+		return nil, errors.New("a private signing key is required")
+	}
+	ks := &KeySet{issuer: issuer, signing: signing, keys: map[string]*Key{}}
+	for _, key := range append([]*Key{signing}, verification...) {
+		if _, dup := ks.keys[key.ID]; dup {
+			continue
+		}
+		ks.keys[key.ID] = key
+		ks.order = append(ks.order, key)
+	}
+	return ks, nil
+}
+
+// LoadKeySet reads a PEM private key to sign with and PEM public (or private)
+// keys that are only used for verification.
+func LoadKeySet(issuer, signingKeyFile string, verificationKeyFiles ...string) (*KeySet, error) {
+	if signingKeyFile == "" {
+		return nil, errors.New("no signing key configured")
+	}
+	private, err := readPEMKey(signingKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s does not contain a private key", signingKeyFile)
+	}
+	signing, err := NewSigningKey(signer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", signingKeyFile, err)
+	}
+
+	var verification []*Key
+	for _, file := range verificationKeyFiles {
+		parsed, err := readPEMKey(file)
+		if err != nil {
+			return nil, err
+		}
+		public := parsed
+		if signer, ok := parsed.(crypto.Signer); ok {
+			public = signer.Public()
+		}
+		key, err := NewVerificationKey(public)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		verification = append(verification, key)
+	}
+	return NewKeySet(issuer, signing, verification...)
+}
+
+// readPEMKey parses a PKCS#8 private key, a PKCS#1 RSA private key or a PKIX public key.
+func readPEMKey(file string) (any, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", file)
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", file, block.Type)
+	}
+}
+
+// Issuer is what tokens of the key set carry in their "iss" claim.
+func (ks *KeySet) Issuer() string {
+	return ks.issuer
+}
+
+// Sign signs the claims with the signing key and sets the kid header. The
+// claims are signed as they are: they need the "iss" and "aud" Parse checks.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.signer)
+}
+
+// Parse verifies the token against the key named by its kid header and
+// parses it into claims. The algorithm has to be the one of that key, and
+// the token has to be issued by the key set's issuer for audience.
+func (ks *KeySet) Parse(tokenString, audience string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.public, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(ks.issuer),
+		jwt.WithAudience(audience),
+	)
+}
+
+// JWKS returns the public keys of the set, signing key first.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(ks.order))}
+	for _, key := range ks.order {
+		set.Keys = append(set.Keys, key.jwk(true))
+	}
+	return set
+}
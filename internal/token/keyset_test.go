@@ -0,0 +1,215 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newEd25519Key(t *testing.T) *Key {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewSigningKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+const issuer = "https://api.example.com"
+
+func claims() jwt.MapClaims {
+	return jwt.MapClaims{"iss": issuer, "aud": AudienceAccess, "sub": "user", "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+func TestSignAndParse(t *testing.T) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := NewSigningKey(rsaPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, key := range map[string]*Key{"RS256": rsaKey, "EdDSA": newEd25519Key(t)} {
+		t.Run(name, func(t *testing.T) {
+			keys, _ := NewKeySet(issuer, key)
+			signed, err := keys.Sign(claims())
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			parsed, err := keys.Parse(signed, AudienceAccess, jwt.MapClaims{})
+			if err != nil {
+				t.Fatalf("expected token to verify, got %v", err)
+			}
+			if parsed.Header["kid"] != key.ID || parsed.Method.Alg() != name {
+				t.Errorf("expected kid %s and alg %s, got %v and %s", key.ID, name, parsed.Header["kid"], parsed.Method.Alg())
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	oldKey, newKey := newEd25519Key(t), newEd25519Key(t)
+	before, _ := NewKeySet(issuer, oldKey)
+	signedBefore, _ := before.Sign(claims())
+
+	// The new key signs; the old one still verifies what it signed
+	after, _ := NewKeySet(issuer, newKey, oldKey)
+	if _, err := after.Parse(signedBefore, AudienceAccess, jwt.MapClaims{}); err != nil {
+		t.Errorf("expected token signed by the previous key to verify, got %v", err)
+	}
+	signedAfter, _ := after.Sign(claims())
+	if _, err := after.Parse(signedAfter, AudienceAccess, jwt.MapClaims{}); err != nil {
+		t.Errorf("expected token signed by the new key to verify, got %v", err)
+	}
+
+	// Once the old key is dropped its tokens are rejected
+	dropped, _ := NewKeySet(issuer, newKey)
+	if _, err := dropped.Parse(signedBefore, AudienceAccess, jwt.MapClaims{}); err == nil {
+		t.Error("expected token signed by a removed key to be rejected")
+	}
+
+	jwks := after.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != newKey.ID || jwks.Keys[1].Kid != oldKey.ID {
+		t.Errorf("expected JWKS to list the signing key first, then the old key, got %+v", jwks.Keys)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	key := newEd25519Key(t)
+	keys, _ := NewKeySet(issuer, key)
+
+	t.Run("HMAC With Known kid", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+		token.Header["kid"] = key.ID
+		signed, _ := token.SignedString([]byte("secret"))
+		if _, err := keys.Parse(signed, AudienceAccess, jwt.MapClaims{}); err == nil {
+			t.Error("expected HS256 token to be rejected")
+		}
+	})
+
+	t.Run("Missing kid", func(t *testing.T) {
+		_, private, _ := ed25519.GenerateKey(rand.Reader)
+		signed, _ := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims()).SignedString(private)
+		if _, err := keys.Parse(signed, AudienceAccess, jwt.MapClaims{}); err == nil {
+			t.Error("expected token without kid to be rejected")
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		expired := claims()
+		expired["exp"] = time.Now().Add(-time.Minute).Unix()
+		signed, _ := keys.Sign(expired)
+		if _, err := keys.Parse(signed, AudienceAccess, jwt.MapClaims{}); err == nil {
+			t.Error("expected expired token to be rejected")
+		}
+	})
+
+	t.Run("Other Audience", func(t *testing.T) {
+		signed, _ := keys.Sign(claims())
+		if _, err := keys.Parse(signed, AudienceRefresh, jwt.MapClaims{}); err == nil {
+			t.Error("expected an access token to be rejected as a refresh token")
+		}
+	})
+
+	t.Run("Other Issuer", func(t *testing.T) {
+		other := claims()
+		other["iss"] = "https://other.example.com"
+		signed, _ := keys.Sign(other)
+		if _, err := keys.Parse(signed, AudienceAccess, jwt.MapClaims{}); err == nil {
+			t.Error("expected a token from another issuer to be rejected")
+		}
+	})
+
+	t.Run("Missing Audience", func(t *testing.T) {
+		missing := claims()
+		delete(missing, "aud")
+		signed, _ := keys.Sign(missing)
+		if _, err := keys.Parse(signed, AudienceAccess, jwt.MapClaims{}); err == nil {
+			t.Error("expected a token without an audience to be rejected")
+		}
+	})
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+		return path
+	}
+
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	privateDER, _ := x509.MarshalPKCS8PrivateKey(private)
+	signingFile := write("signing.pem", "PRIVATE KEY", privateDER)
+
+	oldPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+	publicDER, _ := x509.MarshalPKIXPublicKey(oldPublic)
+	verificationFile := write("old.pem", "PUBLIC KEY", publicDER)
+
+	keys, err := LoadKeySet(issuer, signingFile, verificationFile)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(keys.JWKS().Keys) != 2 {
+		t.Errorf("expected 2 keys, got %d", len(keys.JWKS().Keys))
+	}
+	expected, _ := NewVerificationKey(public)
+	if keys.JWKS().Keys[0].Kid != expected.ID {
+		t.Error("expected the kid to be derived from the key alone")
+	}
+
+	if _, err := LoadKeySet(issuer, ""); err == nil {
+		t.Error("expected an error when no signing key is configured")
+	}
+	if _, err := LoadKeySet("", signingFile); err == nil {
+		t.Error("expected an error when no issuer is configured")
+	}
+	if _, err := LoadKeySet(issuer, verificationFile); err == nil {
+		t.Error("expected an error when the signing key is a public key")
+	}
+}
+
+func TestJWKPublicKey(t *testing.T) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := NewSigningKey(rsaPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, key := range map[string]*Key{"RSA": rsaKey, "Ed25519": newEd25519Key(t)} {
+		t.Run(name, func(t *testing.T) {
+			keys, _ := NewKeySet(issuer, key)
+			public, err := keys.JWKS().Keys[0].PublicKey()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			// The thumbprint covers the whole key, so equal IDs mean the key survived the round trip
+			decoded, err := NewVerificationKey(public)
+			if err != nil || decoded.ID != key.ID {
+				t.Errorf("expected the JWK to decode to the same key, got %v", err)
+			}
+		})
+	}
+
+	if _, err := (JWK{Kty: "EC", Crv: "P-256"}).PublicKey(); err == nil {
+		t.Error("expected an EC key to be rejected")
+	}
+}
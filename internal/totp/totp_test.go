@@ -0,0 +1,71 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// The SHA-1 test vectors of RFC 6238, appendix B, cut to 6 digits
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("at %d expected %s, got %s", tt.unix, tt.want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	code, _ := Code(secret, Step(now))
+
+	if step, ok, err := Validate(secret, code, now); !ok || err != nil || step != Step(now) {
+		t.Errorf("expected the current code to match at step %d, got %d, %v, %v", Step(now), step, ok, err)
+	}
+	if _, ok, _ := Validate(secret, " "+code+" ", now.Add(Period)); !ok {
+		t.Error("expected the previous step to be accepted, for clock drift")
+	}
+	if _, ok, _ := Validate(secret, code, now.Add(2*Period)); ok {
+		t.Error("expected a code two steps old to be refused")
+	}
+	if _, ok, _ := Validate(secret, "12345", now); ok {
+		t.Error("expected a short code to be refused")
+	}
+	if _, _, err := Validate("not base32!", "123456", now); err == nil {
+		t.Error("expected an invalid secret to be an error")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Todo API", "me@example.com", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Todo API:me@example.com" {
+		t.Errorf("expected otpauth://totp/Todo API:me@example.com, got %s", uri)
+	}
+	if q := uri.Query(); q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Todo API" || q.Get("digits") != "6" {
+		t.Errorf("expected the secret, issuer and digits in the query, got %s", uri.RawQuery)
+	}
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prachaya-orr/relearn-golang/internal/gormhooks"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// querySpanKey is where a query's span waits for the query to finish.
+const querySpanKey = "tracing:query_span"
+
+// querySpan is a query's span, and the context it was started in
+type querySpan struct {
+	span   trace.Span
+	parent context.Context
+}
+
+// gormPlugin starts a span for every query GORM runs.
+type gormPlugin struct {
+	tracer trace.Tracer
+}
+
+// GormPlugin returns a GORM plugin tracing each query, as a child of the span
+// in the query's context; register it with db.Use. The SQL is recorded with
+// placeholders: the values include password hashes and emails.
+func GormPlugin(provider trace.TracerProvider) gorm.Plugin {
+	return gormPlugin{tracer: Tracer(provider)}
+}
+
+func (gormPlugin) Name() string {
+	return "tracing"
+}
+
+func (p gormPlugin) Initialize(db *gorm.DB) error {
+	return gormhooks.Register(db, "tracing", func(operation string) (func(*gorm.DB), func(*gorm.DB)) {
+		return p.start(operation), finish
+	})
+}
+
+func (p gormPlugin) start(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		parent := db.Statement.Context
+		ctx, span := p.tracer.Start(parent, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemNamePostgreSQL),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(querySpanKey, querySpan{span: span, parent: parent})
+	}
+}
+
+func finish(db *gorm.DB) {
+	value, ok := db.InstanceGet(querySpanKey)
+	if !ok {
+		return
+	}
+	query := value.(querySpan)
+	// Queries chained on the same statement are the caller's children, not this query's
+	db.Statement.Context = query.parent
+	span := query.span
+	span.SetAttributes(
+		semconv.DBCollectionName(db.Statement.Table),
+		semconv.DBQueryText(db.Statement.SQL.String()),
+	)
+	// Finding nothing is an answer, not a failure
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,202 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// todoService starts a span for each call to the TodoService it wraps.
+type todoService struct {
+	next   domain.TodoService
+	tracer trace.Tracer
+}
+
+// TodoService returns svc, tracing each of its calls as a child of the span
+// in the call's context.
+func TodoService(svc domain.TodoService, provider trace.TracerProvider) domain.TodoService {
+	return &todoService{next: svc, tracer: Tracer(provider)}
+}
+
+func (s *todoService) Create(ctx context.Context, title, description string, userID uuid.UUID) (_ *domain.Todo, err error) {
+	ctx, span := s.tracer.Start(ctx, "TodoService.Create")
+	defer func() { end(span, err) }()
+	return s.next.Create(ctx, title, description, userID)
+}
+
+func (s *todoService) FindAll(ctx context.Context, query domain.TodoQuery) (_ *domain.TodoPage, err error) {
+	ctx, span := s.tracer.Start(ctx, "TodoService.FindAll")
+	defer func() { end(span, err) }()
+	return s.next.FindAll(ctx, query)
+}
+
+func (s *todoService) FindByID(ctx context.Context, id, userID uuid.UUID) (_ *domain.Todo, err error) {
+	ctx, span := s.tracer.Start(ctx, "TodoService.FindByID")
+	defer func() { end(span, err) }()
+	return s.next.FindByID(ctx, id, userID)
+}
+
+func (s *todoService) Update(ctx context.Context, id, userID uuid.UUID, version int64, title, description string, completed bool) (_ *domain.Todo, err error) {
+	ctx, span := s.tracer.Start(ctx, "TodoService.Update")
+	defer func() { end(span, err) }()
+	return s.next.Update(ctx, id, userID, version, title, description, completed)
+}
+
+func (s *todoService) Patch(ctx context.Context, id, userID uuid.UUID, version int64, patch domain.TodoPatch) (_ *domain.Todo, err error) {
+	ctx, span := s.tracer.Start(ctx, "TodoService.Patch")
+	defer func() { end(span, err) }()
+	return s.next.Patch(ctx, id, userID, version, patch)
+}
+
+func (s *todoService) Delete(ctx context.Context, id, userID uuid.UUID, version int64) (err error) {
+	ctx, span := s.tracer.Start(ctx, "TodoService.Delete")
+	defer func() { end(span, err) }()
+	return s.next.Delete(ctx, id, userID, version)
+}
+
+func (s *todoService) DeleteAll(ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "TodoService.DeleteAll")
+	defer func() { end(span, err) }()
+	return s.next.DeleteAll(ctx)
+}
+
+func (s *todoService) Restore(ctx context.Context, id, userID uuid.UUID) (_ *domain.Todo, err error) {
+	ctx, span := s.tracer.Start(ctx, "TodoService.Restore")
+	defer func() { end(span, err) }()
+	return s.next.Restore(ctx, id, userID)
+}
+
+func (s *todoService) PurgeDeleted(ctx context.Context, retention time.Duration) (_ int64, err error) {
+	ctx, span := s.tracer.Start(ctx, "TodoService.PurgeDeleted")
+	defer func() { end(span, err) }()
+	return s.next.PurgeDeleted(ctx, retention)
+}
+
+// userService starts a span for each call to the UserService it wraps.
+type userService struct {
+	next   domain.UserService
+	tracer trace.Tracer
+}
+
+// UserService returns svc, tracing each of its calls as a child of the span
+// in the call's context.
+func UserService(svc domain.UserService, provider trace.TracerProvider) domain.UserService {
+	return &userService{next: svc, tracer: Tracer(provider)}
+}
+
+func (s *userService) SignUp(ctx context.Context, email, password string) (_ *domain.User, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.SignUp")
+	defer func() { end(span, err) }()
+	return s.next.SignUp(ctx, email, password)
+}
+
+func (s *userService) Login(ctx context.Context, email, password, clientIP string) (_ *domain.TokenPair, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.Login")
+	defer func() { end(span, err) }()
+	return s.next.Login(ctx, email, password, clientIP)
+}
+
+func (s *userService) LoginExternal(ctx context.Context, identity domain.ExternalIdentity) (_ *domain.TokenPair, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.LoginExternal")
+	defer func() { end(span, err) }()
+	return s.next.LoginExternal(ctx, identity)
+}
+
+func (s *userService) LoginMFA(ctx context.Context, mfaToken, code, clientIP string) (_ *domain.TokenPair, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.LoginMFA")
+	defer func() { end(span, err) }()
+	return s.next.LoginMFA(ctx, mfaToken, code, clientIP)
+}
+
+func (s *userService) RefreshToken(ctx context.Context, refreshToken string) (_ *domain.TokenPair, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.RefreshToken")
+	defer func() { end(span, err) }()
+	return s.next.RefreshToken(ctx, refreshToken)
+}
+
+func (s *userService) Logout(ctx context.Context, refreshToken string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.Logout")
+	defer func() { end(span, err) }()
+	return s.next.Logout(ctx, refreshToken)
+}
+
+func (s *userService) LogoutAll(ctx context.Context, userID uuid.UUID) (err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.LogoutAll")
+	defer func() { end(span, err) }()
+	return s.next.LogoutAll(ctx, userID)
+}
+
+func (s *userService) ListUsers(ctx context.Context, limit, offset int) (_ *domain.UserPage, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.ListUsers")
+	defer func() { end(span, err) }()
+	return s.next.ListUsers(ctx, limit, offset)
+}
+
+func (s *userService) Impersonate(ctx context.Context, adminID, userID uuid.UUID) (_ *domain.TokenPair, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.Impersonate")
+	defer func() { end(span, err) }()
+	return s.next.Impersonate(ctx, adminID, userID)
+}
+
+func (s *userService) VerifyEmail(ctx context.Context, token string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.VerifyEmail")
+	defer func() { end(span, err) }()
+	return s.next.VerifyEmail(ctx, token)
+}
+
+func (s *userService) ForgotPassword(ctx context.Context, email string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.ForgotPassword")
+	defer func() { end(span, err) }()
+	return s.next.ForgotPassword(ctx, email)
+}
+
+func (s *userService) ResetPassword(ctx context.Context, token, newPassword string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.ResetPassword")
+	defer func() { end(span, err) }()
+	return s.next.ResetPassword(ctx, token, newPassword)
+}
+
+func (s *userService) GetUser(ctx context.Context, userID uuid.UUID) (_ *domain.User, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.GetUser")
+	defer func() { end(span, err) }()
+	return s.next.GetUser(ctx, userID)
+}
+
+func (s *userService) ChangeEmail(ctx context.Context, userID uuid.UUID, newEmail, currentPassword string) (_ *domain.User, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.ChangeEmail")
+	defer func() { end(span, err) }()
+	return s.next.ChangeEmail(ctx, userID, newEmail, currentPassword)
+}
+
+func (s *userService) ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) (_ *domain.TokenPair, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.ChangePassword")
+	defer func() { end(span, err) }()
+	return s.next.ChangePassword(ctx, userID, currentPassword, newPassword)
+}
+
+func (s *userService) DeleteAccount(ctx context.Context, userID uuid.UUID, currentPassword string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.DeleteAccount")
+	defer func() { end(span, err) }()
+	return s.next.DeleteAccount(ctx, userID, currentPassword)
+}
+
+func (s *userService) EnrollTOTP(ctx context.Context, userID uuid.UUID, currentPassword string) (_ *domain.TOTPEnrollment, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.EnrollTOTP")
+	defer func() { end(span, err) }()
+	return s.next.EnrollTOTP(ctx, userID, currentPassword)
+}
+
+func (s *userService) ConfirmTOTP(ctx context.Context, userID uuid.UUID, currentPassword, code string) (_ []string, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.ConfirmTOTP")
+	defer func() { end(span, err) }()
+	return s.next.ConfirmTOTP(ctx, userID, currentPassword, code)
+}
+
+func (s *userService) DisableMFA(ctx context.Context, userID uuid.UUID, currentPassword string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.DisableMFA")
+	defer func() { end(span, err) }()
+	return s.next.DisableMFA(ctx, userID, currentPassword)
+}
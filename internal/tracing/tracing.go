@@ -0,0 +1,80 @@
+// Package tracing records OpenTelemetry traces of the API's requests: a span
+// per request, with spans for the service calls and database queries made
+// for it. A caller's trace is continued from its W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/prachaya-orr/relearn-golang/internal/config"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// instrumentation names the tracer the spans come from
+const instrumentation = "github.com/prachaya-orr/relearn-golang"
+
+// Propagator reads and writes trace context in W3C traceparent and tracestate headers.
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// Tracer returns the tracer the API's spans are started with.
+func Tracer(provider trace.TracerProvider) trace.Tracer {
+	return provider.Tracer(instrumentation)
+}
+
+// NewProvider returns a tracer provider sending spans to exporter in batches.
+func NewProvider(cfg config.TracingConfig, exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))),
+	)
+}
+
+// Setup returns the tracer provider cfg asks for, exporting to the OTLP
+// collector when tracing is enabled, and a function that exports the spans
+// still waiting before the API exits. With tracing off, the provider records
+// nothing.
+func Setup(ctx context.Context, cfg config.TracingConfig) (trace.TracerProvider, func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+	provider := NewProvider(cfg, exporter)
+	return provider, provider.Shutdown, nil
+}
+
+// TraceID returns the ID of the trace ctx is part of, or "" when there is none.
+func TraceID(ctx context.Context) string {
+	span := trace.SpanContextFromContext(ctx)
+	if !span.HasTraceID() {
+		return ""
+	}
+	return span.TraceID().String()
+}
+
+// end ends span, recording err. A domain error is the caller's mistake, like
+// a wrong password, so it only labels the span; anything else fails it.
+func end(span trace.Span, err error) {
+	var domainErr *domain.Error
+	switch {
+	case err == nil:
+	case errors.As(err, &domainErr):
+		span.SetAttributes(semconv.ErrorTypeKey.String(domainErr.Code))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,118 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prachaya-orr/relearn-golang/internal/domain"
+	"github.com/prachaya-orr/relearn-golang/internal/repository/repositorytest"
+	"github.com/prachaya-orr/relearn-golang/internal/tracing"
+	"github.com/prachaya-orr/relearn-golang/internal/tracing/tracingtest"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// findTodoService answers FindByID with err
+type findTodoService struct {
+	domain.TodoService
+	err error
+}
+
+func (s *findTodoService) FindByID(context.Context, uuid.UUID, uuid.UUID) (*domain.Todo, error) {
+	return nil, s.err
+}
+
+func TestTodoService(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status codes.Code
+	}{
+		{name: "Success", status: codes.Unset},
+		// Not finding the todo is an answer, not a failure
+		{name: "Domain Error", err: domain.ErrTodoNotFound, status: codes.Unset},
+		{name: "Failure", err: errors.New("connection refused"), status: codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracingtest.NewRecorder(t)
+			svc := tracing.TodoService(&findTodoService{err: tt.err}, recorder)
+
+			ctx, parent := tracing.Tracer(recorder).Start(context.Background(), "GET /todos/:id")
+			svc.FindByID(ctx, uuid.New(), uuid.New())
+			parent.End()
+
+			span := recorder.Span("TodoService.FindByID")
+			if span == nil {
+				t.Fatalf("expected a span, got %v", recorder.Spans())
+			}
+			if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+				t.Error("expected the span to be a child of the request's")
+			}
+			if span.Status.Code != tt.status {
+				t.Errorf("expected status %v, got %v", tt.status, span.Status.Code)
+			}
+		})
+	}
+}
+
+func TestGormPlugin(t *testing.T) {
+	recorder := tracingtest.NewRecorder(t)
+	db := repositorytest.NewBlockingDB(t)
+	if err := db.Use(tracing.GormPlugin(recorder)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := tracing.Tracer(recorder).Start(context.Background(), "GET /todos")
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	var todos []domain.Todo
+	if err := db.WithContext(ctx).Where("title = ?", "secret plans").Find(&todos).Error; err == nil {
+		t.Fatal("expected the query to time out")
+	}
+	parent.End()
+
+	span := recorder.Span("gorm.query")
+	if span == nil {
+		t.Fatalf("expected a span, got %v", recorder.Spans())
+	}
+	if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Error("expected the span to be a child of the request's")
+	}
+	if span.Status.Code != codes.Error {
+		t.Errorf("expected the timed out query to fail the span, got %v", span.Status.Code)
+	}
+	attrs := map[string]string{}
+	for _, attr := range span.Attributes {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs["db.collection.name"] != "todos" || attrs["db.system.name"] != "postgresql" {
+		t.Errorf("expected the table and database, got %v", attrs)
+	}
+	if query := attrs["db.query.text"]; !strings.Contains(query, "$1") || strings.Contains(query, "secret plans") {
+		t.Errorf("expected the query with placeholders, got %q", query)
+	}
+}
+
+func TestTraceID(t *testing.T) {
+	if id := tracing.TraceID(context.Background()); id != "" {
+		t.Errorf("expected no trace ID, got %q", id)
+	}
+
+	recorder := tracingtest.NewRecorder(t)
+	ctx, span := tracing.Tracer(recorder).Start(context.Background(), "request")
+	defer span.End()
+	if id := tracing.TraceID(ctx); id != span.SpanContext().TraceID().String() {
+		t.Errorf("expected the span's trace ID, got %q", id)
+	}
+
+	// Tracing off records nothing
+	_, span = tracing.Tracer(noop.NewTracerProvider()).Start(context.Background(), "request")
+	if span.IsRecording() {
+		t.Error("expected a span that isn't recorded")
+	}
+}
@@ -0,0 +1,41 @@
+// Package tracingtest records spans in memory, for tests to look at.
+package tracingtest
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Recorder is a tracer provider keeping every span it ends in memory.
+type Recorder struct {
+	*sdktrace.TracerProvider
+	exporter *tracetest.InMemoryExporter
+}
+
+// NewRecorder returns a Recorder, shut down when the test ends.
+func NewRecorder(t testing.TB) *Recorder {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	// Spans are exported as they end, so a test sees them right away
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return &Recorder{TracerProvider: provider, exporter: exporter}
+}
+
+// Spans returns the spans ended so far, in the order they ended.
+func (r *Recorder) Spans() tracetest.SpanStubs {
+	return r.exporter.GetSpans()
+}
+
+// Span returns the ended span called name, or nil.
+func (r *Recorder) Span(name string) *tracetest.SpanStub {
+	for _, span := range r.Spans() {
+		if span.Name == name {
+			return &span
+		}
+	}
+	return nil
+}
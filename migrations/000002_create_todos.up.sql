@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS todos (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    title       text NOT NULL,
+    description text,
+    completed   boolean DEFAULT false,
+    user_id     uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    version     bigint NOT NULL DEFAULT 1,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    deleted_at  timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_todos_user_id ON todos (user_id);
+CREATE INDEX IF NOT EXISTS idx_todos_deleted_at ON todos (deleted_at);
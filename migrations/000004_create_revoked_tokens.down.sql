@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS revoked_tokens;
+
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS access_token_id;
@@ -0,0 +1,9 @@
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS access_token_id uuid;
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    id         uuid PRIMARY KEY,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
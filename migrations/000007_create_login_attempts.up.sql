@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key            text PRIMARY KEY,
+    failures       integer NOT NULL,
+    last_failed_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failed_at ON login_attempts (last_failed_at);
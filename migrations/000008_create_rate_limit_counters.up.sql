@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+    key          text NOT NULL,
+    window_start timestamptz NOT NULL,
+    count        bigint NOT NULL,
+    expires_at   timestamptz NOT NULL,
+    PRIMARY KEY (key, window_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_counters_expires_at ON rate_limit_counters (expires_at);
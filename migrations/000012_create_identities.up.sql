@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS identities (
+    id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider   text NOT NULL,
+    subject    text NOT NULL,
+    created_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identities_provider_subject ON identities (provider, subject);
+CREATE INDEX IF NOT EXISTS idx_identities_user_id ON identities (user_id);
@@ -0,0 +1,5 @@
+-- An email is one account whatever its case. Should two accounts differ only
+-- in case, the update fails and they have to be merged by hand first.
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email));